@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"github.com/adolp26/querybase/internal/crypto"
 	"github.com/adolp26/querybase/internal/database"
 	"github.com/adolp26/querybase/internal/handlers"
+	"github.com/adolp26/querybase/internal/masking"
 	"github.com/adolp26/querybase/internal/middleware"
+	"github.com/adolp26/querybase/internal/oidc"
+	"github.com/adolp26/querybase/internal/ratelimit"
 	"github.com/adolp26/querybase/internal/repository"
+	"github.com/adolp26/querybase/internal/secrets"
 	"github.com/adolp26/querybase/internal/services"
 	"github.com/adolp26/querybase/pkg/config"
 	"github.com/gin-gonic/gin"
@@ -31,7 +38,7 @@ func main() {
 	if err := crypto.Init(); err != nil {
 		fmt.Printf("[Crypto] Aviso: %v (senhas nao serao descriptografadas)\n", err)
 	} else {
-		fmt.Println("[Crypto] OK")
+		fmt.Printf("[Crypto] OK (chave ativa: %s)\n", crypto.ActiveKeyID())
 	}
 
 
@@ -56,18 +63,60 @@ func main() {
 
 	// ConnectionManager (conexoes dinamicas)
 	fmt.Println("[ConnectionManager] Inicializando...")
-	connManager := database.NewConnectionManager()
+	connManager := database.NewConnectionManager(cfg.Pool)
 	defer connManager.CloseAll()
 	fmt.Println("[ConnectionManager] OK")
 
 
 	cacheService := services.NewCacheService(redisClient)
 	queryRepo := repository.NewQueryRepository(postgresClient.GetDB())
-	datasourceRepo := repository.NewDatasourceRepository(postgresClient.GetDB())
+	// Provedores de segredos para datasources com password_ref
+	secretRegistry := secrets.NewRegistry(secrets.Policy{
+		EnvPrefix:   cfg.Secrets.EnvPrefix,
+		FileDirs:    cfg.Secrets.FileDirs,
+		VaultPrefix: cfg.Secrets.Vault.MountPrefix,
+	})
+	secretRegistry.Register("env", secrets.EnvProvider{})
+	secretRegistry.Register("file", secrets.FileProvider{})
+	secretRegistry.Register("vault", secrets.NewVaultProvider(cfg.Secrets.Vault.Address, cfg.Secrets.Vault.Token))
+	secretProvider := secrets.NewCache(secretRegistry, time.Duration(cfg.Secrets.CacheTTL)*time.Second)
 
+	datasourceRepo := repository.NewDatasourceRepository(postgresClient.GetDB(), secretProvider)
+	apiKeyRepo := repository.NewAPIKeyRepository(postgresClient.GetDB())
+	apiKeyService := services.NewAPIKeyService(apiKeyRepo, cfg.Security.APIKeyCacheTTL)
 
+	// Versao atual de cada query; queries ja publicadas adotam a definicao atual
+	if err := queryRepo.EnsureAllVersions(context.Background(), "system"); err != nil {
+		fmt.Printf("[Versions] Erro ao registrar versoes: %v\n", err)
+	}
+
+	// Fecha pools ociosos e de datasources desativados/removidos
+	connManager.StartJanitor(datasourceRepo.ListActiveIDs)
+
+
+	// A acao hash exige mask_hash_key: sem ela o hash de um CPF seria revertido
+	// por forca bruta
+	masker := masking.NewMasker(cfg.Security.MaskHashKey)
+	if queries, err := queryRepo.ListAll(context.Background()); err != nil {
+		fmt.Printf("[Masking] Erro ao conferir politicas de coluna: %v\n", err)
+	} else {
+		for _, query := range queries {
+			if err := masker.CheckPolicies(query.ColumnPolicies); err != nil {
+				log.Fatalf("Query '%s': %v", query.Slug, err)
+			}
+		}
+	}
+
+	healthHandler := handlers.NewHealthHandler(connManager)
+	adminHandler := handlers.NewAdminHandler(connManager)
+	queryAdminHandler := handlers.NewQueryAdminHandler(queryRepo, datasourceRepo, cacheService, masker)
+	datasourceAdminHandler := handlers.NewDatasourceAdminHandler(datasourceRepo, connManager)
+	apiKeyAdminHandler := handlers.NewAPIKeyAdminHandler(apiKeyRepo, apiKeyService)
+	catalogHandler := handlers.NewCatalogHandler(queryRepo, datasourceRepo, cacheService, masker)
+	metricsHandler := handlers.NewMetricsHandler(connManager)
 	connectionHandler := handlers.NewConnectionHandler(connManager)
-	dynamicHandler := handlers.NewDynamicQueryHandler(queryRepo, datasourceRepo, connManager, cacheService)
+	quotaService := services.NewQuotaService(redisClient, cfg.Quotas.DefaultPerKey)
+	dynamicHandler := handlers.NewDynamicQueryHandler(queryRepo, datasourceRepo, connManager, cacheService, masker, quotaService)
 
 
 	if cfg.Server.Mode == "release" {
@@ -75,6 +124,11 @@ func main() {
 	}
 
 	router := gin.New()
+	// Sem proxies confiaveis o IP do cliente e o da conexao; o X-Forwarded-For
+	// de um cliente qualquer burlaria o rate limit por IP
+	if err := router.SetTrustedProxies(cfg.Security.TrustedProxies); err != nil {
+		log.Fatalf("security.trusted_proxies invalido: %v", err)
+	}
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 
@@ -87,9 +141,10 @@ func main() {
 
 	// Security headers
 	router.Use(middleware.SecurityHeaders())
-	router.Use(middleware.InputSanitizer())
 
-	// Rate limiting
+	// Rate limiting (Redis). As regras pre_auth_rules rodam antes da
+	// autenticacao, para limitar tambem chaves invalidas; as demais rodam
+	// depois, para limitar por chave ou principal
 	rateLimitConfig := middleware.NewRateLimitConfig()
 	rateLimitConfig.Enabled = cfg.Security.EnableRateLimit
 	if cfg.Security.RequestsPerMinute > 0 {
@@ -98,22 +153,84 @@ func main() {
 	if cfg.Security.BurstSize > 0 {
 		rateLimitConfig.BurstSize = cfg.Security.BurstSize
 	}
-	router.Use(middleware.RateLimit(rateLimitConfig))
+	rateLimitConfig.Rules = cfg.RateLimit.Rules
+	limiter, err := ratelimit.NewRedisLimiter(redisClient.Client, cfg.RateLimit.Algorithm)
+	if err != nil {
+		log.Fatalf("[RateLimit] Configuracao invalida: %v", err)
+	}
+	rateLimitConfig.Limiter = limiter
+
+	preAuthConfig := *rateLimitConfig
+	preAuthConfig.Rules = cfg.RateLimit.PreAuthRules
+	preAuthConfig.PreAuth = true
+
+	for _, config := range []*middleware.RateLimitConfig{&preAuthConfig, rateLimitConfig} {
+		if err := config.Validate(); err != nil {
+			log.Fatalf("[RateLimit] Configuracao invalida: %v", err)
+		}
+	}
+	if rateLimitConfig.Enabled {
+		fmt.Printf("[RateLimit] %s no Redis (%d regras antes da autenticacao)\n", limiter.Algorithm(), len(preAuthConfig.Rules))
+	}
+	router.Use(middleware.RateLimit(&preAuthConfig))
 
 	// API Key auth
 	authConfig := middleware.NewAuthConfig()
 	authConfig.Enabled = cfg.Security.EnableAuth
+	authConfig.Keys = apiKeyService
 	for _, key := range cfg.Security.APIKeys {
 		if key != "" {
 			authConfig.AddKey(key)
 		}
 	}
+	for _, key := range cfg.Security.AdminAPIKeys {
+		if key != "" {
+			authConfig.AddAdminKey(key)
+		}
+	}
+	for _, named := range cfg.Security.NamedAdminKeys {
+		name := strings.TrimSpace(named.Name)
+		if name == "" || named.Key == "" {
+			log.Fatalf("security.named_admin_keys: cada entrada precisa de name e key")
+		}
+		authConfig.AddNamedAdminKey(name, named.Key)
+	}
+
+	// Tokens OIDC (Authorization: Bearer)
+	if cfg.OIDC.Enabled {
+		keySet, err := oidc.NewKeySet(cfg.OIDC.JWKSURL, cfg.OIDC.JWKSFile)
+		if err != nil {
+			log.Fatalf("[OIDC] Configuracao invalida: %v", err)
+		}
+		verifier, err := oidc.NewVerifier(keySet, cfg.OIDC)
+		if err != nil {
+			log.Fatalf("[OIDC] Configuracao invalida: %v", err)
+		}
+		if err := keySet.Refresh(context.Background()); err != nil {
+			fmt.Printf("[OIDC] Erro ao carregar JWKS (nova tentativa no proximo token): %v\n", err)
+		}
+
+		refreshInterval := cfg.OIDC.RefreshInterval
+		if refreshInterval <= 0 {
+			refreshInterval = 3600
+		}
+		keySet.StartRefresh(context.Background(), time.Duration(refreshInterval)*time.Second)
+
+		authConfig.Tokens = verifier
+		fmt.Printf("[OIDC] Tokens do issuer %s habilitados\n", cfg.OIDC.Issuer)
+	}
 	router.Use(middleware.APIKeyAuth(authConfig))
 
+	// Rate limiting por chave/principal, depois da autenticacao
+	router.Use(middleware.RateLimit(rateLimitConfig))
+
 // Routes
 
 	// Health check
-	router.GET("/health", handlers.HealthCheck)
+	router.GET("/health", healthHandler.HealthCheck)
+
+	// Metricas dos pools (formato Prometheus)
+	router.GET("/metrics", metricsHandler.Metrics)
 
 	// Testar conexao com datasource (chamado pelo Laravel)
 	router.POST("/api/test-connection", connectionHandler.TestConnection)
@@ -124,6 +241,47 @@ func main() {
 	// Executar query por slug
 	router.GET("/api/query/:slug", dynamicHandler.Execute)
 
+	// Consumo do dia da credencial (e da query, com ?query=slug)
+	router.GET("/api/quota", dynamicHandler.Quota)
+
+	// Administracao
+	admin := router.Group("/api/admin", middleware.RequireAdmin(authConfig))
+	admin.GET("/datasources/status", adminHandler.DatasourceStatus)
+	admin.GET("/datasources", datasourceAdminHandler.List)
+	admin.POST("/datasources", datasourceAdminHandler.Create)
+	admin.GET("/datasources/:slug", datasourceAdminHandler.Get)
+	admin.PUT("/datasources/:slug", datasourceAdminHandler.Update)
+	admin.POST("/datasources/:slug/activate", datasourceAdminHandler.Activate)
+	admin.POST("/datasources/:slug/deactivate", datasourceAdminHandler.Deactivate)
+	admin.POST("/datasources/:slug/test", datasourceAdminHandler.Test)
+	admin.GET("/pools", adminHandler.PoolStats)
+	admin.GET("/queries", queryAdminHandler.List)
+	admin.POST("/queries", queryAdminHandler.Create)
+	admin.GET("/queries/:slug", queryAdminHandler.Get)
+	admin.PUT("/queries/:slug", queryAdminHandler.Update)
+	admin.DELETE("/queries/:slug", queryAdminHandler.Delete)
+	admin.POST("/queries/:slug/parameters", queryAdminHandler.AddParameter)
+	admin.PUT("/queries/:slug/parameters/:name", queryAdminHandler.UpdateParameter)
+	admin.DELETE("/queries/:slug/parameters/:name", queryAdminHandler.DeleteParameter)
+	admin.GET("/queries/:slug/explain", dynamicHandler.Explain)
+	admin.GET("/queries/:slug/versions", queryAdminHandler.Versions)
+	admin.GET("/queries/:slug/versions/:version", queryAdminHandler.GetVersion)
+	admin.GET("/queries/:slug/diff", queryAdminHandler.DiffVersions)
+	admin.POST("/queries/:slug/rollback", queryAdminHandler.Rollback)
+	admin.POST("/queries/:slug/submit", queryAdminHandler.Submit)
+	admin.POST("/queries/:slug/approve", queryAdminHandler.Approve)
+	admin.POST("/queries/:slug/reject", queryAdminHandler.Reject)
+	admin.POST("/queries/:slug/deprecate", queryAdminHandler.Deprecate)
+	admin.PUT("/queries/:slug/pin", queryAdminHandler.Pin)
+	admin.DELETE("/queries/:slug/pin", queryAdminHandler.Unpin)
+	admin.GET("/api-keys", apiKeyAdminHandler.List)
+	admin.POST("/api-keys", apiKeyAdminHandler.Create)
+	admin.POST("/api-keys/:id/rotate", apiKeyAdminHandler.Rotate)
+	admin.DELETE("/api-keys/:id", apiKeyAdminHandler.Revoke)
+	admin.GET("/catalog", catalogHandler.Export)
+	admin.POST("/catalog/plan", catalogHandler.Plan)
+	admin.POST("/catalog/apply", catalogHandler.Apply)
+
 
 	addr := fmt.Sprintf(":%s", cfg.Server.Port)
 	fmt.Println("")
@@ -136,6 +294,16 @@ func main() {
 	fmt.Println("  POST /api/test-connection - Testar conexao com datasource")
 	fmt.Println("  GET  /api/queries         - Listar queries disponiveis")
 	fmt.Println("  GET  /api/query/:slug     - Executar query por slug")
+	fmt.Println("  GET  /metrics             - Metricas dos pools (Prometheus)")
+	fmt.Println("  GET  /api/admin/datasources/status - Estado dos pools e circuit breakers")
+	fmt.Println("  GET  /api/admin/pools     - Estatisticas de conexao dos pools")
+	fmt.Println("  *    /api/admin/datasources - Cadastro, teste e desativacao de datasources")
+	fmt.Println("  *    /api/admin/queries   - CRUD de queries e parametros")
+	fmt.Println("  GET  /api/admin/queries/:slug/explain - Plano de execucao (dry-run)")
+	fmt.Println("  *    /api/admin/queries/:slug/versions - Historico, diff, rollback e pin de versoes")
+	fmt.Println("  POST /api/admin/queries/:slug/submit|approve|reject|deprecate - Revisao e publicacao")
+	fmt.Println("  *    /api/admin/api-keys  - Emitir, rotacionar e revogar API keys")
+	fmt.Println("  *    /api/admin/catalog   - Exportar, planejar e aplicar o catalogo YAML")
 	fmt.Println("")
 
 	if err := router.Run(addr); err != nil {
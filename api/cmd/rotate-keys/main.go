@@ -0,0 +1,60 @@
+// rotate-keys regrava as senhas dos datasources com a chave ativa do keyring
+// (a primeira de QUERYBASE_ENCRYPTION_KEYS). Depois de rodar, as chaves antigas
+// podem sair do keyring da API e do Laravel.
+//
+//	go run ./cmd/rotate-keys [-config configs/config.yaml] [-dry-run]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/adolp26/querybase/internal/crypto"
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/adolp26/querybase/pkg/config"
+)
+
+func main() {
+	configPath := flag.String("config", "configs/config.yaml", "arquivo de configuracao")
+	dryRun := flag.Bool("dry-run", false, "apenas confere quais senhas seriam regravadas")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("[Config] Erro ao carregar config: %v", err)
+	}
+
+	if err := crypto.Init(); err != nil {
+		log.Fatalf("[Crypto] Erro ao carregar keyring: %v", err)
+	}
+
+	postgresClient, err := database.NewPostgresClient(cfg.Postgres)
+	if err != nil {
+		log.Fatalf("[PostgreSQL] Erro ao conectar: %v", err)
+	}
+	defer postgresClient.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	// Senhas vindas de password_ref ficam fora do banco e nao sao regravadas
+	datasourceRepo := repository.NewDatasourceRepository(postgresClient.GetDB(), nil)
+	result, err := datasourceRepo.ReencryptPasswords(ctx, *dryRun)
+	if err != nil {
+		log.Fatalf("[Rotacao] Nenhuma senha foi alterada: %v", err)
+	}
+
+	action := "Regravadas"
+	if *dryRun {
+		action = "Seriam regravadas"
+	}
+
+	fmt.Printf("[Rotacao] Chave ativa: %s\n", result.ActiveID)
+	fmt.Printf("[Rotacao] %s: %d (%s)\n", action, len(result.Rotated), strings.Join(result.Rotated, ", "))
+	fmt.Printf("[Rotacao] Ja na chave ativa: %d\n", result.Current)
+}
@@ -0,0 +1,8 @@
+-- Limites de concorrencia por datasource e por query.
+-- 0 usa o padrao: max_open_conns do datasource e pool.max_queued_queries do config.yaml.
+
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS max_concurrent_queries INTEGER DEFAULT 0;
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS max_queued_queries INTEGER DEFAULT 0;
+
+-- 0 = sem limite proprio, apenas o do datasource
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS max_concurrency INTEGER DEFAULT 0;
@@ -0,0 +1,19 @@
+-- Endpoints adicionais (replicas/standby) de um datasource.
+-- O host/port do proprio datasource continua sendo o endpoint primario "primary";
+-- database, usuario e senha sao compartilhados com o datasource.
+
+CREATE TABLE IF NOT EXISTS datasource_endpoints (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    datasource_id   UUID NOT NULL REFERENCES datasources(id) ON DELETE CASCADE,
+    name            VARCHAR(100) NOT NULL,
+    host            VARCHAR(255) NOT NULL,
+    port            VARCHAR(10) NOT NULL,
+    role            VARCHAR(20) NOT NULL DEFAULT 'replica' CHECK (role IN ('primary', 'replica')),
+    priority        INTEGER NOT NULL DEFAULT 100,
+    is_active       BOOLEAN DEFAULT true,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE(datasource_id, name),
+    CHECK (name <> 'primary')
+);
+
+CREATE INDEX IF NOT EXISTS idx_datasource_endpoints_datasource ON datasource_endpoints(datasource_id);
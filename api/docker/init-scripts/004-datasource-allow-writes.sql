@@ -0,0 +1,4 @@
+-- Por padrao toda query roda em transacao somente leitura e o SQL salvo precisa
+-- ser um unico SELECT/WITH. allow_writes = true libera escrita para endpoints confiaveis.
+
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS allow_writes BOOLEAN DEFAULT false;
@@ -0,0 +1,5 @@
+-- Tempo de vida e tempo ocioso maximo de cada conexao do pool, em segundos.
+-- NULL ou 0 usa o padrao da API (300s de vida, 120s ociosa).
+
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS conn_max_lifetime_seconds INTEGER;
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS conn_max_idle_time_seconds INTEGER;
@@ -0,0 +1,23 @@
+-- Historico imutavel das definicoes de cada query (SQL, parametros e configuracoes).
+-- definition guarda a query no mesmo formato do catalogo YAML/JSON.
+-- A API grava uma nova versao ao salvar a query, ao envia-la para revisao e ao
+-- listar o historico. Alteracoes feitas pela interface Laravel so viram versao
+-- em um desses momentos; ate la, queries publicadas continuam servindo a
+-- versao publicada e a definicao nova so pode ser testada pelo autor.
+
+CREATE TABLE IF NOT EXISTS query_versions (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    query_id        UUID NOT NULL REFERENCES queries(id) ON DELETE CASCADE,
+    version         INTEGER NOT NULL,
+    definition      JSONB NOT NULL,
+    datasource_id   UUID REFERENCES datasources(id) ON DELETE SET NULL,
+    content_hash    VARCHAR(64) NOT NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    created_by      VARCHAR(255),
+    UNIQUE(query_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_query_versions_query ON query_versions(query_id, version DESC);
+
+-- Versao fixa servida quando a requisicao nao pede uma versao especifica.
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS pinned_version INTEGER;
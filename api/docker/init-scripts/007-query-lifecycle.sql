@@ -0,0 +1,33 @@
+-- Ciclo de vida das queries: draft -> pending_review -> published -> deprecated.
+-- Consumidores so recebem a versao publicada (published_version); editar a
+-- query volta o status para draft sem tirar do ar a versao ja publicada.
+-- Publicar exige aprovacao de um usuario diferente de quem enviou para revisao.
+
+-- Queries que ja existiam continuam publicadas; as novas nascem como draft,
+-- inclusive as criadas pela interface Laravel.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'queries' AND column_name = 'status'
+    ) THEN
+        ALTER TABLE queries ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'published'
+            CHECK (status IN ('draft', 'pending_review', 'published', 'deprecated'));
+        ALTER TABLE queries ALTER COLUMN status SET DEFAULT 'draft';
+    END IF;
+END $$;
+
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS published_version INTEGER;
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS submitted_version INTEGER;
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS submitted_by VARCHAR(255);
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS reviewed_by VARCHAR(255);
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS reviewed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS review_comment TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_queries_status ON queries(status);
+
+-- Quem aprovou cada versao. So versoes aprovadas podem ser fixadas ou pedidas
+-- com ?version= por outros usuarios.
+ALTER TABLE query_versions ADD COLUMN IF NOT EXISTS approved_by VARCHAR(255);
+ALTER TABLE query_versions ADD COLUMN IF NOT EXISTS approved_at TIMESTAMP WITH TIME ZONE;
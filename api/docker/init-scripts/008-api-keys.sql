@@ -0,0 +1,26 @@
+-- API keys gerenciadas pela API, sem reiniciar o servico.
+-- A chave em texto puro so e mostrada na emissao: o banco guarda o prefixo
+-- (para localizar o registro) e o hash SHA-256 do segredo com um salt por chave.
+-- scopes restringe o que a chave executa: {"queries": [...], "datasources": [...], "tags": [...]}.
+-- Listas vazias ou ausentes nao restringem; slugs aceitam curingas ("vendas-*").
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name            VARCHAR(255) NOT NULL,
+    owner           VARCHAR(255),
+    key_prefix      VARCHAR(32) NOT NULL UNIQUE,
+    key_hash        VARCHAR(64) NOT NULL,
+    salt            VARCHAR(64) NOT NULL,
+    scopes          JSONB NOT NULL DEFAULT '{}',
+    expires_at      TIMESTAMP WITH TIME ZONE,
+    last_used_at    TIMESTAMP WITH TIME ZONE,
+    revoked_at      TIMESTAMP WITH TIME ZONE,
+    rotated_from    UUID REFERENCES api_keys(id) ON DELETE SET NULL,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    created_by      VARCHAR(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_owner ON api_keys(owner);
+
+-- Tags das queries, usadas nos scopes das API keys.
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS tags JSONB NOT NULL DEFAULT '[]';
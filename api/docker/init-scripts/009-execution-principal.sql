@@ -0,0 +1,5 @@
+-- Quem executou a query: API key, chave do config.yaml ou usuario OIDC.
+
+ALTER TABLE query_executions ADD COLUMN IF NOT EXISTS principal VARCHAR(255);
+
+CREATE INDEX IF NOT EXISTS idx_query_executions_principal ON query_executions(principal);
@@ -0,0 +1,12 @@
+-- Controle de acesso por role. Lista vazia libera para qualquer chamador
+-- autenticado; com roles, o chamador precisa ter ao menos uma delas na query
+-- E no datasource. As roles sao comparadas em minusculas.
+
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS allowed_roles JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS allowed_roles JSONB NOT NULL DEFAULT '[]';
+
+-- Roles das API keys emitidas pela API (tokens OIDC trazem as roles nos claims).
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS roles JSONB NOT NULL DEFAULT '[]';
+
+-- Execucoes recusadas pelo controle de acesso tambem entram no log.
+ALTER TABLE query_executions ADD COLUMN IF NOT EXISTS denied BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,8 @@
+-- Parametros vinculados a credencial (row-level security por parametro).
+-- Com bind_from preenchido o valor vem do atributo da API key ou do claim do
+-- token OIDC com esse nome (ex.: "branch_id"), nunca da query string.
+
+ALTER TABLE query_parameters ADD COLUMN IF NOT EXISTS bind_from VARCHAR(100);
+
+-- Atributos das API keys usados pelos parametros vinculados: {"branch_id": "42"}.
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+-- Politicas de mascaramento por coluna do resultado da query:
+-- [{"column": "cpf", "action": "mask", "pattern": "***.###.###-**", "unmasked_roles": ["rh"]}]
+-- action: hide, mask, hash ou truncate. Quem tem uma das unmasked_roles ve o
+-- valor completo. Assim como allowed_roles, nao entra no historico de versoes.
+
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS column_policies JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,6 @@
+-- Senha do datasource fora do banco de metadados: password_ref aponta para o
+-- segredo (env://VAR, file:///caminho ou vault://caminho#campo) e a coluna
+-- password fica vazia. A API resolve a referencia com cache e renova o valor
+-- periodicamente, entao a senha pode ser rotacionada na origem.
+
+ALTER TABLE datasources ADD COLUMN IF NOT EXISTS password_ref VARCHAR(500);
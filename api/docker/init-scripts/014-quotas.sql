@@ -0,0 +1,9 @@
+-- Cotas diarias (dia UTC): {"rows_per_day": 1000000, "executions_per_day": 500,
+-- "db_seconds_per_day": 600}. Campos ausentes nao limitam; na API key, os
+-- ausentes usam quotas.default_per_key do config.yaml. Os contadores ficam no
+-- Redis. Assim como allowed_roles, a cota da query nao entra no historico de
+-- versoes.
+
+ALTER TABLE queries ADD COLUMN IF NOT EXISTS quota JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE api_keys ADD COLUMN IF NOT EXISTS quota JSONB NOT NULL DEFAULT '{}';
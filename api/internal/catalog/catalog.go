@@ -0,0 +1,373 @@
+// Package catalog converte as queries do banco de metadados para um arquivo
+// YAML/JSON versionado e calcula o que muda ao aplicar um arquivo no banco.
+package catalog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/adolp26/querybase/internal/models"
+	"go.yaml.in/yaml/v3"
+)
+
+// FormatVersion e a versao do formato do arquivo de catalogo.
+const FormatVersion = 1
+
+const (
+	defaultCacheTTL       = 300
+	defaultTimeoutSeconds = 30
+)
+
+type Catalog struct {
+	Version int     `yaml:"version" json:"version"`
+	Queries []Query `yaml:"queries" json:"queries"`
+}
+
+type Query struct {
+	Slug           string                `yaml:"slug" json:"slug"`
+	Name           string                `yaml:"name" json:"name"`
+	Description    string                `yaml:"description,omitempty" json:"description,omitempty"`
+	Datasource     string                `yaml:"datasource" json:"datasource"`
+	Active         *bool                 `yaml:"active,omitempty" json:"active,omitempty"`
+	CacheTTL       *int                  `yaml:"cache_ttl,omitempty" json:"cache_ttl,omitempty"`
+	TimeoutSeconds *int                  `yaml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty"`
+	MaxConcurrency int                   `yaml:"max_concurrency,omitempty" json:"max_concurrency,omitempty"`
+	Tags           []string              `yaml:"tags,omitempty" json:"tags,omitempty"`
+	AllowedRoles   []string              `yaml:"allowed_roles,omitempty" json:"allowed_roles,omitempty"`
+	ColumnPolicies []models.ColumnPolicy `yaml:"column_policies,omitempty" json:"column_policies,omitempty"`
+	Quota          *models.Quota         `yaml:"quota,omitempty" json:"quota,omitempty"`
+	SQL            string                `yaml:"sql" json:"sql"`
+	Parameters     []Parameter           `yaml:"parameters,omitempty" json:"parameters,omitempty"`
+}
+
+type Parameter struct {
+	Name        string                 `yaml:"name" json:"name"`
+	Type        string                 `yaml:"type" json:"type"`
+	Required    bool                   `yaml:"required,omitempty" json:"required,omitempty"`
+	Position    int                    `yaml:"position" json:"position"`
+	Default     *string                `yaml:"default,omitempty" json:"default,omitempty"`
+	Description string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	Validations map[string]interface{} `yaml:"validations,omitempty" json:"validations,omitempty"`
+	BindFrom    string                 `yaml:"bind_from,omitempty" json:"bind_from,omitempty"`
+}
+
+// Parse le um catalogo em YAML ou JSON (JSON tambem e YAML valido). Campos
+// desconhecidos sao rejeitados, para que erros de digitacao nao passem
+// despercebidos.
+func Parse(data []byte) (*Catalog, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var c Catalog
+	if err := decoder.Decode(&c); err != nil {
+		return nil, fmt.Errorf("catalogo invalido: %w", err)
+	}
+
+	if c.Version != FormatVersion {
+		return nil, fmt.Errorf("versao do catalogo nao suportada: %d (esperado %d)", c.Version, FormatVersion)
+	}
+
+	seen := make(map[string]bool, len(c.Queries))
+	for i := range c.Queries {
+		q := &c.Queries[i]
+		if q.Slug == "" {
+			return nil, fmt.Errorf("query na posicao %d sem slug", i+1)
+		}
+		if seen[q.Slug] {
+			return nil, fmt.Errorf("slug duplicado no catalogo: %s", q.Slug)
+		}
+		seen[q.Slug] = true
+		q.normalize()
+	}
+
+	return &c, nil
+}
+
+// Marshal serializa o catalogo em "yaml" ou "json".
+func (c *Catalog) Marshal(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(c, "", "  ")
+	case "", "yaml", "yml":
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(c); err != nil {
+			return nil, err
+		}
+		encoder.Close()
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("formato nao suportado: %s", format)
+	}
+}
+
+// FromModels monta o catalogo a partir das queries do banco.
+func FromModels(queries []models.Query) *Catalog {
+	c := &Catalog{Version: FormatVersion, Queries: make([]Query, 0, len(queries))}
+	for i := range queries {
+		c.Queries = append(c.Queries, FromModel(&queries[i]))
+	}
+
+	sort.Slice(c.Queries, func(i, j int) bool {
+		return c.Queries[i].Slug < c.Queries[j].Slug
+	})
+
+	return c
+}
+
+func FromModel(m *models.Query) Query {
+	active := m.IsActive
+	cacheTTL := m.CacheTTL
+	timeout := m.TimeoutSeconds
+
+	q := Query{
+		Slug:           m.Slug,
+		Name:           m.Name,
+		Description:    deref(m.Description),
+		Datasource:     deref(m.DatasourceSlug),
+		Active:         &active,
+		CacheTTL:       &cacheTTL,
+		TimeoutSeconds: &timeout,
+		MaxConcurrency: m.MaxConcurrency,
+		Tags:           append([]string(nil), m.Tags...),
+		AllowedRoles:   append([]string(nil), m.AllowedRoles...),
+		ColumnPolicies: append([]models.ColumnPolicy(nil), m.ColumnPolicies...),
+		SQL:            m.SQLQuery,
+	}
+	if !m.Quota.IsZero() {
+		quota := m.Quota
+		q.Quota = &quota
+	}
+
+	for _, p := range m.Parameters {
+		param := Parameter{
+			Name:        p.Name,
+			Type:        p.ParamType,
+			Required:    p.IsRequired,
+			Position:    p.Position,
+			Default:     p.DefaultValue,
+			Description: deref(p.Description),
+			BindFrom:    deref(p.BindFrom),
+		}
+		if p.Validations != nil {
+			var rules map[string]interface{}
+			if err := json.Unmarshal([]byte(*p.Validations), &rules); err == nil && len(rules) > 0 {
+				param.Validations = rules
+			}
+		}
+		q.Parameters = append(q.Parameters, param)
+	}
+
+	q.normalize()
+	return q
+}
+
+// ToModel converte a definicao do catalogo para o modelo do repositorio,
+// com o ID do datasource ja resolvido a partir do slug.
+func (q Query) ToModel(datasourceID string) (*models.Query, error) {
+	m := &models.Query{
+		Slug:           q.Slug,
+		Name:           q.Name,
+		Description:    ptr(q.Description),
+		SQLQuery:       q.SQL,
+		DatasourceID:   &datasourceID,
+		DatasourceSlug: &q.Datasource,
+		CacheTTL:       *q.CacheTTL,
+		TimeoutSeconds: *q.TimeoutSeconds,
+		MaxConcurrency: q.MaxConcurrency,
+		Tags:           append([]string{}, q.Tags...),
+		AllowedRoles:   append([]string{}, q.AllowedRoles...),
+		ColumnPolicies: append([]models.ColumnPolicy{}, q.ColumnPolicies...),
+		IsActive:       *q.Active,
+	}
+	if q.Quota != nil {
+		m.Quota = *q.Quota
+	}
+
+	for _, p := range q.Parameters {
+		param := models.QueryParameter{
+			Name:         p.Name,
+			ParamType:    p.Type,
+			IsRequired:   p.Required,
+			DefaultValue: p.Default,
+			Description:  ptr(p.Description),
+			Position:     p.Position,
+			BindFrom:     ptr(p.BindFrom),
+		}
+		if len(p.Validations) > 0 {
+			rules, err := json.Marshal(p.Validations)
+			if err != nil {
+				return nil, fmt.Errorf("validations invalidas no parametro '%s': %w", p.Name, err)
+			}
+			validations := string(rules)
+			param.Validations = &validations
+		}
+		m.Parameters = append(m.Parameters, param)
+	}
+
+	return m, nil
+}
+
+// normalize aplica os mesmos padroes da tabela queries, para que um campo
+// omitido no arquivo nao apareca como alteracao no plano.
+func (q *Query) normalize() {
+	if q.Active == nil {
+		active := true
+		q.Active = &active
+	}
+	if q.CacheTTL == nil {
+		cacheTTL := defaultCacheTTL
+		q.CacheTTL = &cacheTTL
+	}
+	if q.TimeoutSeconds == nil {
+		timeout := defaultTimeoutSeconds
+		q.TimeoutSeconds = &timeout
+	}
+	q.SQL = strings.TrimSpace(q.SQL)
+	q.Tags = NormalizeTags(q.Tags)
+	q.AllowedRoles = models.NormalizeRoles(q.AllowedRoles)
+	q.ColumnPolicies = NormalizeColumnPolicies(q.ColumnPolicies)
+	if q.Quota != nil && q.Quota.IsZero() {
+		q.Quota = nil
+	}
+
+	if len(q.Parameters) == 0 {
+		q.Parameters = nil
+	}
+	for i := range q.Parameters {
+		if len(q.Parameters[i].Validations) == 0 {
+			q.Parameters[i].Validations = nil
+		}
+		if q.Parameters[i].Type == "" {
+			q.Parameters[i].Type = "string"
+		}
+	}
+	sort.Slice(q.Parameters, func(i, j int) bool {
+		return q.Parameters[i].Position < q.Parameters[j].Position
+	})
+}
+
+// NormalizeColumnPolicies padroniza acao e roles das politicas de coluna; sem
+// politicas devolve nil.
+func NormalizeColumnPolicies(policies []models.ColumnPolicy) []models.ColumnPolicy {
+	var normalized []models.ColumnPolicy
+	for _, policy := range policies {
+		policy.Column = strings.TrimSpace(policy.Column)
+		policy.Action = strings.ToLower(strings.TrimSpace(policy.Action))
+		policy.UnmaskedRoles = models.NormalizeRoles(policy.UnmaskedRoles)
+		normalized = append(normalized, policy)
+	}
+	return normalized
+}
+
+// NormalizeTags remove espacos, vazios e repetidos e ordena as tags; sem tags
+// devolve nil, para que o campo fique fora do arquivo.
+func NormalizeTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func ptr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// Snapshot serializa a definicao da query para o historico de versoes e
+// calcula o hash do conteudo. So o que muda o resultado entra na versao: SQL,
+// parametros e datasource. Nome, cache, timeout, tags, is_active, ACL,
+// politicas de coluna e cota valem para todas as versoes e mudam sem passar
+// por revisao.
+func Snapshot(m *models.Query) ([]byte, string, error) {
+	definition, err := json.Marshal(Versioned(FromModel(m)))
+	if err != nil {
+		return nil, "", fmt.Errorf("erro ao serializar definicao: %w", err)
+	}
+
+	hash, err := ContentHash(definition, deref(m.DatasourceID))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return definition, hash, nil
+}
+
+// VersionChanged diz se next tem SQL, parametros ou datasource diferentes de
+// current, ou seja, se salvar next gera uma nova versao.
+func VersionChanged(current, next *models.Query) (bool, error) {
+	_, currentHash, err := Snapshot(current)
+	if err != nil {
+		return false, err
+	}
+	_, nextHash, err := Snapshot(next)
+	if err != nil {
+		return false, err
+	}
+	return currentHash != nextHash, nil
+}
+
+// ContentHash calcula o hash de uma definicao gravada em query_versions. O
+// datasource entra pelo ID, para que renomear o slug do datasource nao gere
+// uma nova versao. Definicoes antigas, gravadas com todos os campos, sao
+// reduzidas aos campos versionados antes do hash.
+func ContentHash(definition []byte, datasourceID string) (string, error) {
+	q, err := ParseSnapshot(definition)
+	if err != nil {
+		return "", err
+	}
+	q.Datasource = datasourceID
+
+	content, err := json.Marshal(q)
+	if err != nil {
+		return "", fmt.Errorf("erro ao serializar definicao: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Versioned devolve so os campos que fazem parte de uma versao.
+func Versioned(q Query) Query {
+	versioned := Query{
+		Datasource: q.Datasource,
+		SQL:        q.SQL,
+		Parameters: q.Parameters,
+	}
+	versioned.normalize()
+	return versioned
+}
+
+// ParseSnapshot le a definicao gravada em query_versions, so com os campos
+// versionados.
+func ParseSnapshot(definition []byte) (*Query, error) {
+	var q Query
+	if err := json.Unmarshal(definition, &q); err != nil {
+		return nil, fmt.Errorf("definicao de versao invalida: %w", err)
+	}
+	versioned := Versioned(q)
+	return &versioned, nil
+}
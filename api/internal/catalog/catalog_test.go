@@ -0,0 +1,132 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func TestSnapshot(t *testing.T) {
+	base := func() *models.Query {
+		return &models.Query{
+			ID:             "q-1",
+			Slug:           "vendas",
+			Name:           "Vendas",
+			SQLQuery:       "SELECT * FROM vendas WHERE loja = :loja",
+			DatasourceID:   strPtr("ds-1"),
+			DatasourceSlug: strPtr("erp"),
+			CacheTTL:       300,
+			TimeoutSeconds: 30,
+			IsActive:       true,
+			Parameters: []models.QueryParameter{
+				{Name: "loja", ParamType: "integer", IsRequired: true, Position: 1},
+			},
+		}
+	}
+
+	definition, hash, err := Snapshot(base())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A definicao gravada volta igual pelo ParseSnapshot
+	parsed, err := ParseSnapshot(definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Versioned(FromModel(base()))
+	if fields := Diff(parsed, &want); len(fields) != 0 {
+		t.Fatalf("definicao mudou no caminho: %v", fields)
+	}
+
+	renamed := base()
+	renamed.DatasourceSlug = strPtr("erp-novo")
+	if _, renamedHash, _ := Snapshot(renamed); renamedHash != hash {
+		t.Fatal("renomear o slug do datasource mudou o hash")
+	}
+
+	moved := base()
+	moved.DatasourceID = strPtr("ds-2")
+	if _, movedHash, _ := Snapshot(moved); movedHash == hash {
+		t.Fatal("trocar de datasource nao mudou o hash")
+	}
+
+	edited := base()
+	edited.SQLQuery += " AND ativo"
+	if _, editedHash, _ := Snapshot(edited); editedHash == hash {
+		t.Fatal("alterar o SQL nao mudou o hash")
+	}
+
+	param := base()
+	param.Parameters[0].IsRequired = false
+	if _, paramHash, _ := Snapshot(param); paramHash == hash {
+		t.Fatal("alterar um parametro nao mudou o hash")
+	}
+
+	// Desativar, renomear ou mudar cache e timeout nao cria versao
+	settings := base()
+	settings.IsActive = false
+	settings.Name = "Vendas por loja"
+	settings.CacheTTL = 60
+	settings.TimeoutSeconds = 5
+	settings.Tags = []string{"financeiro"}
+	if _, settingsHash, _ := Snapshot(settings); settingsHash != hash {
+		t.Fatal("campos fora da versao mudaram o hash")
+	}
+}
+
+func TestContentHashOfLegacyDefinition(t *testing.T) {
+	// Versao gravada antes de o historico ficar restrito a SQL, parametros e
+	// datasource: tem nome, cache e is_active na definicao
+	legacy := []byte(`{"slug":"vendas","name":"Vendas","datasource":"erp","active":false,"cache_ttl":60,` +
+		`"sql":"SELECT * FROM vendas WHERE loja = :loja",` +
+		`"parameters":[{"name":"loja","type":"integer","required":true,"position":1}]}`)
+
+	q := &models.Query{
+		Slug:           "vendas",
+		Name:           "Vendas atualizado",
+		SQLQuery:       "SELECT * FROM vendas WHERE loja = :loja",
+		DatasourceID:   strPtr("ds-1"),
+		DatasourceSlug: strPtr("erp"),
+		IsActive:       true,
+		Parameters: []models.QueryParameter{
+			{Name: "loja", ParamType: "integer", IsRequired: true, Position: 1},
+		},
+	}
+
+	_, want, err := Snapshot(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ContentHash(legacy, "ds-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Fatal("versao antiga com o mesmo SQL ganhou outro hash")
+	}
+
+	parsed, err := ParseSnapshot(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Name != "" || *parsed.CacheTTL != defaultCacheTTL || !*parsed.Active {
+		t.Fatalf("ParseSnapshot() manteve campos fora da versao: %+v", parsed)
+	}
+}
+
+func TestVersionChanged(t *testing.T) {
+	current := &models.Query{Slug: "vendas", SQLQuery: "SELECT * FROM vendas", IsActive: true}
+
+	inactive := *current
+	inactive.IsActive = false
+	if changed, err := VersionChanged(current, &inactive); err != nil || changed {
+		t.Fatalf("VersionChanged(desativar) = %v, %v; esperava false", changed, err)
+	}
+
+	edited := *current
+	edited.SQLQuery = "SELECT id FROM vendas"
+	if changed, err := VersionChanged(current, &edited); err != nil || !changed {
+		t.Fatalf("VersionChanged(novo SQL) = %v, %v; esperava true", changed, err)
+	}
+}
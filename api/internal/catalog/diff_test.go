@@ -0,0 +1,27 @@
+package catalog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"igual", "SELECT 1\nFROM dual", "SELECT 1\nFROM dual", " SELECT 1| FROM dual"},
+		{"linha trocada", "SELECT a\nFROM t\nWHERE x = 1", "SELECT a\nFROM t\nWHERE x = 2", " SELECT a| FROM t|-WHERE x = 1|+WHERE x = 2"},
+		{"linha incluida", "SELECT a\nFROM t", "SELECT a\nFROM t\nORDER BY a", " SELECT a| FROM t|+ORDER BY a"},
+		{"linha removida", "SELECT a\n-- debug\nFROM t", "SELECT a\nFROM t", " SELECT a|--- debug| FROM t"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := strings.Join(DiffLines(tt.from, tt.to), "|"); got != tt.want {
+				t.Fatalf("DiffLines() = %q, esperava %q", got, tt.want)
+			}
+		})
+	}
+}
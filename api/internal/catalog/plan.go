@@ -0,0 +1,137 @@
+package catalog
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionUnchanged Action = "unchanged"
+)
+
+// FieldChange mostra o valor atual e o valor do catalogo de um campo.
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+type Change struct {
+	Action Action                 `json:"action"`
+	Slug   string                 `json:"slug"`
+	Fields map[string]FieldChange `json:"fields,omitempty"`
+
+	// Desired e Current ficam fora do JSON; o apply usa para gravar.
+	Desired *Query        `json:"-"`
+	Current *models.Query `json:"-"`
+}
+
+type Summary struct {
+	Create    int `json:"create"`
+	Update    int `json:"update"`
+	Delete    int `json:"delete"`
+	Unchanged int `json:"unchanged"`
+}
+
+type Plan struct {
+	Changes []Change `json:"changes"`
+	Summary Summary  `json:"summary"`
+}
+
+// HasChanges diz se aplicar o plano altera alguma coisa no banco.
+func (p *Plan) HasChanges() bool {
+	return p.Summary.Create+p.Summary.Update+p.Summary.Delete > 0
+}
+
+// BuildPlan compara o catalogo com as queries atuais. Queries que existem no
+// banco e nao estao no catalogo so entram como remocao com prune.
+func BuildPlan(desired *Catalog, current []models.Query, prune bool) *Plan {
+	bySlug := make(map[string]*models.Query, len(current))
+	for i := range current {
+		bySlug[current[i].Slug] = &current[i]
+	}
+
+	plan := &Plan{Changes: []Change{}}
+	inCatalog := make(map[string]bool, len(desired.Queries))
+
+	for i := range desired.Queries {
+		want := &desired.Queries[i]
+		inCatalog[want.Slug] = true
+
+		existing, exists := bySlug[want.Slug]
+		if !exists {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Slug: want.Slug, Desired: want})
+			plan.Summary.Create++
+			continue
+		}
+
+		have := FromModel(existing)
+		fields := Diff(&have, want)
+		if len(fields) == 0 {
+			plan.Changes = append(plan.Changes, Change{Action: ActionUnchanged, Slug: want.Slug, Desired: want, Current: existing})
+			plan.Summary.Unchanged++
+			continue
+		}
+
+		plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Slug: want.Slug, Fields: fields, Desired: want, Current: existing})
+		plan.Summary.Update++
+	}
+
+	if prune {
+		for i := range current {
+			if inCatalog[current[i].Slug] {
+				continue
+			}
+			plan.Changes = append(plan.Changes, Change{Action: ActionDelete, Slug: current[i].Slug, Current: &current[i]})
+			plan.Summary.Delete++
+		}
+	}
+
+	sort.SliceStable(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].Slug < plan.Changes[j].Slug
+	})
+
+	return plan
+}
+
+// Diff lista os campos que mudam de have para want.
+func Diff(have, want *Query) map[string]FieldChange {
+	fields := make(map[string]FieldChange)
+
+	compare := func(name string, from, to interface{}) {
+		if canonical(from) != canonical(to) {
+			fields[name] = FieldChange{From: from, To: to}
+		}
+	}
+
+	compare("name", have.Name, want.Name)
+	compare("description", have.Description, want.Description)
+	compare("datasource", have.Datasource, want.Datasource)
+	compare("active", *have.Active, *want.Active)
+	compare("cache_ttl", *have.CacheTTL, *want.CacheTTL)
+	compare("timeout_seconds", *have.TimeoutSeconds, *want.TimeoutSeconds)
+	compare("max_concurrency", have.MaxConcurrency, want.MaxConcurrency)
+	compare("tags", have.Tags, want.Tags)
+	compare("allowed_roles", have.AllowedRoles, want.AllowedRoles)
+	compare("column_policies", have.ColumnPolicies, want.ColumnPolicies)
+	compare("quota", have.Quota, want.Quota)
+	compare("sql", have.SQL, want.SQL)
+	compare("parameters", have.Parameters, want.Parameters)
+
+	return fields
+}
+
+// canonical compara pelo JSON, que ordena as chaves dos maps de validations.
+func canonical(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
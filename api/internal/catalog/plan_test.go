@@ -0,0 +1,161 @@
+package catalog
+
+import (
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+const catalogYAML = `
+version: 1
+queries:
+  - slug: vendas-por-dia
+    name: Vendas por dia
+    datasource: erp
+    sql: |
+      SELECT dia, total FROM vendas WHERE dia >= :inicio
+    parameters:
+      - name: inicio
+        type: date
+        required: true
+        position: 1
+  - slug: clientes
+    name: Clientes ativos
+    datasource: erp
+    cache_ttl: 60
+    sql: SELECT id, nome FROM clientes
+  - slug: estoque
+    name: Estoque
+    datasource: erp
+    sql: SELECT * FROM estoque
+`
+
+func strPtr(s string) *string {
+	return &s
+}
+
+// currentQueries monta o que esta no banco: vendas-por-dia igual ao arquivo,
+// clientes com outro cache_ttl e uma query que nao esta no catalogo.
+func currentQueries() []models.Query {
+	return []models.Query{
+		{
+			Slug:           "vendas-por-dia",
+			Name:           "Vendas por dia",
+			DatasourceSlug: strPtr("erp"),
+			SQLQuery:       "SELECT dia, total FROM vendas WHERE dia >= :inicio\n",
+			CacheTTL:       300,
+			TimeoutSeconds: 30,
+			IsActive:       true,
+			Parameters: []models.QueryParameter{
+				{Name: "inicio", ParamType: "date", IsRequired: true, Position: 1, Validations: strPtr("[]")},
+			},
+		},
+		{
+			Slug:           "clientes",
+			Name:           "Clientes ativos",
+			DatasourceSlug: strPtr("erp"),
+			SQLQuery:       "SELECT id, nome FROM clientes",
+			CacheTTL:       300,
+			TimeoutSeconds: 30,
+			IsActive:       true,
+		},
+		{
+			Slug:           "legado",
+			Name:           "Relatorio legado",
+			DatasourceSlug: strPtr("erp"),
+			SQLQuery:       "SELECT 1",
+			CacheTTL:       300,
+			TimeoutSeconds: 30,
+			IsActive:       true,
+		},
+	}
+}
+
+func TestBuildPlan(t *testing.T) {
+	desired, err := Parse([]byte(catalogYAML))
+	if err != nil {
+		t.Fatalf("Parse() erro = %v", err)
+	}
+
+	plan := BuildPlan(desired, currentQueries(), false)
+
+	want := map[string]Action{
+		"clientes":       ActionUpdate,
+		"estoque":        ActionCreate,
+		"vendas-por-dia": ActionUnchanged,
+	}
+	if len(plan.Changes) != len(want) {
+		t.Fatalf("plano com %d mudancas, esperava %d: %+v", len(plan.Changes), len(want), plan.Changes)
+	}
+	for i, change := range plan.Changes {
+		if i > 0 && plan.Changes[i-1].Slug > change.Slug {
+			t.Fatalf("mudancas fora de ordem: %s antes de %s", plan.Changes[i-1].Slug, change.Slug)
+		}
+		if change.Action != want[change.Slug] {
+			t.Fatalf("%s: acao %s, esperava %s", change.Slug, change.Action, want[change.Slug])
+		}
+	}
+
+	// Campos omitidos no arquivo usam os padroes da tabela e nao aparecem
+	// como alteracao; so o cache_ttl de clientes mudou
+	fields := plan.Changes[0].Fields
+	if len(fields) != 1 {
+		t.Fatalf("campos alterados em clientes = %v, esperava so cache_ttl", fields)
+	}
+	if change := fields["cache_ttl"]; change.From != 300 || change.To != 60 {
+		t.Fatalf("cache_ttl = %+v, esperava 300 -> 60", change)
+	}
+
+	if plan.Summary != (Summary{Create: 1, Update: 1, Unchanged: 1}) {
+		t.Fatalf("resumo = %+v", plan.Summary)
+	}
+	if !plan.HasChanges() {
+		t.Fatal("HasChanges() = false com create e update no plano")
+	}
+}
+
+func TestBuildPlanPrune(t *testing.T) {
+	desired, err := Parse([]byte(catalogYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan := BuildPlan(desired, currentQueries(), true)
+	if plan.Summary.Delete != 1 {
+		t.Fatalf("resumo = %+v, esperava uma remocao", plan.Summary)
+	}
+	for _, change := range plan.Changes {
+		if change.Action == ActionDelete && change.Slug != "legado" {
+			t.Fatalf("remocao de %s, esperava legado", change.Slug)
+		}
+	}
+
+	// Sem prune a query fora do catalogo fica intocada
+	if plan := BuildPlan(desired, currentQueries(), false); plan.Summary.Delete != 0 {
+		t.Fatalf("remocao sem prune: %+v", plan.Summary)
+	}
+}
+
+func TestBuildPlanNothingToDo(t *testing.T) {
+	current := currentQueries()
+	plan := BuildPlan(FromModels(current), current, true)
+
+	if plan.HasChanges() {
+		t.Fatalf("exportar e reaplicar o catalogo gerou mudancas: %+v", plan.Changes)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := map[string]string{
+		"versao desconhecida": "version: 2\nqueries: []\n",
+		"campo desconhecido":  "version: 1\nqueries:\n  - slug: a\n    sqll: SELECT 1\n",
+		"slug repetido":       "version: 1\nqueries:\n  - slug: a\n  - slug: a\n",
+		"sem slug":            "version: 1\nqueries:\n  - name: a\n",
+	}
+
+	for name, data := range tests {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse() deveria falhar", name)
+		}
+	}
+}
@@ -6,35 +6,156 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"errors"
+	"fmt"
 	"os"
+	"regexp"
+	"strings"
 )
 
-var encryptionKey []byte
+// Formato versionado: v1:<id da chave>:<base64(nonce + ciphertext + tag)>.
+// Textos sem o prefixo sao do formato antigo, sem id, e sao testados com todas
+// as chaves do keyring.
+const formatVersion = "v1"
 
+// legacyKeyID e o id dado a QUERYBASE_ENCRYPTION_KEY, a chave unica usada antes
+// do keyring.
+const legacyKeyID = "default"
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+var (
+	ErrNotInitialized = errors.New("chave de criptografia nao inicializada")
+	ErrUnknownKey     = errors.New("chave de criptografia desconhecida")
+	ErrDecrypt        = errors.New("falha ao descriptografar: chave incorreta ou dados corrompidos")
+)
+
+type key struct {
+	id    string
+	bytes []byte
+}
+
+// keyring guarda as chaves conhecidas; a primeira e a ativa, usada para
+// criptografar.
+var keyring []key
+
+// Init carrega o keyring de QUERYBASE_ENCRYPTION_KEYS ("id:base64,id:base64",
+// a primeira e a ativa). QUERYBASE_ENCRYPTION_KEY continua aceita: sozinha vira
+// a chave ativa com id "default"; junto com o keyring, entra no fim para
+// descriptografar senhas antigas.
 func Init() error {
-	keyStr := os.Getenv("QUERYBASE_ENCRYPTION_KEY")
-	if keyStr == "" {
-		return errors.New("QUERYBASE_ENCRYPTION_KEY nao definida")
+	var ring []key
+
+	if keysStr := strings.TrimSpace(os.Getenv("QUERYBASE_ENCRYPTION_KEYS")); keysStr != "" {
+		for _, entry := range strings.Split(keysStr, ",") {
+			id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+			if !found {
+				return fmt.Errorf("QUERYBASE_ENCRYPTION_KEYS invalida: use id:base64 (entrada '%s')", entry)
+			}
+			k, err := parseKey(id, encoded)
+			if err != nil {
+				return fmt.Errorf("QUERYBASE_ENCRYPTION_KEYS invalida: %w", err)
+			}
+			ring = append(ring, k)
+		}
 	}
 
-	key, err := base64.StdEncoding.DecodeString(keyStr)
-	if err != nil {
-		return errors.New("QUERYBASE_ENCRYPTION_KEY invalida: deve ser base64")
+	if keyStr := os.Getenv("QUERYBASE_ENCRYPTION_KEY"); keyStr != "" {
+		k, err := parseKey(legacyKeyID, keyStr)
+		if err != nil {
+			return fmt.Errorf("QUERYBASE_ENCRYPTION_KEY invalida: %w", err)
+		}
+		ring = append(ring, k)
 	}
 
-	if len(key) != 32 {
-		return errors.New("QUERYBASE_ENCRYPTION_KEY deve ter 32 bytes (256 bits)")
+	if len(ring) == 0 {
+		return errors.New("QUERYBASE_ENCRYPTION_KEYS ou QUERYBASE_ENCRYPTION_KEY nao definida")
 	}
 
-	encryptionKey = key
+	seen := make(map[string]bool, len(ring))
+	for _, k := range ring {
+		if seen[k.id] {
+			return fmt.Errorf("id de chave '%s' repetido no keyring", k.id)
+		}
+		seen[k.id] = true
+	}
+
+	keyring = ring
 	return nil
 }
 
-func Decrypt(encryptedBase64 string) (string, error) {
-	if len(encryptionKey) == 0 {
-		return "", errors.New("chave de criptografia nao inicializada")
+func parseKey(id, encoded string) (key, error) {
+	if !keyIDPattern.MatchString(id) {
+		return key{}, fmt.Errorf("id de chave '%s' invalido: use letras, numeros, '-' e '_' (ate 32)", id)
+	}
+
+	bytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return key{}, fmt.Errorf("chave '%s' deve ser base64", id)
+	}
+	if len(bytes) != 32 {
+		return key{}, fmt.Errorf("chave '%s' deve ter 32 bytes (256 bits)", id)
+	}
+
+	return key{id: id, bytes: bytes}, nil
+}
+
+// ActiveKeyID devolve o id da chave usada para criptografar.
+func ActiveKeyID() string {
+	if len(keyring) == 0 {
+		return ""
+	}
+	return keyring[0].id
+}
+
+// KeyID devolve o id da chave de um texto criptografado, ou "" no formato
+// antigo.
+func KeyID(encrypted string) string {
+	if id, _, ok := splitVersioned(encrypted); ok {
+		return id
+	}
+	return ""
+}
+
+// NeedsRotation diz se o texto nao foi criptografado com a chave ativa.
+func NeedsRotation(encrypted string) bool {
+	return KeyID(encrypted) != ActiveKeyID()
+}
+
+func splitVersioned(encrypted string) (id, payload string, ok bool) {
+	parts := strings.SplitN(encrypted, ":", 3)
+	if len(parts) != 3 || parts[0] != formatVersion {
+		return "", "", false
 	}
+	return parts[1], parts[2], true
+}
+
+func Decrypt(encrypted string) (string, error) {
+	if len(keyring) == 0 {
+		return "", ErrNotInitialized
+	}
+
+	if id, payload, ok := splitVersioned(encrypted); ok {
+		for _, k := range keyring {
+			if k.id == id {
+				return open(k.bytes, payload)
+			}
+		}
+		return "", fmt.Errorf("%w: '%s' nao esta no keyring", ErrUnknownKey, id)
+	}
+
+	// Formato antigo: sem id, vale qualquer chave conhecida
+	var lastErr error
+	for _, k := range keyring {
+		plaintext, err := open(k.bytes, encrypted)
+		if err == nil {
+			return plaintext, nil
+		}
+		lastErr = err
+	}
+	return "", lastErr
+}
 
+func open(keyBytes []byte, encryptedBase64 string) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(encryptedBase64)
 	if err != nil {
 		return "", errors.New("dados criptografados invalidos")
@@ -48,7 +169,7 @@ func Decrypt(encryptedBase64 string) (string, error) {
 	tag := data[len(data)-16:]
 	ciphertext := data[12 : len(data)-16]
 
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(keyBytes)
 	if err != nil {
 		return "", err
 	}
@@ -61,18 +182,20 @@ func Decrypt(encryptedBase64 string) (string, error) {
 	combined := append(ciphertext, tag...)
 	plaintext, err := gcm.Open(nil, nonce, combined, nil)
 	if err != nil {
-		return "", errors.New("falha ao descriptografar: chave incorreta ou dados corrompidos")
+		return "", ErrDecrypt
 	}
 
 	return string(plaintext), nil
 }
 
+// Encrypt criptografa com a chave ativa, no formato versionado.
 func Encrypt(plaintext string) (string, error) {
-	if len(encryptionKey) == 0 {
-		return "", errors.New("chave de criptografia nao inicializada")
+	if len(keyring) == 0 {
+		return "", ErrNotInitialized
 	}
+	active := keyring[0]
 
-	block, err := aes.NewCipher(encryptionKey)
+	block, err := aes.NewCipher(active.bytes)
 	if err != nil {
 		return "", err
 	}
@@ -89,5 +212,5 @@ func Encrypt(plaintext string) (string, error) {
 
 	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return formatVersion + ":" + active.id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
 }
@@ -0,0 +1,174 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testKey(fill byte) string {
+	return base64.StdEncoding.EncodeToString([]byte(strings.Repeat(string(rune(fill)), 32)))
+}
+
+// legacyEncrypt gera o formato antigo (base64 sem prefixo nem id), como o
+// Laravel gravava antes do keyring.
+func legacyEncrypt(t *testing.T, encodedKey, plaintext string) string {
+	t.Helper()
+	keyBytes, _ := base64.StdEncoding.DecodeString(encodedKey)
+	block, err := aes.NewCipher(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(plaintext), nil))
+}
+
+func TestInit(t *testing.T) {
+	tests := []struct {
+		name       string
+		keys       string
+		legacy     string
+		wantErr    bool
+		wantActive string
+	}{
+		{"keyring", "k2:" + testKey('b') + ",k1:" + testKey('a'), "", false, "k2"},
+		{"so a chave antiga", "", testKey('a'), false, legacyKeyID},
+		{"keyring com a chave antiga no fim", "k2:" + testKey('b'), testKey('a'), false, "k2"},
+		{"nenhuma chave", "", "", true, ""},
+		{"entrada sem id", testKey('a'), "", true, ""},
+		{"id invalido", "k 1:" + testKey('a'), "", true, ""},
+		{"chave curta", "k1:" + base64.StdEncoding.EncodeToString([]byte("curta")), "", true, ""},
+		{"chave fora de base64", "k1:nao-e-base64!", "", true, ""},
+		{"id repetido", "k1:" + testKey('a') + ",k1:" + testKey('b'), "", true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("QUERYBASE_ENCRYPTION_KEYS", tt.keys)
+			t.Setenv("QUERYBASE_ENCRYPTION_KEY", tt.legacy)
+			keyring = nil
+
+			err := Init()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Init() erro = %v, esperava erro = %v", err, tt.wantErr)
+			}
+			if err == nil && ActiveKeyID() != tt.wantActive {
+				t.Fatalf("ActiveKeyID() = %s, esperava %s", ActiveKeyID(), tt.wantActive)
+			}
+		})
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	t.Setenv("QUERYBASE_ENCRYPTION_KEYS", "k1:"+testKey('a'))
+	t.Setenv("QUERYBASE_ENCRYPTION_KEY", "")
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	encryptedK1, err := Encrypt("senha-k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// k2 passa a ser a ativa; k1 continua no keyring para descriptografar
+	t.Setenv("QUERYBASE_ENCRYPTION_KEYS", "k2:"+testKey('b')+",k1:"+testKey('a'))
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+	encryptedK2, err := Encrypt("senha-k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		encrypted string
+		want      string
+		wantErr   error
+	}{
+		{"formato versionado com a chave ativa", encryptedK2, "senha-k2", nil},
+		{"formato versionado com chave antiga", encryptedK1, "senha-k1", nil},
+		{"formato antigo testa todas as chaves", legacyEncrypt(t, testKey('a'), "senha-legada"), "senha-legada", nil},
+		{"formato antigo com chave fora do keyring", legacyEncrypt(t, testKey('c'), "x"), "", ErrDecrypt},
+		{"id de chave desconhecido", "v1:k9:" + strings.SplitN(encryptedK2, ":", 3)[2], "", ErrUnknownKey},
+		{"id trocado", "v1:k1:" + strings.SplitN(encryptedK2, ":", 3)[2], "", ErrDecrypt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decrypt(tt.encrypted)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Decrypt() erro = %v, esperava %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Decrypt() erro = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Decrypt() = %q, esperava %q", got, tt.want)
+			}
+		})
+	}
+
+	for _, malformed := range []string{"nao-e-base64!", base64.StdEncoding.EncodeToString([]byte("curto"))} {
+		if _, err := Decrypt(malformed); err == nil {
+			t.Fatalf("Decrypt(%q) deveria falhar", malformed)
+		}
+	}
+}
+
+func TestNeedsRotation(t *testing.T) {
+	t.Setenv("QUERYBASE_ENCRYPTION_KEYS", "k2:"+testKey('b')+",k1:"+testKey('a'))
+	t.Setenv("QUERYBASE_ENCRYPTION_KEY", "")
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := Encrypt("senha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(active, "v1:k2:") {
+		t.Fatalf("Encrypt() = %s, esperava o prefixo v1:k2:", active)
+	}
+
+	tests := []struct {
+		name      string
+		encrypted string
+		want      bool
+	}{
+		{"chave ativa", active, false},
+		{"chave antiga", "v1:k1:" + strings.SplitN(active, ":", 3)[2], true},
+		{"formato antigo", legacyEncrypt(t, testKey('a'), "senha"), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NeedsRotation(tt.encrypted); got != tt.want {
+				t.Fatalf("NeedsRotation() = %v, esperava %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	saved := keyring
+	keyring = nil
+	defer func() { keyring = saved }()
+
+	if _, err := Encrypt("x"); !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("Encrypt() erro = %v, esperava ErrNotInitialized", err)
+	}
+	if _, err := Decrypt("x"); !errors.Is(err, ErrNotInitialized) {
+		t.Fatalf("Decrypt() erro = %v, esperava ErrNotInitialized", err)
+	}
+}
@@ -0,0 +1,54 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// APIKeyPrefix identifica as chaves emitidas pela API: qb_<prefixo>_<segredo>.
+const APIKeyPrefix = "qb"
+
+// GenerateAPIKey cria uma nova chave e devolve o texto puro (mostrado uma
+// unica vez), o prefixo de busca, o salt e o hash do segredo.
+func GenerateAPIKey() (plain, prefix, salt, hash string, err error) {
+	prefixBytes := make([]byte, 6)
+	secretBytes := make([]byte, 32)
+	saltBytes := make([]byte, 16)
+
+	for _, b := range [][]byte{prefixBytes, secretBytes, saltBytes} {
+		if _, err := rand.Read(b); err != nil {
+			return "", "", "", "", err
+		}
+	}
+
+	prefix = hex.EncodeToString(prefixBytes)
+	secret := hex.EncodeToString(secretBytes)
+	salt = hex.EncodeToString(saltBytes)
+
+	plain = APIKeyPrefix + "_" + prefix + "_" + secret
+	return plain, prefix, salt, HashAPIKeySecret(secret, salt), nil
+}
+
+// ParseAPIKey separa o prefixo e o segredo de uma chave emitida pela API.
+func ParseAPIKey(plain string) (prefix, secret string, err error) {
+	parts := strings.Split(plain, "_")
+	if len(parts) != 3 || parts[0] != APIKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", errors.New("formato de API key invalido")
+	}
+	return parts[1], parts[2], nil
+}
+
+func HashAPIKeySecret(secret, salt string) string {
+	sum := sha256.Sum256([]byte(salt + secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyAPIKeySecret compara o hash em tempo constante.
+func VerifyAPIKeySecret(secret, salt, hash string) bool {
+	expected := HashAPIKeySecret(secret, salt)
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1
+}
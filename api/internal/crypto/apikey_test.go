@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAPIKey(t *testing.T) {
+	plain, prefix, salt, hash, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(plain, APIKeyPrefix+"_"+prefix+"_") {
+		t.Fatalf("chave %q nao comeca com o prefixo %q", plain, prefix)
+	}
+	if strings.Contains(hash, plain) || salt == "" {
+		t.Fatal("hash ou salt invalidos")
+	}
+
+	gotPrefix, secret, err := ParseAPIKey(plain)
+	if err != nil {
+		t.Fatalf("ParseAPIKey() da chave gerada = %v", err)
+	}
+	if gotPrefix != prefix {
+		t.Fatalf("prefixo = %q, esperava %q", gotPrefix, prefix)
+	}
+	if !VerifyAPIKeySecret(secret, salt, hash) {
+		t.Fatal("segredo da chave gerada nao confere com o hash")
+	}
+
+	// Mesmo segredo com outro salt gera outro hash
+	if HashAPIKeySecret(secret, salt+"0") == hash {
+		t.Fatal("salt nao entrou no hash")
+	}
+	if VerifyAPIKeySecret(secret+"0", salt, hash) {
+		t.Fatal("segredo alterado foi aceito")
+	}
+
+	other, otherPrefix, _, _, _ := GenerateAPIKey()
+	if other == plain || otherPrefix == prefix {
+		t.Fatal("duas chaves geradas iguais")
+	}
+}
+
+func TestParseAPIKeyRejects(t *testing.T) {
+	for _, plain := range []string{
+		"",
+		"qb_abc",
+		"qb__segredo",
+		"qb_abc_",
+		"xx_abc_segredo",
+		"qb_abc_seg_redo",
+	} {
+		if _, _, err := ParseAPIKey(plain); err == nil {
+			t.Errorf("ParseAPIKey(%q) deveria falhar", plain)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+type BreakerStatus struct {
+	State               BreakerState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	OpenedAt            *time.Time   `json:"opened_at,omitempty"`
+	RetryAfterSeconds   int          `json:"retry_after_seconds,omitempty"`
+	LastError           string       `json:"last_error,omitempty"`
+}
+
+// CircuitOpenError e devolvido quando o breaker do datasource esta aberto
+// e a execucao foi recusada sem tentar conectar no banco.
+type CircuitOpenError struct {
+	Datasource string
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("datasource '%s' indisponivel (circuit breaker aberto), tente novamente em %ds",
+		e.Datasource, e.RetryAfterSeconds())
+}
+
+func (e *CircuitOpenError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// CircuitBreaker abre apos failureThreshold falhas de conexao seguidas.
+// Depois de openTimeout passa para half-open e deixa ate halfOpenProbes
+// execucoes passarem como sondagem: sucesso fecha o breaker, falha reabre.
+type CircuitBreaker struct {
+	name             string
+	driver           string
+	failureThreshold int
+	openTimeout      time.Duration
+	halfOpenProbes   int
+
+	mu                  sync.Mutex
+	state               BreakerState
+	consecutiveFailures int
+	openedAt            time.Time
+	probesInFlight      int
+	lastError           string
+}
+
+func NewCircuitBreaker(name string, failureThreshold int, openTimeout time.Duration, halfOpenProbes int) *CircuitBreaker {
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+		halfOpenProbes:   halfOpenProbes,
+		state:            BreakerClosed,
+	}
+}
+
+// Allow decide se a execucao pode seguir. Quando devolve nil, o chamador
+// deve obrigatoriamente chamar Record com o resultado.
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		elapsed := time.Since(b.openedAt)
+		if elapsed < b.openTimeout {
+			return &CircuitOpenError{Datasource: b.name, RetryAfter: b.openTimeout - elapsed}
+		}
+		b.state = BreakerHalfOpen
+		b.probesInFlight = 0
+		fmt.Printf("[CircuitBreaker] %s em half-open, enviando sondagem\n", b.name)
+		fallthrough
+
+	case BreakerHalfOpen:
+		if b.probesInFlight >= b.halfOpenProbes {
+			return &CircuitOpenError{Datasource: b.name, RetryAfter: time.Second}
+		}
+		b.probesInFlight++
+	}
+
+	return nil
+}
+
+func (b *CircuitBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbe := b.state == BreakerHalfOpen
+	if wasProbe && b.probesInFlight > 0 {
+		b.probesInFlight--
+	}
+
+	if err != nil && (errors.Is(err, context.Canceled) || isQueryTimeout(err)) {
+		// O cliente desistiu ou a query estourou o proprio timeout; nenhum dos
+		// dois diz algo sobre a saude do datasource.
+		return
+	}
+
+	if err == nil || !isBreakerFailure(err) {
+		if b.state != BreakerClosed {
+			fmt.Printf("[CircuitBreaker] %s fechado\n", b.name)
+		}
+		b.state = BreakerClosed
+		b.consecutiveFailures = 0
+		return
+	}
+
+	b.consecutiveFailures++
+	b.lastError = err.Error()
+
+	if wasProbe || b.consecutiveFailures >= b.failureThreshold {
+		if b.state != BreakerOpen {
+			fmt.Printf("[CircuitBreaker] %s aberto apos %d falhas: %v\n", b.name, b.consecutiveFailures, err)
+		}
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.consecutiveFailures,
+		LastError:           b.lastError,
+	}
+
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	if b.state == BreakerOpen {
+		if remaining := b.openTimeout - time.Since(b.openedAt); remaining > 0 {
+			status.RetryAfterSeconds = int(math.Ceil(remaining.Seconds()))
+		}
+	}
+
+	return status
+}
+
+// isBreakerFailure separa falhas de disponibilidade (conexao) de erros da
+// propria query, que mostram que o banco esta respondendo. Timeouts de
+// statement ficam de fora: uma query lenta nao derruba as outras do datasource.
+func isBreakerFailure(err error) bool {
+	var connErr *ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+
+	return isTransientError(err)
+}
+
+func isQueryTimeout(err error) bool {
+	var timeoutErr *StatementTimeoutError
+	return errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var errConnect = &ConnectError{Err: errors.New("connection refused")}
+
+func expectState(t *testing.T, b *CircuitBreaker, want BreakerState) {
+	t.Helper()
+	if got := b.Status().State; got != want {
+		t.Fatalf("estado = %s, esperava %s", got, want)
+	}
+}
+
+func expectOpen(t *testing.T, b *CircuitBreaker) {
+	t.Helper()
+	var openErr *CircuitOpenError
+	if err := b.Allow(); !errors.As(err, &openErr) {
+		t.Fatalf("Allow() = %v, esperava CircuitOpenError", err)
+	}
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := NewCircuitBreaker("vendas", 3, time.Minute, 1)
+
+	for i := 0; i < 2; i++ {
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() antes do limite = %v", err)
+		}
+		b.Record(errConnect)
+	}
+	expectState(t, b, BreakerClosed)
+
+	b.Allow()
+	b.Record(errConnect)
+	expectState(t, b, BreakerOpen)
+	expectOpen(t, b)
+
+	status := b.Status()
+	if status.ConsecutiveFailures != 3 || status.LastError != "connection refused" {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.RetryAfterSeconds != 60 {
+		t.Fatalf("RetryAfterSeconds = %d, esperava 60", status.RetryAfterSeconds)
+	}
+}
+
+func TestBreakerIgnoresQueryErrors(t *testing.T) {
+	b := NewCircuitBreaker("vendas", 2, time.Minute, 1)
+
+	b.Allow()
+	b.Record(errConnect)
+
+	// Erro de SQL mostra que o banco respondeu e zera a contagem
+	b.Allow()
+	b.Record(fmt.Errorf("erro ao executar query: %w", errors.New(`relation "x" does not exist`)))
+
+	b.Allow()
+	b.Record(errConnect)
+	expectState(t, b, BreakerClosed)
+
+	// Cliente que desiste nao conta nem zera
+	b.Allow()
+	b.Record(context.Canceled)
+	b.Allow()
+	b.Record(errConnect)
+	expectState(t, b, BreakerOpen)
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	const openTimeout = 20 * time.Millisecond
+
+	open := func() *CircuitBreaker {
+		b := NewCircuitBreaker("vendas", 1, openTimeout, 1)
+		b.Allow()
+		b.Record(errConnect)
+		expectState(t, b, BreakerOpen)
+		time.Sleep(openTimeout + 5*time.Millisecond)
+		return b
+	}
+
+	t.Run("sondagem com sucesso fecha", func(t *testing.T) {
+		b := open()
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() depois do openTimeout = %v", err)
+		}
+		expectState(t, b, BreakerHalfOpen)
+
+		// Uma sondagem por vez
+		expectOpen(t, b)
+
+		b.Record(nil)
+		expectState(t, b, BreakerClosed)
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() depois de fechar = %v", err)
+		}
+	})
+
+	t.Run("sondagem com falha reabre", func(t *testing.T) {
+		b := open()
+		b.Allow()
+		b.Record(errConnect)
+		expectState(t, b, BreakerOpen)
+		expectOpen(t, b)
+	})
+
+	t.Run("sondagem cancelada libera a vaga", func(t *testing.T) {
+		b := open()
+		b.Allow()
+		b.Record(context.Canceled)
+		expectState(t, b, BreakerHalfOpen)
+		if err := b.Allow(); err != nil {
+			t.Fatalf("Allow() depois de sondagem cancelada = %v", err)
+		}
+	})
+}
+
+func TestBreakerIgnoresTimeouts(t *testing.T) {
+	b := NewCircuitBreaker("vendas", 1, time.Minute, 1)
+
+	timeouts := []error{
+		&StatementTimeoutError{Timeout: 30 * time.Second, CancelledOnServer: true, Err: errors.New("canceling statement due to statement timeout")},
+		fmt.Errorf("erro ao executar query: %w", context.DeadlineExceeded),
+	}
+	for _, err := range timeouts {
+		b.Allow()
+		b.Record(err)
+		expectState(t, b, BreakerClosed)
+	}
+
+	if failures := b.Status().ConsecutiveFailures; failures != 0 {
+		t.Fatalf("ConsecutiveFailures = %d depois de timeouts", failures)
+	}
+}
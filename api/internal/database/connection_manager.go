@@ -3,10 +3,13 @@ package database
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/adolp26/querybase/internal/models"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
 	_ "github.com/sijms/go-ora/v2"
@@ -23,11 +26,57 @@ type DatasourceConfig struct {
 	Password     string `json:"password"`
 	MaxOpenConns int    `json:"max_open_conns"`
 	MaxIdleConns int    `json:"max_idle_conns"`
+
+	MaxConcurrentQueries int `json:"max_concurrent_queries"`
+	MaxQueuedQueries     int `json:"max_queued_queries"`
+
+	Endpoints []Endpoint `json:"endpoints,omitempty"`
+
+	// AllowWrites libera comandos de escrita para endpoints confiaveis.
+	// Sem ele toda execucao roda em uma transacao somente leitura.
+	AllowWrites bool `json:"allow_writes"`
+
+	// Tempo de vida e tempo ocioso maximo de cada conexao; 0 usa o padrao.
+	ConnMaxLifetimeSeconds int `json:"conn_max_lifetime_seconds"`
+	ConnMaxIdleTimeSeconds int `json:"conn_max_idle_time_seconds"`
+
+	// AllowedRoles e a ACL do datasource; vazia libera para qualquer chamador.
+	AllowedRoles []string `json:"allowed_roles"`
+
+	// PasswordRef aponta para o segredo com a senha (env://, file://, vault://);
+	// quando preenchido, Password chega ja resolvida pelo repositorio.
+	PasswordRef string `json:"password_ref,omitempty"`
+}
+
+// QueryOptions carrega limites da query sendo executada. MaxConcurrency <= 0
+// deixa a query limitada apenas pelo datasource.
+type QueryOptions struct {
+	QueryKey       string
+	MaxConcurrency int
 }
 
 type ConnectionManager struct {
-	connections map[string]*sql.DB
+	connections map[string]*managedPool
+	breakers    map[string]*CircuitBreaker
+	limiters    map[string]*ConcurrencyLimiter
+	unreachable map[string]time.Time
 	mu          sync.RWMutex
+
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	downAfterFailures   int
+
+	breakerFailureThreshold int
+	breakerOpenTimeout      time.Duration
+	breakerHalfOpenProbes   int
+
+	maxQueuedQueries int
+	queueTimeout     time.Duration
+
+	idlePoolTimeout time.Duration
+	janitorInterval time.Duration
+	stop            chan struct{}
+	stopOnce        sync.Once
 }
 
 type ConnectionTestResult struct {
@@ -37,28 +86,97 @@ type ConnectionTestResult struct {
 	ServerVersion string `json:"server_version,omitempty"`
 }
 
-func NewConnectionManager() *ConnectionManager {
+func NewConnectionManager(cfg models.PoolConfig) *ConnectionManager {
+	interval := cfg.HealthCheckInterval
+	if interval <= 0 {
+		interval = 30
+	}
+	timeout := cfg.HealthCheckTimeout
+	if timeout <= 0 {
+		timeout = 5
+	}
+	downAfter := cfg.DownAfterFailures
+	if downAfter <= 0 {
+		downAfter = 3
+	}
+	breakerThreshold := cfg.BreakerFailureThreshold
+	if breakerThreshold <= 0 {
+		breakerThreshold = 5
+	}
+	breakerOpenTimeout := cfg.BreakerOpenTimeout
+	if breakerOpenTimeout <= 0 {
+		breakerOpenTimeout = 30
+	}
+	halfOpenProbes := cfg.BreakerHalfOpenProbes
+	if halfOpenProbes <= 0 {
+		halfOpenProbes = 1
+	}
+	maxQueued := cfg.MaxQueuedQueries
+	if maxQueued <= 0 {
+		maxQueued = 50
+	}
+	queueTimeout := cfg.QueueTimeout
+	if queueTimeout <= 0 {
+		queueTimeout = 10
+	}
+	idlePoolTimeout := cfg.IdlePoolTimeout
+	if idlePoolTimeout <= 0 {
+		idlePoolTimeout = 600
+	}
+	janitorInterval := cfg.JanitorInterval
+	if janitorInterval <= 0 {
+		janitorInterval = 60
+	}
+
 	return &ConnectionManager{
-		connections: make(map[string]*sql.DB),
+		connections:             make(map[string]*managedPool),
+		breakers:                make(map[string]*CircuitBreaker),
+		limiters:                make(map[string]*ConcurrencyLimiter),
+		unreachable:             make(map[string]time.Time),
+		healthCheckInterval:     time.Duration(interval) * time.Second,
+		healthCheckTimeout:      time.Duration(timeout) * time.Second,
+		downAfterFailures:       downAfter,
+		breakerFailureThreshold: breakerThreshold,
+		breakerOpenTimeout:      time.Duration(breakerOpenTimeout) * time.Second,
+		breakerHalfOpenProbes:   halfOpenProbes,
+		maxQueuedQueries:        maxQueued,
+		queueTimeout:            time.Duration(queueTimeout) * time.Second,
+		idlePoolTimeout:         time.Duration(idlePoolTimeout) * time.Second,
+		janitorInterval:         time.Duration(janitorInterval) * time.Second,
+		stop:                    make(chan struct{}),
 	}
 }
 
-func (cm *ConnectionManager) GetConnection(ctx context.Context, config DatasourceConfig) (*sql.DB, error) {
+// acquirePool devolve o pool atual do endpoint ja marcado como em uso.
+// O chamador deve liberar o pool com release() ao terminar.
+func (cm *ConnectionManager) acquirePool(ctx context.Context, config DatasourceConfig, endpoint Endpoint) (*managedPool, error) {
+	key := poolKey(config.ID, endpoint.Name)
+	epConfig := config.forEndpoint(endpoint)
+	fingerprint := epConfig.Fingerprint()
+
 	cm.mu.RLock()
-	if conn, exists := cm.connections[config.ID]; exists {
+	pool, exists := cm.connections[key]
+	if exists && pool.fingerprint == fingerprint {
+		pool.acquire()
 		cm.mu.RUnlock()
-		if err := conn.PingContext(ctx); err == nil {
-			return conn, nil
+		return pool, nil
+	}
+	cm.mu.RUnlock()
+
+	pool, err := cm.createConnection(ctx, key, epConfig, endpoint, fingerprint)
+	if err != nil {
+		var connErr *ConnectError
+		if errors.As(err, &connErr) {
+			cm.markUnreachable(key)
 		}
-		cm.closeConnection(config.ID)
-	} else {
-		cm.mu.RUnlock()
+		return nil, err
 	}
+	cm.clearUnreachable(key)
 
-	return cm.createConnection(ctx, config)
+	return pool, nil
 }
 
-func (cm *ConnectionManager) createConnection(ctx context.Context, config DatasourceConfig) (*sql.DB, error) {
+func (cm *ConnectionManager) createConnection(ctx context.Context, key string, config DatasourceConfig, endpoint Endpoint, fingerprint string) (*managedPool, error) {
 	connString, driverName, err := cm.buildConnectionString(config)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao montar connection string: %w", err)
@@ -80,21 +198,50 @@ func (cm *ConnectionManager) createConnection(ctx context.Context, config Dataso
 
 	db.SetMaxOpenConns(maxOpen)
 	db.SetMaxIdleConns(maxIdle)
-	db.SetConnMaxLifetime(5 * time.Minute)
-	db.SetConnMaxIdleTime(2 * time.Minute)
+	maxLifetime := config.ConnMaxLifetimeSeconds
+	if maxLifetime <= 0 {
+		maxLifetime = 300
+	}
+	maxIdleTime := config.ConnMaxIdleTimeSeconds
+	if maxIdleTime <= 0 {
+		maxIdleTime = 120
+	}
+
+	db.SetConnMaxLifetime(time.Duration(maxLifetime) * time.Second)
+	db.SetConnMaxIdleTime(time.Duration(maxIdleTime) * time.Second)
 
 	if err := db.PingContext(ctx); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("erro ao conectar em %s://%s:%d: %w", config.Driver, config.Host, config.Port, err)
+		return nil, &ConnectError{
+			Err: fmt.Errorf("erro ao conectar em %s://%s:%d: %w", config.Driver, config.Host, config.Port, err),
+		}
 	}
 
+	pool := newManagedPool(db, fingerprint, config, endpoint)
+
 	cm.mu.Lock()
-	cm.connections[config.ID] = db
+	current, exists := cm.connections[key]
+	if exists && current.fingerprint == fingerprint {
+		// Outra requisicao criou o mesmo pool primeiro; descarta o nosso.
+		current.acquire()
+		cm.mu.Unlock()
+		pool.close()
+		return current, nil
+	}
+	pool.acquire()
+	cm.connections[key] = pool
 	cm.mu.Unlock()
 
-	fmt.Printf("[ConnectionManager] Nova conexao criada: %s (%s)\n", config.Slug, config.Driver)
+	go pool.healthCheck(cm.healthCheckInterval, cm.healthCheckTimeout, cm.downAfterFailures)
+
+	if exists {
+		fmt.Printf("[ConnectionManager] Configuracao alterada: %s/%s (%s), substituindo pool\n", config.Slug, endpoint.Name, config.Driver)
+		go current.drain(config.Slug + "/" + endpoint.Name)
+	} else {
+		fmt.Printf("[ConnectionManager] Nova conexao criada: %s/%s (%s)\n", config.Slug, endpoint.Name, config.Driver)
+	}
 
-	return db, nil
+	return pool, nil
 }
 
 func (cm *ConnectionManager) buildConnectionString(config DatasourceConfig) (string, string, error) {
@@ -193,35 +340,330 @@ func (cm *ConnectionManager) getServerVersion(ctx context.Context, db *sql.DB, d
 	return version
 }
 
-func (cm *ConnectionManager) closeConnection(datasourceID string) {
+// closeConnection remove o pool do mapa somente se ele ainda for o pool
+// atual do endpoint, e o fecha depois que as execucoes em andamento terminarem.
+func (cm *ConnectionManager) closeConnection(key string, pool *managedPool) {
 	cm.mu.Lock()
-	defer cm.mu.Unlock()
-
-	if conn, exists := cm.connections[datasourceID]; exists {
-		conn.Close()
-		delete(cm.connections, datasourceID)
-		fmt.Printf("[ConnectionManager] Conexao fechada: %s\n", datasourceID)
+	current, exists := cm.connections[key]
+	if !exists || current != pool {
+		cm.mu.Unlock()
+		return
 	}
+	delete(cm.connections, key)
+	cm.mu.Unlock()
+
+	fmt.Printf("[ConnectionManager] Conexao fechada: %s\n", key)
+	go pool.drain(key)
 }
 
 func (cm *ConnectionManager) CloseAll() {
+	cm.stopOnce.Do(func() { close(cm.stop) })
+
 	cm.mu.Lock()
 	defer cm.mu.Unlock()
 
-	for id, conn := range cm.connections {
-		conn.Close()
+	for id, pool := range cm.connections {
+		pool.close()
 		fmt.Printf("[ConnectionManager] Conexao fechada: %s\n", id)
 	}
 
-	cm.connections = make(map[string]*sql.DB)
+	cm.connections = make(map[string]*managedPool)
+}
+
+// Status devolve o estado de saude e do circuit breaker de cada datasource
+// conhecido, inclusive os que nunca conseguiram abrir um pool.
+func (cm *ConnectionManager) Status() []PoolStatus {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	statuses := make([]PoolStatus, 0, len(cm.connections))
+	withPool := make(map[string]bool)
+	for _, pool := range cm.connections {
+		status := pool.status()
+		if breaker, exists := cm.breakers[status.DatasourceID]; exists {
+			breakerStatus := breaker.Status()
+			status.Breaker = &breakerStatus
+		}
+		if limiter, exists := cm.limiters[datasourceLimiterKey(status.DatasourceID)]; exists {
+			limiterStatus := limiter.Status()
+			status.Limiter = &limiterStatus
+		}
+		statuses = append(statuses, status)
+		withPool[status.DatasourceID] = true
+	}
+
+	for id, breaker := range cm.breakers {
+		if withPool[id] {
+			continue
+		}
+		breakerStatus := breaker.Status()
+		statuses = append(statuses, PoolStatus{
+			DatasourceID:        id,
+			Slug:                breaker.name,
+			Driver:              breaker.driver,
+			State:               PoolDown,
+			ConsecutiveFailures: breakerStatus.ConsecutiveFailures,
+			LastError:           breakerStatus.LastError,
+			Breaker:             &breakerStatus,
+		})
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Slug != statuses[j].Slug {
+			return statuses[i].Slug < statuses[j].Slug
+		}
+		return statuses[i].Endpoint < statuses[j].Endpoint
+	})
+
+	return statuses
+}
+
+// PoolStats devolve as estatisticas de cada pool aberto.
+func (cm *ConnectionManager) PoolStats() []PoolStats {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	stats := make([]PoolStats, 0, len(cm.connections))
+	for _, pool := range cm.connections {
+		stats = append(stats, pool.stats())
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Slug != stats[j].Slug {
+			return stats[i].Slug < stats[j].Slug
+		}
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+
+	return stats
+}
+
+func (cm *ConnectionManager) breakerFor(config DatasourceConfig) *CircuitBreaker {
+	cm.mu.RLock()
+	breaker, exists := cm.breakers[config.ID]
+	cm.mu.RUnlock()
+	if exists {
+		return breaker
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if breaker, exists := cm.breakers[config.ID]; exists {
+		return breaker
+	}
+
+	breaker = NewCircuitBreaker(config.Slug, cm.breakerFailureThreshold, cm.breakerOpenTimeout, cm.breakerHalfOpenProbes)
+	breaker.driver = config.Driver
+	cm.breakers[config.ID] = breaker
+
+	return breaker
+}
+
+func (cm *ConnectionManager) limiterFor(key, scope, name string, maxConcurrent, maxQueue int) *ConcurrencyLimiter {
+	cm.mu.RLock()
+	limiter, exists := cm.limiters[key]
+	cm.mu.RUnlock()
+	if exists && limiter.matches(maxConcurrent, maxQueue) {
+		return limiter
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if limiter, exists := cm.limiters[key]; exists && limiter.matches(maxConcurrent, maxQueue) {
+		return limiter
+	}
+
+	// Limites alterados: quem ja tem vaga no limitador antigo a devolve nele.
+	limiter = NewConcurrencyLimiter(scope, name, maxConcurrent, maxQueue, cm.queueTimeout)
+	cm.limiters[key] = limiter
+
+	return limiter
+}
+
+func datasourceLimiterKey(datasourceID string) string {
+	return "datasource:" + datasourceID
+}
+
+// acquireSlots reserva vaga no limitador da query (se houver) e depois no do
+// datasource, devolvendo a funcao que libera as duas.
+func (cm *ConnectionManager) acquireSlots(ctx context.Context, config DatasourceConfig, opts QueryOptions) (func(), error) {
+	var releases []func()
+	releaseAll := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	if opts.MaxConcurrency > 0 && opts.QueryKey != "" {
+		limiter := cm.limiterFor("query:"+opts.QueryKey, "query", opts.QueryKey, opts.MaxConcurrency, cm.maxQueuedQueries)
+		release, err := limiter.Acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, release)
+	}
+
+	maxConcurrent := config.MaxConcurrentQueries
+	if maxConcurrent <= 0 {
+		maxConcurrent = config.MaxOpenConns
+	}
+	if maxConcurrent <= 0 {
+		maxConcurrent = 25
+	}
+	maxQueue := config.MaxQueuedQueries
+	if maxQueue <= 0 {
+		maxQueue = cm.maxQueuedQueries
+	}
+
+	limiter := cm.limiterFor(datasourceLimiterKey(config.ID), "datasource", config.Slug, maxConcurrent, maxQueue)
+	release, err := limiter.Acquire(ctx)
+	if err != nil {
+		releaseAll()
+		return nil, err
+	}
+	releases = append(releases, release)
+
+	return releaseAll, nil
 }
 
 func (cm *ConnectionManager) Query(ctx context.Context, config DatasourceConfig, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
-	db, err := cm.GetConnection(ctx, config)
+	result, err := cm.QueryWithOptions(ctx, config, QueryOptions{}, sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
+	return result.Rows, nil
+}
+
+// QueryWithOptions espera uma vaga nos limitadores de concorrencia e executa
+// a query passando pelo circuit breaker, que recusa a execucao imediatamente
+// com *CircuitOpenError enquanto estiver aberto.
+func (cm *ConnectionManager) QueryWithOptions(ctx context.Context, config DatasourceConfig, opts QueryOptions, sqlQuery string, args ...interface{}) (*QueryResult, error) {
+	release, err := cm.acquireSlots(ctx, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	breaker := cm.breakerFor(config)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	readOnly := !config.AllowWrites || CheckReadOnlySQL(sqlQuery) == nil
+
+	result, err := cm.executeQuery(ctx, config, readOnly, sqlQuery, args...)
+	breaker.Record(err)
+
+	return result, err
+}
+
+// executeQuery tenta os endpoints na ordem de routeEndpoints, passando para o
+// proximo apenas quando o atual esta inacessivel. Escritas vao so para primarios.
+func (cm *ConnectionManager) executeQuery(ctx context.Context, config DatasourceConfig, readOnly bool, sqlQuery string, args ...interface{}) (*QueryResult, error) {
+	var lastErr error
+
+	for _, endpoint := range cm.routeEndpoints(config) {
+		if !readOnly && endpoint.Role != EndpointRolePrimary {
+			continue
+		}
+
+		rows, err := cm.executeOnEndpoint(ctx, config, endpoint, readOnly, sqlQuery, args...)
+		if err == nil {
+			return &QueryResult{Rows: rows, Endpoint: endpoint.Name}, nil
+		}
+
+		if !isFailoverError(err, readOnly) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		fmt.Printf("[ConnectionManager] Endpoint %s/%s indisponivel, tentando o proximo: %v\n", config.Slug, endpoint.Name, err)
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+func (cm *ConnectionManager) executeOnEndpoint(ctx context.Context, config DatasourceConfig, endpoint Endpoint, readOnly bool, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
+	pool, err := cm.acquirePool(ctx, config, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.release()
+
+	run := func() ([]map[string]interface{}, error) {
+		return cm.runStatement(ctx, pool.db, config, readOnly, sqlQuery, args...)
+	}
+
+	defer func() { pool.recordQuery(err) }()
+
+	results, err := run()
+	if err != nil && isRetryable(err, readOnly) && ctx.Err() == nil {
+		pool.markFailure(err, cm.downAfterFailures)
+		fmt.Printf("[ConnectionManager] Erro transitorio em %s/%s, tentando novamente: %v\n", config.Slug, endpoint.Name, err)
+
+		results, err = run()
+		if err == nil {
+			pool.markSuccess()
+		}
+	}
+
+	return results, err
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runStatement executa a query dentro de uma transacao com o timeout nativo
+// do driver. Leituras usam o modo somente leitura de cada banco e sempre
+// terminam em rollback; escritas fazem commit.
+func (cm *ConnectionManager) runStatement(ctx context.Context, db *sql.DB, config DatasourceConfig, readOnly bool, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
+	var txOpts *sql.TxOptions
+	if readOnly && config.Driver == "mysql" {
+		// O go-sql-driver traduz para START TRANSACTION READ ONLY
+		txOpts = &sql.TxOptions{ReadOnly: true}
+	}
+
+	tx, err := db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, &beginError{Err: err}
+	}
+	defer tx.Rollback()
+
+	if readOnly {
+		switch config.Driver {
+		case "postgres", "postgresql", "oracle":
+			if _, err := tx.ExecContext(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+				return nil, fmt.Errorf("erro ao iniciar transacao somente leitura: %w", err)
+			}
+		}
+	}
+
+	sessionID, timeout, sqlQuery, err := cm.applyStatementTimeout(ctx, tx, config.Driver, sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := cm.runQuery(ctx, tx, sqlQuery, args...)
+	if err != nil {
+		if timeout > 0 && isStatementTimeout(ctx, err) {
+			return nil, cm.cancelOnServer(db, config, sessionID, timeout, err)
+		}
+		return nil, err
+	}
+
+	if !readOnly {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("erro ao confirmar transacao: %w", err)
+		}
+	}
+
+	return results, nil
+}
 
+func (cm *ConnectionManager) runQuery(ctx context.Context, db querier, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
 	rows, err := db.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("erro ao executar query: %w", err)
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// isTransientError indica erros de conexao que costumam se resolver em uma
+// nova tentativa, como uma conexao do pool derrubada pelo servidor.
+func isTransientError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && !netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// ConnectError marca falhas ao abrir um pool novo, que sempre contam como
+// indisponibilidade do datasource.
+type ConnectError struct {
+	Err error
+}
+
+func (e *ConnectError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// beginError marca falhas ao abrir a transacao: a query ainda nao tinha sido
+// enviada ao servidor.
+type beginError struct {
+	Err error
+}
+
+func (e *beginError) Error() string {
+	return "erro ao iniciar transacao: " + e.Err.Error()
+}
+
+func (e *beginError) Unwrap() error {
+	return e.Err
+}
+
+// neverSent indica erros que provam que a query nao chegou ao servidor: pool
+// que nao abriu, falha de dial, transacao que nao comecou ou ErrBadConn (que
+// o driver so devolve quando nada foi executado).
+func neverSent(err error) bool {
+	var connErr *ConnectError
+	var beginErr *beginError
+	if errors.As(err, &connErr) || errors.As(err, &beginErr) || errors.Is(err, driver.ErrBadConn) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isFailoverError indica que o endpoint nao respondeu e vale tentar outro.
+// Escritas so sao repetidas se a query nao chegou ao servidor: uma conexao
+// derrubada depois do commit faria a escrita rodar duas vezes.
+func isFailoverError(err error, readOnly bool) bool {
+	var connErr *ConnectError
+	if errors.As(err, &connErr) {
+		return true
+	}
+	return isRetryable(err, readOnly)
+}
+
+// isRetryable indica erros transitorios que podem ser repetidos no mesmo
+// endpoint, seguindo a mesma regra de escritas de isFailoverError.
+func isRetryable(err error, readOnly bool) bool {
+	if !isTransientError(err) {
+		return false
+	}
+	return readOnly || neverSent(err)
+}
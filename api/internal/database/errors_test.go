@@ -0,0 +1,48 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestRetryRules(t *testing.T) {
+	dialErr := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	readErr := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+	tests := []struct {
+		name            string
+		err             error
+		read, write     bool // isRetryable para leitura e escrita
+		failoverOnWrite bool
+	}{
+		{"pool que nao abriu", &ConnectError{Err: errors.New("connection refused")}, false, false, true},
+		{"falha de dial", dialErr, true, true, true},
+		{"ErrBadConn", fmt.Errorf("erro ao executar query: %w", driver.ErrBadConn), true, true, true},
+		{"begin derrubado", &beginError{Err: io.EOF}, true, true, true},
+		{"conexao caiu no meio", fmt.Errorf("erro ao executar query: %w", readErr), true, false, false},
+		{"EOF na leitura", io.ErrUnexpectedEOF, true, false, false},
+		{"erro de SQL", errors.New(`relation "x" does not exist`), false, false, false},
+		{"cliente desistiu", context.Canceled, false, false, false},
+		{"timeout", context.DeadlineExceeded, false, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryable(tt.err, true); got != tt.read {
+				t.Errorf("isRetryable(leitura) = %v, esperava %v", got, tt.read)
+			}
+			if got := isRetryable(tt.err, false); got != tt.write {
+				t.Errorf("isRetryable(escrita) = %v, esperava %v", got, tt.write)
+			}
+			if got := isFailoverError(tt.err, false); got != tt.failoverOnWrite {
+				t.Errorf("isFailoverError(escrita) = %v, esperava %v", got, tt.failoverOnWrite)
+			}
+		})
+	}
+}
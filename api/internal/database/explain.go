@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ExplainResult e o plano de execucao de uma query, sem executa-la.
+type ExplainResult struct {
+	Driver      string        `json:"driver"`
+	Endpoint    string        `json:"endpoint"`
+	RenderedSQL string        `json:"rendered_sql"`
+	Args        []interface{} `json:"args"`
+	Plan        interface{}   `json:"plan"`
+	PlanText    []string      `json:"plan_text,omitempty"`
+}
+
+// Explain pede ao banco o plano da query com os argumentos informados. Passa
+// pelos mesmos limites de concorrencia, circuit breaker e failover de
+// QueryWithOptions. No PostgreSQL e no MySQL o EXPLAIN roda em transacao
+// somente leitura; no Oracle o EXPLAIN PLAN grava na PLAN_TABLE, entao a
+// transacao e sempre desfeita.
+func (cm *ConnectionManager) Explain(ctx context.Context, config DatasourceConfig, opts QueryOptions, sqlQuery string, args ...interface{}) (*ExplainResult, error) {
+	release, err := cm.acquireSlots(ctx, config, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	breaker := cm.breakerFor(config)
+	if err := breaker.Allow(); err != nil {
+		return nil, err
+	}
+
+	var result *ExplainResult
+	for _, endpoint := range cm.routeEndpoints(config) {
+		result, err = cm.explainOnEndpoint(ctx, config, endpoint, sqlQuery, args...)
+		if err == nil || !isFailoverError(err, true) || ctx.Err() != nil {
+			break
+		}
+		fmt.Printf("[ConnectionManager] Endpoint %s/%s indisponivel para explain, tentando o proximo: %v\n", config.Slug, endpoint.Name, err)
+	}
+	breaker.Record(err)
+
+	return result, err
+}
+
+func (cm *ConnectionManager) explainOnEndpoint(ctx context.Context, config DatasourceConfig, endpoint Endpoint, sqlQuery string, args ...interface{}) (*ExplainResult, error) {
+	pool, err := cm.acquirePool(ctx, config, endpoint)
+	if err != nil {
+		return nil, err
+	}
+	defer pool.release()
+
+	var txOpts *sql.TxOptions
+	if config.Driver == "mysql" {
+		txOpts = &sql.TxOptions{ReadOnly: true}
+	}
+
+	tx, err := pool.db.BeginTx(ctx, txOpts)
+	if err != nil {
+		return nil, &beginError{Err: err}
+	}
+	defer tx.Rollback()
+
+	result := &ExplainResult{
+		Driver:      config.Driver,
+		Endpoint:    endpoint.Name,
+		RenderedSQL: RenderSQL(config.Driver, sqlQuery, args),
+		Args:        args,
+	}
+	if result.Args == nil {
+		result.Args = []interface{}{}
+	}
+
+	switch config.Driver {
+	case "postgres", "postgresql":
+		if _, err := tx.ExecContext(ctx, "SET TRANSACTION READ ONLY"); err != nil {
+			return nil, fmt.Errorf("erro ao iniciar transacao somente leitura: %w", err)
+		}
+		result.Plan, err = explainJSON(ctx, tx, "EXPLAIN (FORMAT JSON) "+sqlQuery, args...)
+
+	case "mysql":
+		result.Plan, err = explainJSON(ctx, tx, "EXPLAIN FORMAT=JSON "+sqlQuery, args...)
+
+	case "oracle":
+		result.Plan, result.PlanText, err = cm.explainOracle(ctx, tx, sqlQuery)
+
+	default:
+		return nil, fmt.Errorf("driver nao suportado: %s", config.Driver)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao gerar plano: %w", err)
+	}
+
+	return result, nil
+}
+
+func explainJSON(ctx context.Context, tx *sql.Tx, explainSQL string, args ...interface{}) (interface{}, error) {
+	var raw []byte
+	if err := tx.QueryRowContext(ctx, explainSQL, args...).Scan(&raw); err != nil {
+		return nil, err
+	}
+
+	var plan interface{}
+	if err := json.Unmarshal(raw, &plan); err != nil {
+		return nil, fmt.Errorf("plano em formato inesperado: %w", err)
+	}
+
+	return plan, nil
+}
+
+// explainOracle usa EXPLAIN PLAN, que nao aceita valores de bind: o plano e
+// gerado com os binds como incognitas, como o otimizador veria sem peeking.
+func (cm *ConnectionManager) explainOracle(ctx context.Context, tx *sql.Tx, sqlQuery string) (interface{}, []string, error) {
+	statementID, err := explainStatementID()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	explainSQL := fmt.Sprintf("EXPLAIN PLAN SET STATEMENT_ID = '%s' FOR %s", statementID, sqlQuery)
+	if _, err := tx.ExecContext(ctx, explainSQL); err != nil {
+		return nil, nil, err
+	}
+
+	plan, err := cm.runQuery(ctx, tx, `
+		SELECT id, parent_id, depth, operation, options, object_owner, object_name,
+			   cost, cardinality, bytes, access_predicates, filter_predicates
+		FROM plan_table
+		WHERE statement_id = :1
+		ORDER BY id`, statementID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		"SELECT plan_table_output FROM TABLE(DBMS_XPLAN.DISPLAY('PLAN_TABLE', :1, 'TYPICAL'))", statementID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var text []string
+	for rows.Next() {
+		var line sql.NullString
+		if err := rows.Scan(&line); err != nil {
+			return nil, nil, err
+		}
+		text = append(text, line.String)
+	}
+
+	return plan, text, rows.Err()
+}
+
+func explainStatementID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("erro ao gerar statement id: %w", err)
+	}
+	return "QB" + strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// RenderSQL troca os placeholders do driver ($1, ? ou :1/:nome) pelos
+// argumentos formatados como literais. Serve apenas para exibicao; a query
+// continua sendo executada com binds.
+func RenderSQL(driver, sqlQuery string, args []interface{}) string {
+	return scanPlaceholders(driver, sqlQuery, func(index int, token string) string {
+		if index < 0 || index >= len(args) {
+			return token
+		}
+		return sqlLiteral(driver, args[index])
+	})
+}
+
+func sqlLiteral(driver string, value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.ReplaceAll(v, "'", "''") + "'"
+	case bool:
+		if driver == "oracle" {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		if driver == "oracle" {
+			return "TIMESTAMP '" + v.Format("2006-01-02 15:04:05") + "'"
+		}
+		return "'" + v.Format("2006-01-02 15:04:05") + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
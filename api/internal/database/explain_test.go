@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func TestExplainRespectsBreaker(t *testing.T) {
+	cm := NewConnectionManager(models.PoolConfig{BreakerFailureThreshold: 1})
+	config := DatasourceConfig{ID: "ds-1", Slug: "vendas", Driver: "postgres"}
+
+	breaker := cm.breakerFor(config)
+	breaker.Allow()
+	breaker.Record(errConnect)
+
+	_, err := cm.Explain(context.Background(), config, QueryOptions{}, "SELECT 1")
+	var openErr *CircuitOpenError
+	if !errors.As(err, &openErr) {
+		t.Fatalf("Explain() = %v, esperava CircuitOpenError", err)
+	}
+}
+
+func TestExplainRespectsLimits(t *testing.T) {
+	cm := NewConnectionManager(models.PoolConfig{})
+	cm.queueTimeout = 10 * time.Millisecond
+	config := DatasourceConfig{ID: "ds-1", Slug: "vendas", Driver: "postgres", MaxConcurrentQueries: 1, MaxQueuedQueries: 1}
+
+	release, err := cm.acquireSlots(context.Background(), config, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = cm.Explain(context.Background(), config, QueryOptions{}, "SELECT 1")
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Explain() = %v, esperava LimitExceededError", err)
+	}
+}
+
+func TestExplainFailover(t *testing.T) {
+	config := DatasourceConfig{
+		ID:       "ds-1",
+		Slug:     "vendas",
+		Driver:   "postgres",
+		Host:     "127.0.0.1",
+		Port:     closedPort(t),
+		Database: "vendas",
+		Username: "leitura",
+		Endpoints: []Endpoint{
+			{Name: "replica", Host: "127.0.0.1", Port: closedPort(t), Role: EndpointRoleReplica},
+		},
+	}
+
+	cm := NewConnectionManager(models.PoolConfig{BreakerFailureThreshold: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := cm.Explain(ctx, config, QueryOptions{}, "SELECT 1")
+	var connErr *ConnectError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("Explain() = %v, esperava ConnectError", err)
+	}
+
+	for _, name := range []string{"replica", "primary"} {
+		if _, marked := cm.unreachable[poolKey(config.ID, name)]; !marked {
+			t.Fatalf("endpoint %s nao foi tentado", name)
+		}
+	}
+
+	// A falha conta no breaker como numa execucao
+	if state := cm.breakerFor(config).Status().State; state != BreakerOpen {
+		t.Fatalf("breaker = %s depois da falha do explain, esperava aberto", state)
+	}
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ActiveDatasourcesFunc devolve os IDs dos datasources ativos no banco de
+// metadados.
+type ActiveDatasourcesFunc func(ctx context.Context) (map[string]bool, error)
+
+// StartJanitor inicia a varredura periodica que fecha pools sem uso ha mais de
+// pool.idle_pool_timeout e pools de datasources desativados ou removidos.
+// Com activeIDs nil apenas os pools ociosos sao fechados.
+func (cm *ConnectionManager) StartJanitor(activeIDs ActiveDatasourcesFunc) {
+	go func() {
+		ticker := time.NewTicker(cm.janitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cm.stop:
+				return
+			case <-ticker.C:
+				cm.sweep(activeIDs)
+			}
+		}
+	}()
+}
+
+func (cm *ConnectionManager) sweep(activeIDs ActiveDatasourcesFunc) {
+	var active map[string]bool
+	if activeIDs != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), cm.healthCheckTimeout)
+		ids, err := activeIDs(ctx)
+		cancel()
+		if err != nil {
+			// Sem a lista nao da para saber o que foi removido; fecha so os ociosos.
+			fmt.Printf("[Janitor] Erro ao listar datasources ativos: %v\n", err)
+		} else {
+			active = ids
+		}
+	}
+
+	type eviction struct {
+		key  string
+		pool *managedPool
+	}
+	var evictions []eviction
+	removed := make(map[string]bool)
+	idle := make(map[string]bool)
+
+	cm.mu.RLock()
+	for key, pool := range cm.connections {
+		id := pool.config.ID
+		switch {
+		case active != nil && !active[id]:
+			removed[id] = true
+			evictions = append(evictions, eviction{key, pool})
+			fmt.Printf("[Janitor] Datasource %s desativado ou removido, fechando pool %s\n", pool.config.Slug, key)
+		case pool.idleFor() > cm.idlePoolTimeout:
+			idle[id] = true
+			evictions = append(evictions, eviction{key, pool})
+			fmt.Printf("[Janitor] Pool %s sem uso ha %s, fechando\n", key, pool.idleFor().Round(time.Second))
+		}
+	}
+	if active != nil {
+		for id := range cm.breakers {
+			if !active[id] {
+				removed[id] = true
+			}
+		}
+	}
+	cm.mu.RUnlock()
+
+	for _, e := range evictions {
+		cm.closeConnection(e.key, e.pool)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	for id := range removed {
+		cm.forgetDatasource(id)
+	}
+
+	// Um datasource ocioso sem nenhum pool restante sai do /health, a nao ser
+	// que o breaker ainda esteja registrando falhas.
+	for id := range idle {
+		if removed[id] || cm.hasPool(id) {
+			continue
+		}
+		if breaker, exists := cm.breakers[id]; exists && breaker.Status().State != BreakerClosed {
+			continue
+		}
+		cm.forgetDatasource(id)
+	}
+}
+
+// CloseDatasource fecha todos os pools do datasource e descarta o estado
+// dele, sem esperar a proxima varredura do janitor. Usado ao desativar.
+func (cm *ConnectionManager) CloseDatasource(id string) {
+	cm.mu.RLock()
+	pools := make(map[string]*managedPool)
+	for key, pool := range cm.connections {
+		if pool.config.ID == id {
+			pools[key] = pool
+		}
+	}
+	cm.mu.RUnlock()
+
+	for key, pool := range pools {
+		cm.closeConnection(key, pool)
+	}
+
+	cm.mu.Lock()
+	cm.forgetDatasource(id)
+	cm.mu.Unlock()
+}
+
+// forgetDatasource descarta o breaker, o limitador e as marcacoes de endpoint
+// inacessivel do datasource. Deve ser chamado com cm.mu travado.
+func (cm *ConnectionManager) forgetDatasource(id string) {
+	delete(cm.breakers, id)
+	delete(cm.limiters, datasourceLimiterKey(id))
+
+	prefix := poolKey(id, "")
+	for key := range cm.unreachable {
+		if strings.HasPrefix(key, prefix) {
+			delete(cm.unreachable, key)
+		}
+	}
+}
+
+// hasPool deve ser chamado com cm.mu travado.
+func (cm *ConnectionManager) hasPool(id string) bool {
+	for _, pool := range cm.connections {
+		if pool.config.ID == id {
+			return true
+		}
+	}
+	return false
+}
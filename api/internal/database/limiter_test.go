@@ -0,0 +1,115 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func TestLimiterQueue(t *testing.T) {
+	l := NewConcurrencyLimiter("datasource", "vendas", 1, 1, time.Second)
+
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("primeira vaga: %v", err)
+	}
+
+	acquired := make(chan func())
+	go func() {
+		next, err := l.Acquire(context.Background())
+		if err != nil {
+			t.Errorf("execucao na fila: %v", err)
+		}
+		acquired <- next
+	}()
+
+	// Espera a goroutine entrar na fila
+	for l.Status().Waiting != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Vaga ocupada e fila cheia: recusa sem esperar
+	var limitErr *LimitExceededError
+	if _, err := l.Acquire(context.Background()); !errors.As(err, &limitErr) || !limitErr.Saturated {
+		t.Fatalf("Acquire() com fila cheia = %v, esperava Saturated", err)
+	}
+
+	release()
+	next := <-acquired
+	if status := l.Status(); status.InUse != 1 || status.Waiting != 0 {
+		t.Fatalf("status depois de liberar = %+v", status)
+	}
+	next()
+
+	if status := l.Status(); status.InUse != 0 {
+		t.Fatalf("InUse = %d depois de liberar tudo", status.InUse)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := NewConcurrencyLimiter("query", "relatorio", 1, 5, 20*time.Millisecond)
+
+	release, _ := l.Acquire(context.Background())
+	defer release()
+
+	start := time.Now()
+	_, err := l.Acquire(context.Background())
+
+	var limitErr *LimitExceededError
+	if !errors.As(err, &limitErr) || limitErr.Saturated {
+		t.Fatalf("Acquire() = %v, esperava timeout da fila", err)
+	}
+	if waited := time.Since(start); waited < 20*time.Millisecond {
+		t.Fatalf("desistiu depois de %s, antes do queue_timeout", waited)
+	}
+	if l.Status().Waiting != 0 {
+		t.Fatal("execucao que desistiu continua contando na fila")
+	}
+}
+
+func TestLimiterContextCanceled(t *testing.T) {
+	l := NewConcurrencyLimiter("datasource", "vendas", 1, 5, time.Minute)
+
+	release, _ := l.Acquire(context.Background())
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := l.Acquire(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() = %v, esperava o erro do contexto", err)
+	}
+}
+
+func TestAcquireSlotsReleasesQueryLimiter(t *testing.T) {
+	cm := NewConnectionManager(models.PoolConfig{})
+	cm.queueTimeout = 10 * time.Millisecond
+
+	config := DatasourceConfig{ID: "ds-1", Slug: "vendas", MaxConcurrentQueries: 1, MaxQueuedQueries: 1}
+	opts := QueryOptions{QueryKey: "relatorio", MaxConcurrency: 2}
+
+	release, err := cm.acquireSlots(context.Background(), config, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A vaga da query sobra, mas a do datasource esgota: a da query tem que
+	// ser devolvida
+	if _, err := cm.acquireSlots(context.Background(), config, opts); err == nil {
+		t.Fatal("acquireSlots() deveria esgotar o limite do datasource")
+	}
+	if inUse := cm.limiters["query:relatorio"].Status().InUse; inUse != 1 {
+		t.Fatalf("vagas da query em uso = %d, esperava 1", inUse)
+	}
+
+	release()
+	if inUse := cm.limiters["query:relatorio"].Status().InUse; inUse != 0 {
+		t.Fatalf("vagas da query em uso = %d depois de liberar", inUse)
+	}
+	if inUse := cm.limiters[datasourceLimiterKey("ds-1")].Status().InUse; inUse != 0 {
+		t.Fatalf("vagas do datasource em uso = %d depois de liberar", inUse)
+	}
+}
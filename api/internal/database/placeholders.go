@@ -0,0 +1,114 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scanPlaceholders percorre o SQL fora de strings e comentarios e chama
+// replace para cada placeholder do driver, com o indice (base 0) do argumento
+// que ele recebe. O retorno de replace substitui o placeholder no texto.
+func scanPlaceholders(driver, sqlQuery string, replace func(index int, token string) string) string {
+	var out strings.Builder
+	runes := []rune(sqlQuery)
+	next := 0
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			start := i
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			out.WriteString(string(runes[start:i]))
+			if i < len(runes) {
+				out.WriteRune(runes[i])
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			start := i
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			if i >= len(runes) {
+				i = len(runes) - 1
+			}
+			out.WriteString(string(runes[start : i+1]))
+
+		case r == '\'' || r == '"' || r == '`':
+			start := i
+			for i++; i < len(runes); i++ {
+				if runes[i] == r {
+					if i+1 < len(runes) && runes[i+1] == r {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			if i >= len(runes) {
+				i = len(runes) - 1
+			}
+			out.WriteString(string(runes[start : i+1]))
+
+		case r == '$' && (driver == "postgres" || driver == "postgresql") && i+1 < len(runes) && isDigit(runes[i+1]):
+			end := i + 1
+			for end < len(runes) && isDigit(runes[end]) {
+				end++
+			}
+			n, _ := strconv.Atoi(string(runes[i+1 : end]))
+			out.WriteString(replace(n-1, string(runes[i:end])))
+			i = end - 1
+
+		case r == '?' && driver == "mysql":
+			out.WriteString(replace(next, "?"))
+			next++
+
+		case r == ':' && driver == "oracle" && i+1 < len(runes) && isBindRune(runes[i+1]) && (i == 0 || runes[i-1] != ':'):
+			end := i + 1
+			for end < len(runes) && isBindRune(runes[end]) {
+				end++
+			}
+			// go-ora associa os binds pela ordem em que aparecem
+			out.WriteString(replace(next, string(runes[i:end])))
+			next++
+			i = end - 1
+
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
+
+// PlaceholderPositions devolve as posicoes (base 1) de argumento referenciadas
+// pelo SQL, sem repeticao e em ordem crescente.
+func PlaceholderPositions(driver, sqlQuery string) []int {
+	seen := make(map[int]bool)
+	scanPlaceholders(driver, sqlQuery, func(index int, token string) string {
+		seen[index+1] = true
+		return token
+	})
+
+	positions := make([]int, 0, len(seen))
+	for pos := range seen {
+		positions = append(positions, pos)
+	}
+	sort.Ints(positions)
+
+	return positions
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isBindRune(r rune) bool {
+	return isDigit(r) || r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
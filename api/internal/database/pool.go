@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	drainPollInterval = 500 * time.Millisecond
+	drainMaxWait      = 5 * time.Minute
+)
+
+type PoolState string
+
+const (
+	PoolHealthy  PoolState = "healthy"
+	PoolDegraded PoolState = "degraded"
+	PoolDown     PoolState = "down"
+)
+
+type PoolStatus struct {
+	DatasourceID        string         `json:"datasource_id"`
+	Slug                string         `json:"slug"`
+	Driver              string         `json:"driver"`
+	Endpoint            string         `json:"endpoint,omitempty"`
+	Role                string         `json:"role,omitempty"`
+	State               PoolState      `json:"state"`
+	ConsecutiveFailures int            `json:"consecutive_failures"`
+	LastCheck           *time.Time     `json:"last_check,omitempty"`
+	LastError           string         `json:"last_error,omitempty"`
+	Breaker             *BreakerStatus `json:"breaker,omitempty"`
+	Limiter             *LimiterStatus `json:"limiter,omitempty"`
+}
+
+// managedPool associa um *sql.DB ao fingerprint da configuracao que o criou
+// e conta as execucoes em andamento, para que um pool substituido so seja
+// fechado depois que as queries que o estao usando terminarem.
+type managedPool struct {
+	db          *sql.DB
+	fingerprint string
+	config      DatasourceConfig
+	endpoint    Endpoint
+	inFlight    int64
+	lastUsed    int64
+
+	mu                  sync.Mutex
+	state               PoolState
+	consecutiveFailures int
+	lastCheck           time.Time
+	lastError           string
+	lastQueryError      string
+	lastQueryErrorAt    time.Time
+	lastSuccessAt       time.Time
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+func newManagedPool(db *sql.DB, fingerprint string, config DatasourceConfig, endpoint Endpoint) *managedPool {
+	return &managedPool{
+		db:          db,
+		fingerprint: fingerprint,
+		config:      config,
+		endpoint:    endpoint,
+		lastUsed:    time.Now().UnixNano(),
+		state:       PoolHealthy,
+		stop:        make(chan struct{}),
+	}
+}
+
+func (p *managedPool) acquire() {
+	atomic.AddInt64(&p.inFlight, 1)
+	atomic.StoreInt64(&p.lastUsed, time.Now().UnixNano())
+}
+
+func (p *managedPool) release() {
+	atomic.AddInt64(&p.inFlight, -1)
+}
+
+func (p *managedPool) active() int64 {
+	return atomic.LoadInt64(&p.inFlight)
+}
+
+// idleFor diz ha quanto tempo o pool nao recebe nenhuma execucao.
+func (p *managedPool) idleFor() time.Duration {
+	if p.active() > 0 {
+		return 0
+	}
+	return time.Since(time.Unix(0, atomic.LoadInt64(&p.lastUsed)))
+}
+
+// drain espera as execucoes em andamento terminarem e fecha o pool.
+func (p *managedPool) drain(name string) {
+	deadline := time.Now().Add(drainMaxWait)
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for p.active() > 0 && time.Now().Before(deadline) {
+		<-ticker.C
+	}
+
+	if remaining := p.active(); remaining > 0 {
+		fmt.Printf("[ConnectionManager] Pool antigo de %s fechado com %d execucoes pendentes\n", name, remaining)
+	}
+
+	p.close()
+	fmt.Printf("[ConnectionManager] Pool antigo drenado: %s\n", name)
+}
+
+func (p *managedPool) close() {
+	p.closeOnce.Do(func() {
+		close(p.stop)
+		p.db.Close()
+	})
+}
+
+// healthCheck pinga o pool periodicamente em segundo plano, no lugar de
+// pingar a cada requisicao, e atualiza o estado reportado no /health.
+func (p *managedPool) healthCheck(interval, timeout time.Duration, downAfter int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := p.db.PingContext(ctx)
+			cancel()
+
+			if err != nil {
+				p.markFailure(err, downAfter)
+				fmt.Printf("[HealthCheck] Falha no ping de %s/%s: %v\n", p.config.Slug, p.endpoint.Name, err)
+			} else {
+				p.markSuccess()
+			}
+		}
+	}
+}
+
+func (p *managedPool) markSuccess() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.state = PoolHealthy
+	p.consecutiveFailures = 0
+	p.lastCheck = time.Now()
+	p.lastError = ""
+}
+
+func (p *managedPool) markFailure(err error, downAfter int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.consecutiveFailures++
+	p.lastCheck = time.Now()
+	p.lastError = err.Error()
+
+	if p.consecutiveFailures >= downAfter {
+		p.state = PoolDown
+	} else {
+		p.state = PoolDegraded
+	}
+}
+
+func (p *managedPool) status() PoolStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	status := PoolStatus{
+		DatasourceID:        p.config.ID,
+		Slug:                p.config.Slug,
+		Driver:              p.config.Driver,
+		Endpoint:            p.endpoint.Name,
+		Role:                p.endpoint.Role,
+		State:               p.state,
+		ConsecutiveFailures: p.consecutiveFailures,
+		LastError:           p.lastError,
+	}
+	if !p.lastCheck.IsZero() {
+		lastCheck := p.lastCheck
+		status.LastCheck = &lastCheck
+	}
+
+	return status
+}
+
+// recordQuery guarda o resultado da ultima execucao no pool, para a visao
+// administrativa.
+func (p *managedPool) recordQuery(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil {
+		p.lastQueryError = err.Error()
+		p.lastQueryErrorAt = time.Now()
+		return
+	}
+	p.lastSuccessAt = time.Now()
+}
+
+// PoolStats junta o sql.DBStats do pool com o historico de execucoes.
+type PoolStats struct {
+	DatasourceID string    `json:"datasource_id"`
+	Slug         string    `json:"slug"`
+	Driver       string    `json:"driver"`
+	Endpoint     string    `json:"endpoint"`
+	Role         string    `json:"role"`
+	State        PoolState `json:"state"`
+
+	MaxOpenConnections int   `json:"max_open_connections"`
+	OpenConnections    int   `json:"open_connections"`
+	InUse              int   `json:"in_use"`
+	Idle               int   `json:"idle"`
+	WaitCount          int64 `json:"wait_count"`
+	WaitDurationMs     int64 `json:"wait_duration_ms"`
+	MaxIdleClosed      int64 `json:"max_idle_closed"`
+	MaxIdleTimeClosed  int64 `json:"max_idle_time_closed"`
+	MaxLifetimeClosed  int64 `json:"max_lifetime_closed"`
+	ActiveQueries      int64 `json:"active_queries"`
+
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt *time.Time `json:"last_success_at,omitempty"`
+}
+
+func (p *managedPool) stats() PoolStats {
+	dbStats := p.db.Stats()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := PoolStats{
+		DatasourceID:       p.config.ID,
+		Slug:               p.config.Slug,
+		Driver:             p.config.Driver,
+		Endpoint:           p.endpoint.Name,
+		Role:               p.endpoint.Role,
+		State:              p.state,
+		MaxOpenConnections: dbStats.MaxOpenConnections,
+		OpenConnections:    dbStats.OpenConnections,
+		InUse:              dbStats.InUse,
+		Idle:               dbStats.Idle,
+		WaitCount:          dbStats.WaitCount,
+		WaitDurationMs:     dbStats.WaitDuration.Milliseconds(),
+		MaxIdleClosed:      dbStats.MaxIdleClosed,
+		MaxIdleTimeClosed:  dbStats.MaxIdleTimeClosed,
+		MaxLifetimeClosed:  dbStats.MaxLifetimeClosed,
+		ActiveQueries:      p.active(),
+		LastError:          p.lastQueryError,
+	}
+	if !p.lastQueryErrorAt.IsZero() {
+		lastErrorAt := p.lastQueryErrorAt
+		stats.LastErrorAt = &lastErrorAt
+	}
+	if !p.lastSuccessAt.IsZero() {
+		lastSuccessAt := p.lastSuccessAt
+		stats.LastSuccessAt = &lastSuccessAt
+	}
+
+	return stats
+}
+
+// Fingerprint identifica os campos que exigem um novo pool quando mudam.
+func (c DatasourceConfig) Fingerprint() string {
+	raw := fmt.Sprintf("%s|%s|%d|%s|%s|%s|%d|%d|%d|%d",
+		c.Driver,
+		c.Host,
+		c.Port,
+		c.Database,
+		c.Username,
+		c.Password,
+		c.MaxOpenConns,
+		c.MaxIdleConns,
+		c.ConnMaxLifetimeSeconds,
+		c.ConnMaxIdleTimeSeconds,
+	)
+
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -60,6 +60,23 @@ func (r *RedisClient) Set(ctx context.Context, key string, value string, ttlSeco
 	return nil
 }
 
+// DeleteByPattern remove as chaves que casam com o padrao usando SCAN, sem
+// bloquear o Redis como o KEYS faria.
+func (r *RedisClient) DeleteByPattern(ctx context.Context, pattern string) error {
+	iter := r.Client.Scan(ctx, 0, pattern, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := r.Client.Del(ctx, iter.Val()).Err(); err != nil {
+			return fmt.Errorf("erro ao remover chave do Redis: %w", err)
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("erro ao varrer chaves no Redis: %w", err)
+	}
+
+	return nil
+}
+
 func (r *RedisClient) Close() error {
 	return r.Client.Close()
 }
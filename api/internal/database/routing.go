@@ -0,0 +1,109 @@
+package database
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	EndpointRolePrimary = "primary"
+	EndpointRoleReplica = "replica"
+
+	// Nome do endpoint implicito montado a partir do host/port do datasource.
+	defaultEndpointName = "primary"
+)
+
+// Endpoint e uma copia do banco do datasource (primario ou replica), que
+// compartilha database, usuario e senha com ele.
+type Endpoint struct {
+	Name     string `json:"name"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Role     string `json:"role"`
+	Priority int    `json:"priority"`
+}
+
+// QueryResult traz as linhas e qual endpoint atendeu a execucao.
+type QueryResult struct {
+	Rows     []map[string]interface{}
+	Endpoint string
+}
+
+func poolKey(datasourceID, endpoint string) string {
+	return datasourceID + "/" + endpoint
+}
+
+// allEndpoints devolve o endpoint implicito do datasource seguido dos
+// endpoints cadastrados em datasource_endpoints.
+func (c DatasourceConfig) allEndpoints() []Endpoint {
+	endpoints := []Endpoint{{
+		Name: defaultEndpointName,
+		Host: c.Host,
+		Port: c.Port,
+		Role: EndpointRolePrimary,
+	}}
+
+	return append(endpoints, c.Endpoints...)
+}
+
+func (c DatasourceConfig) forEndpoint(endpoint Endpoint) DatasourceConfig {
+	epConfig := c
+	epConfig.Host = endpoint.Host
+	epConfig.Port = endpoint.Port
+	epConfig.Endpoints = nil
+	return epConfig
+}
+
+// routeEndpoints ordena os endpoints para uma leitura: replicas primeiro,
+// depois primarios, cada grupo por prioridade. Endpoints marcados como down
+// vao para o fim da lista, para serem usados so se todos os outros falharem.
+func (cm *ConnectionManager) routeEndpoints(config DatasourceConfig) []Endpoint {
+	endpoints := config.allEndpoints()
+
+	cm.mu.RLock()
+	down := make(map[string]bool, len(endpoints))
+	for _, ep := range endpoints {
+		key := poolKey(config.ID, ep.Name)
+		if until, exists := cm.unreachable[key]; exists && time.Now().Before(until) {
+			down[ep.Name] = true
+			continue
+		}
+		if pool, exists := cm.connections[key]; exists && pool.status().State == PoolDown {
+			down[ep.Name] = true
+		}
+	}
+	cm.mu.RUnlock()
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		a, b := endpoints[i], endpoints[j]
+		if down[a.Name] != down[b.Name] {
+			return !down[a.Name]
+		}
+		if a.Role != b.Role {
+			return a.Role == EndpointRoleReplica
+		}
+		return a.Priority < b.Priority
+	})
+
+	return endpoints
+}
+
+// markUnreachable tira o endpoint da rota ate o proximo ciclo de health check.
+func (cm *ConnectionManager) markUnreachable(key string) {
+	cm.mu.Lock()
+	cm.unreachable[key] = time.Now().Add(cm.healthCheckInterval)
+	cm.mu.Unlock()
+}
+
+func (cm *ConnectionManager) clearUnreachable(key string) {
+	cm.mu.RLock()
+	_, exists := cm.unreachable[key]
+	cm.mu.RUnlock()
+	if !exists {
+		return
+	}
+
+	cm.mu.Lock()
+	delete(cm.unreachable, key)
+	cm.mu.Unlock()
+}
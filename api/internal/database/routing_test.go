@@ -0,0 +1,165 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func endpointNames(endpoints []Endpoint) string {
+	names := make([]string, len(endpoints))
+	for i, ep := range endpoints {
+		names[i] = ep.Name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestRouteEndpoints(t *testing.T) {
+	config := DatasourceConfig{
+		ID:   "ds-1",
+		Host: "db-primario",
+		Port: 5432,
+		Endpoints: []Endpoint{
+			{Name: "replica-b", Host: "db-b", Port: 5432, Role: EndpointRoleReplica, Priority: 2},
+			{Name: "standby", Host: "db-s", Port: 5432, Role: EndpointRolePrimary, Priority: 1},
+			{Name: "replica-a", Host: "db-a", Port: 5432, Role: EndpointRoleReplica, Priority: 1},
+		},
+	}
+
+	tests := []struct {
+		name string
+		down []string
+		want string
+	}{
+		{"replicas primeiro, por prioridade", nil, "replica-a,replica-b,primary,standby"},
+		{"replica fora do ar vai para o fim", []string{"replica-a"}, "replica-b,primary,standby,replica-a"},
+		{"tudo fora do ar mantem a ordem", []string{"primary", "standby", "replica-a", "replica-b"}, "replica-a,replica-b,primary,standby"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm := NewConnectionManager(models.PoolConfig{})
+			for _, name := range tt.down {
+				cm.markUnreachable(poolKey(config.ID, name))
+			}
+
+			if got := endpointNames(cm.routeEndpoints(config)); got != tt.want {
+				t.Fatalf("routeEndpoints() = %s, esperava %s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("marcacao expirada volta para a rota", func(t *testing.T) {
+		cm := NewConnectionManager(models.PoolConfig{})
+		cm.unreachable[poolKey(config.ID, "replica-a")] = time.Now().Add(-time.Second)
+
+		if got := endpointNames(cm.routeEndpoints(config)); got != "replica-a,replica-b,primary,standby" {
+			t.Fatalf("routeEndpoints() = %s", got)
+		}
+	})
+}
+
+// closedPort devolve uma porta local sem ninguem escutando, para simular um
+// endpoint fora do ar sem depender de rede.
+func closedPort(t *testing.T) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+	return port
+}
+
+func TestFailover(t *testing.T) {
+	config := DatasourceConfig{
+		ID:       "ds-1",
+		Slug:     "vendas",
+		Driver:   "postgres",
+		Host:     "127.0.0.1",
+		Port:     closedPort(t),
+		Database: "vendas",
+		Username: "leitura",
+		Endpoints: []Endpoint{
+			{Name: "replica", Host: "127.0.0.1", Port: closedPort(t), Role: EndpointRoleReplica},
+		},
+	}
+
+	cm := NewConnectionManager(models.PoolConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := cm.QueryWithOptions(ctx, config, QueryOptions{}, "SELECT 1")
+
+	var connErr *ConnectError
+	if !errors.As(err, &connErr) {
+		t.Fatalf("QueryWithOptions() = %v, esperava ConnectError", err)
+	}
+
+	// A falha da replica passou a execucao para o primario; os dois ficam
+	// fora da rota ate o proximo health check
+	for _, name := range []string{"replica", "primary"} {
+		if _, marked := cm.unreachable[poolKey(config.ID, name)]; !marked {
+			t.Fatalf("endpoint %s nao foi marcado como inacessivel", name)
+		}
+	}
+}
+
+func TestFailoverStopsOnQueryError(t *testing.T) {
+	config := DatasourceConfig{
+		ID:     "ds-1",
+		Slug:   "vendas",
+		Driver: "sqlserver",
+		Endpoints: []Endpoint{
+			{Name: "replica", Role: EndpointRoleReplica},
+		},
+	}
+
+	cm := NewConnectionManager(models.PoolConfig{})
+	_, err := cm.QueryWithOptions(context.Background(), config, QueryOptions{}, "SELECT 1")
+	if err == nil || !strings.Contains(err.Error(), "driver nao suportado") {
+		t.Fatalf("QueryWithOptions() = %v, esperava erro de driver", err)
+	}
+
+	// Erro que nao e de conexao se repetiria em qualquer endpoint
+	if len(cm.unreachable) != 0 {
+		t.Fatalf("endpoints marcados como inacessiveis: %v", cm.unreachable)
+	}
+}
+
+func TestWritesGoOnlyToPrimary(t *testing.T) {
+	config := DatasourceConfig{
+		ID:          "ds-1",
+		Slug:        "vendas",
+		Driver:      "postgres",
+		Host:        "127.0.0.1",
+		Port:        closedPort(t),
+		Database:    "vendas",
+		Username:    "etl",
+		AllowWrites: true,
+		Endpoints: []Endpoint{
+			{Name: "replica", Host: "127.0.0.1", Port: closedPort(t), Role: EndpointRoleReplica},
+		},
+	}
+
+	cm := NewConnectionManager(models.PoolConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := cm.QueryWithOptions(ctx, config, QueryOptions{}, "UPDATE vendas SET total = 0"); err == nil {
+		t.Fatal("QueryWithOptions() deveria falhar sem endpoint no ar")
+	}
+
+	if _, tried := cm.unreachable[poolKey(config.ID, "replica")]; tried {
+		t.Fatal("escrita foi enviada para a replica")
+	}
+	if _, tried := cm.unreachable[poolKey(config.ID, "primary")]; !tried {
+		t.Fatal("escrita nao foi enviada para o primario")
+	}
+}
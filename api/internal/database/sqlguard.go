@@ -0,0 +1,288 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ReadOnlyViolationError indica que o SQL de uma query nao e uma leitura
+// simples e o datasource nao permite escrita.
+type ReadOnlyViolationError struct {
+	Reason string
+}
+
+func (e *ReadOnlyViolationError) Error() string {
+	return "SQL nao permitido em datasource somente leitura: " + e.Reason
+}
+
+// cteBodyKeywords sao os comandos aceitos como corpo de uma CTE.
+var cteBodyKeywords = map[string]bool{
+	"SELECT": true,
+	"WITH":   true,
+	"VALUES": true,
+}
+
+// CheckReadOnlySQL aceita apenas um unico comando SELECT ou WITH. Sao
+// analisadas so as posicoes de comando: o inicio do SQL, o corpo de cada CTE
+// e o SELECT ... INTO; REPLACE(...), TRUNCATE(...) ou uma coluna chamada lock
+// continuam valendo. E uma checagem estatica; a garantia final e a transacao
+// somente leitura.
+func CheckReadOnlySQL(sqlText string) error {
+	stripped := stripLiteralsAndComments(sqlText)
+
+	body := strings.TrimSpace(stripped)
+	body = strings.TrimRight(body, "; \t\r\n")
+	if strings.Contains(body, ";") {
+		return &ReadOnlyViolationError{Reason: "mais de um comando na mesma query"}
+	}
+
+	tokens := sqlTokens(body)
+	if len(tokens) == 0 {
+		return &ReadOnlyViolationError{Reason: "query vazia"}
+	}
+
+	i := skipOpenParens(tokens, 0)
+	if i < len(tokens) && tokens[i] == "WITH" {
+		var err error
+		if i, err = checkCTEs(tokens, i+1); err != nil {
+			return err
+		}
+		i = skipOpenParens(tokens, i)
+	}
+
+	if i >= len(tokens) || tokens[i] != "SELECT" {
+		command := "vazio"
+		if i < len(tokens) {
+			command = tokens[i]
+		}
+		return &ReadOnlyViolationError{Reason: fmt.Sprintf("comando %s nao e permitido, apenas SELECT/WITH", command)}
+	}
+
+	for i, token := range tokens {
+		switch {
+		case token == "INTO" && (i == 0 || tokens[i-1] != "."):
+			// INTO e reservada: fora de um nome qualificado so aparece como
+			// SELECT ... INTO tabela/variavel/OUTFILE
+			return &ReadOnlyViolationError{Reason: "SELECT ... INTO nao e permitido"}
+		case token == "FOR" && i+1 < len(tokens) && lockingClause[tokens[i+1]]:
+			return &ReadOnlyViolationError{Reason: "SELECT ... FOR " + tokens[i+1] + " nao e permitido"}
+		case token == "LOCK" && hasWords(tokens[i+1:], "IN", "SHARE", "MODE"):
+			return &ReadOnlyViolationError{Reason: "SELECT ... LOCK IN SHARE MODE nao e permitido"}
+		}
+	}
+
+	return nil
+}
+
+// lockingClause sao as palavras que seguem FOR em um SELECT que trava linhas
+// (FOR UPDATE, FOR SHARE, FOR NO KEY UPDATE, FOR KEY SHARE).
+var lockingClause = map[string]bool{
+	"UPDATE": true,
+	"SHARE":  true,
+	"NO":     true,
+	"KEY":    true,
+}
+
+// checkCTEs percorre a lista de CTEs a partir do token depois de WITH e
+// devolve a posicao do comando principal.
+func checkCTEs(tokens []string, i int) (int, error) {
+	malformed := &ReadOnlyViolationError{Reason: "WITH em formato nao reconhecido"}
+
+	if i < len(tokens) && tokens[i] == "RECURSIVE" {
+		i++
+	}
+
+	for {
+		// nome [(colunas)] AS [NOT] [MATERIALIZED] (corpo)
+		if i >= len(tokens) || !isWord(tokens[i]) {
+			return 0, malformed
+		}
+		i++
+		if i < len(tokens) && tokens[i] == "(" {
+			i = closingParen(tokens, i) + 1
+		}
+		if i >= len(tokens) || tokens[i] != "AS" {
+			return 0, malformed
+		}
+		i++
+		if i < len(tokens) && tokens[i] == "NOT" {
+			i++
+		}
+		if i < len(tokens) && tokens[i] == "MATERIALIZED" {
+			i++
+		}
+		if i >= len(tokens) || tokens[i] != "(" {
+			return 0, malformed
+		}
+
+		end := closingParen(tokens, i)
+		start := skipOpenParens(tokens, i)
+		if start >= end || !cteBodyKeywords[tokens[start]] {
+			command := "vazio"
+			if start < end {
+				command = tokens[start]
+			}
+			return 0, &ReadOnlyViolationError{Reason: fmt.Sprintf("comando %s nao e permitido dentro do WITH", command)}
+		}
+		if tokens[start] == "WITH" {
+			next, err := checkCTEs(tokens[:end], start+1)
+			if err != nil {
+				return 0, err
+			}
+			if next = skipOpenParens(tokens, next); next >= end || tokens[next] != "SELECT" {
+				return 0, &ReadOnlyViolationError{Reason: "comando nao permitido dentro do WITH"}
+			}
+		}
+
+		i = end + 1
+		if i < len(tokens) && tokens[i] == "," {
+			i++
+			continue
+		}
+		return i, nil
+	}
+}
+
+// closingParen devolve a posicao do parentese que fecha o aberto em open, ou
+// len(tokens) quando ele nao fecha.
+func closingParen(tokens []string, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens)
+}
+
+func skipOpenParens(tokens []string, i int) int {
+	for i < len(tokens) && tokens[i] == "(" {
+		i++
+	}
+	return i
+}
+
+func hasWords(tokens []string, words ...string) bool {
+	if len(tokens) < len(words) {
+		return false
+	}
+	for i, word := range words {
+		if tokens[i] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// stripLiteralsAndComments troca strings, identificadores entre aspas e
+// comentarios por espacos, para que o conteudo deles nao seja analisado. O
+// resultado tem o mesmo numero de runes do original, entao posicoes achadas
+// nele valem para o SQL original.
+func stripLiteralsAndComments(sqlText string) string {
+	var out strings.Builder
+	runes := []rune(sqlText)
+
+	blank := func(start, end int) {
+		out.WriteString(strings.Repeat(" ", min(end, len(runes)-1)-start+1))
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		start := i
+
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			blank(start, i)
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+			blank(start, i)
+
+		case r == '\'' || r == '"' || r == '`':
+			quote := r
+			for i++; i < len(runes); i++ {
+				if runes[i] == quote {
+					if i+1 < len(runes) && runes[i+1] == quote {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			blank(start, i)
+
+		case r == '$':
+			// Dollar quoting do PostgreSQL: $$...$$ ou $tag$...$tag$
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			if end < len(runes) && runes[end] == '$' {
+				tag := string(runes[i : end+1])
+				rest := string(runes[end+1:])
+				if idx := strings.Index(rest, tag); idx >= 0 {
+					i = end + len([]rune(rest[:idx])) + len([]rune(tag))
+					blank(start, i)
+					continue
+				}
+			}
+			out.WriteRune(r)
+
+		default:
+			out.WriteRune(r)
+		}
+	}
+
+	return out.String()
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$' || r == '#'
+}
+
+func isWord(token string) bool {
+	return token != "" && isWordRune([]rune(token)[0])
+}
+
+// sqlTokens separa o SQL em palavras (em maiusculas) e na pontuacao que
+// importa para a analise: parenteses, virgula e ponto.
+func sqlTokens(text string) []string {
+	var tokens []string
+	var word strings.Builder
+
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, strings.ToUpper(word.String()))
+			word.Reset()
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case isWordRune(r):
+			word.WriteRune(r)
+		case r == '(' || r == ')' || r == ',' || r == '.':
+			flush()
+			tokens = append(tokens, string(r))
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return tokens
+}
@@ -0,0 +1,91 @@
+package database
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReadOnlySQL(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		allowed bool
+	}{
+		{"select simples", "SELECT * FROM vendas", true},
+		{"select minusculo com ponto e virgula", "select id from vendas;", true},
+		{"with", "WITH t AS (SELECT 1 AS n) SELECT n FROM t", true},
+		{"palavra proibida em string", "SELECT 'DELETE FROM x' AS texto FROM dual", true},
+		{"palavra proibida em comentario de linha", "SELECT 1 -- DROP TABLE x\nFROM dual", true},
+		{"palavra proibida em comentario de bloco", "SELECT /* UPDATE x SET y = 1 */ 1", true},
+		{"palavra proibida em identificador", `SELECT "update" FROM t`, true},
+		{"dollar quoting", "SELECT $$DELETE$$ AS texto", true},
+		{"coluna com nome parecido", "SELECT updated_at, created_by FROM t", true},
+		{"funcao replace", "SELECT REPLACE(nome, 'a', 'b') FROM clientes", true},
+		{"funcao truncate", "SELECT TRUNCATE(valor, 2) FROM vendas", true},
+		{"replace dentro de cte", "WITH n AS (SELECT replace(nome, ' ', '') AS nome FROM t) SELECT nome FROM n", true},
+		{"colunas lock, exec e call", "SELECT lock, exec, call FROM jobs WHERE lock IN (1, 2)", true},
+		{"coluna qualificada into", "SELECT t.into FROM t", true},
+		{"select entre parenteses", "(SELECT 1) UNION (SELECT 2)", true},
+		{"with recursive com colunas", "WITH RECURSIVE n(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM n WHERE i < 5) SELECT i FROM n", true},
+		{"varias ctes e materialized", "WITH a AS MATERIALIZED (SELECT 1 AS x), b AS (VALUES (2)) SELECT * FROM a, b", true},
+		{"substring com for", "SELECT SUBSTRING(nome FROM 1 FOR 3) FROM t", true},
+		{"insert", "INSERT INTO t VALUES (1)", false},
+		{"update", "UPDATE t SET a = 1", false},
+		{"delete", "delete from t", false},
+		{"dois comandos", "SELECT 1; DROP TABLE t", false},
+		{"with com escrita", "WITH x AS (DELETE FROM t RETURNING *) SELECT * FROM x", false},
+		{"escrita na segunda cte", "WITH a AS (SELECT 1), b AS (UPDATE t SET a = 1 RETURNING a) SELECT * FROM b", false},
+		{"escrita em with aninhado", "WITH a AS (WITH b AS (INSERT INTO t VALUES (1) RETURNING 1) SELECT * FROM b) SELECT * FROM a", false},
+		{"with com comando principal de escrita", "WITH x AS (SELECT id FROM t) DELETE FROM t WHERE id IN (SELECT id FROM x)", false},
+		{"with malformado", "WITH x SELECT 1", false},
+		{"replace como comando", "REPLACE INTO t VALUES (1)", false},
+		{"truncate como comando", "TRUNCATE TABLE t", false},
+		{"select into", "SELECT * INTO copia FROM t", false},
+		{"select into outfile", "SELECT * FROM t INTO OUTFILE '/tmp/t.csv'", false},
+		{"select for update", "SELECT * FROM t WHERE id = 1 FOR UPDATE", false},
+		{"lock in share mode", "SELECT * FROM t LOCK IN SHARE MODE", false},
+		{"lock", "SELECT * FROM t; LOCK TABLE t", false},
+		{"segundo comando depois de comentario", "SELECT 1 /* ; */ ; UPDATE t SET a = 1", false},
+		{"chamada de procedure", "CALL limpar()", false},
+		{"vazio", "   ", false},
+		{"so comentario", "-- SELECT 1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckReadOnlySQL(tt.sql)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("CheckReadOnlySQL(%q) recusou: %v", tt.sql, err)
+				}
+				return
+			}
+
+			var violation *ReadOnlyViolationError
+			if !errors.As(err, &violation) {
+				t.Fatalf("CheckReadOnlySQL(%q) = %v, esperava ReadOnlyViolationError", tt.sql, err)
+			}
+		})
+	}
+}
+
+func TestStripLiteralsAndCommentsKeepsPositions(t *testing.T) {
+	tests := []string{
+		"SELECT 'ção' FROM t",
+		"SELECT 1 -- comentário\nFROM t",
+		"SELECT /* bloco */ 1",
+		"SELECT 'sem fim",
+		"SELECT 1 /* sem fim",
+		`SELECT "a""b" FROM t`,
+		"SELECT $tag$ texto $tag$, $$ x $$",
+	}
+
+	for _, sql := range tests {
+		t.Run(sql, func(t *testing.T) {
+			stripped := stripLiteralsAndComments(sql)
+			if got, want := len([]rune(stripped)), len([]rune(sql)); got != want {
+				t.Fatalf("%q virou %q: %d runes, esperava %d", sql, stripped, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+// Folga para o timeout do servidor disparar antes do contexto da requisicao,
+// deixando o banco abortar o comando de forma limpa.
+const statementTimeoutMargin = 250 * time.Millisecond
+
+// StatementTimeoutError indica que a query passou do timeout configurado.
+// CancelledOnServer informa se foi confirmado que o comando parou no banco.
+type StatementTimeoutError struct {
+	Timeout           time.Duration
+	CancelledOnServer bool
+	Err               error
+}
+
+func (e *StatementTimeoutError) Error() string {
+	return fmt.Sprintf("query excedeu o timeout de %s: %v", e.Timeout.Round(time.Millisecond), e.Err)
+}
+
+func (e *StatementTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// applyStatementTimeout configura o timeout nativo do driver para o tempo que
+// resta no contexto e devolve o identificador da sessao no servidor, usado
+// para confirmar o cancelamento, e o SQL a executar. No MySQL o timeout vai
+// como hint no proprio SELECT: SET SESSION ficaria na conexao devolvida ao
+// pool. O go-ora nao tem call timeout por comando: quando o contexto expira
+// ele envia um break na propria conexao e o servidor cancela a chamada com
+// ORA-01013, sem consulta extra a cada execucao.
+func (cm *ConnectionManager) applyStatementTimeout(ctx context.Context, tx *sql.Tx, driver string, sqlQuery string) (string, time.Duration, string, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", 0, sqlQuery, nil
+	}
+
+	timeout := time.Until(deadline) - statementTimeoutMargin
+	if timeout < time.Millisecond {
+		timeout = time.Millisecond
+	}
+	ms := strconv.FormatInt(timeout.Milliseconds(), 10)
+
+	var sessionID string
+	switch driver {
+	case "postgres", "postgresql":
+		query := "SELECT pg_backend_pid()::text, set_config('statement_timeout', $1, true)"
+		var ignored string
+		if err := tx.QueryRowContext(ctx, query, ms).Scan(&sessionID, &ignored); err != nil {
+			return "", timeout, sqlQuery, fmt.Errorf("erro ao configurar statement_timeout: %w", err)
+		}
+
+	case "mysql":
+		sqlQuery = withMaxExecutionTime(sqlQuery, ms)
+		if err := tx.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&sessionID); err != nil {
+			return "", timeout, sqlQuery, fmt.Errorf("erro ao obter id da conexao: %w", err)
+		}
+
+	}
+
+	return sessionID, timeout, sqlQuery, nil
+}
+
+// withMaxExecutionTime coloca o hint MAX_EXECUTION_TIME logo apos o SELECT
+// principal (fora de parenteses, strings e comentarios). Comandos sem esse
+// SELECT seguem sem hint e dependem do KILL QUERY de cancelOnServer.
+func withMaxExecutionTime(sqlQuery string, ms string) string {
+	stripped := []rune(stripLiteralsAndComments(sqlQuery))
+	isWord := func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$' || r == '#'
+	}
+
+	depth := 0
+	first := true
+	for i := 0; i < len(stripped); i++ {
+		switch r := stripped[i]; {
+		case r == '(':
+			depth++
+		case r == ')':
+			depth--
+		case isWord(r):
+			end := i
+			for end < len(stripped) && isWord(stripped[end]) {
+				end++
+			}
+			word := strings.ToUpper(string(stripped[i:end]))
+			if first && word != "SELECT" && word != "WITH" {
+				return sqlQuery
+			}
+			first = false
+			if depth == 0 && word == "SELECT" {
+				runes := []rune(sqlQuery)
+				return string(runes[:end]) + " /*+ MAX_EXECUTION_TIME(" + ms + ") */" + string(runes[end:])
+			}
+			i = end - 1
+		}
+	}
+
+	return sqlQuery
+}
+
+// isStatementTimeout reconhece tanto o deadline do contexto quanto os erros
+// de timeout/cancelamento devolvidos por cada banco.
+func isStatementTimeout(ctx context.Context, err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "57014" {
+		return true
+	}
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && (mysqlErr.Number == 3024 || mysqlErr.Number == 1317) {
+		return true
+	}
+
+	var oraErr *network.OracleError
+	if errors.As(err, &oraErr) && oraErr.ErrCode == 1013 {
+		return true
+	}
+
+	return false
+}
+
+// cancelOnServer confirma, por outra conexao do pool, que o comando nao
+// continua rodando no banco depois do timeout e o cancela se ainda estiver.
+// Precisa rodar antes de a transacao devolver a conexao ao pool.
+func (cm *ConnectionManager) cancelOnServer(db *sql.DB, config DatasourceConfig, sessionID string, timeout time.Duration, cause error) error {
+	timeoutErr := &StatementTimeoutError{Timeout: timeout, Err: cause}
+
+	var oraErr *network.OracleError
+	if errors.As(cause, &oraErr) && oraErr.ErrCode == 1013 {
+		// ORA-01013: o servidor confirmou o cancelamento pedido pelo break
+		timeoutErr.CancelledOnServer = true
+		return timeoutErr
+	}
+
+	if config.Driver == "oracle" {
+		fmt.Printf("[Timeout] %s: break enviado sem confirmacao do servidor (ORA-01013)\n", config.Slug)
+		return timeoutErr
+	}
+
+	if sessionID == "" {
+		fmt.Printf("[Timeout] %s: sem id de sessao para confirmar o cancelamento no servidor\n", config.Slug)
+		return timeoutErr
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var err error
+	var stillRunning bool
+
+	switch config.Driver {
+	case "postgres", "postgresql":
+		query := "SELECT COUNT(*) > 0 FROM pg_stat_activity WHERE pid = $1::int AND state = 'active'"
+		if err = db.QueryRowContext(ctx, query, sessionID).Scan(&stillRunning); err == nil && stillRunning {
+			_, err = db.ExecContext(ctx, "SELECT pg_cancel_backend($1::int)", sessionID)
+		}
+
+	case "mysql":
+		query := "SELECT COUNT(*) > 0 FROM information_schema.PROCESSLIST WHERE ID = ? AND COMMAND = 'Query'"
+		if err = db.QueryRowContext(ctx, query, sessionID).Scan(&stillRunning); err == nil && stillRunning {
+			_, err = db.ExecContext(ctx, "KILL QUERY "+sessionID)
+		}
+
+	}
+
+	if err != nil {
+		fmt.Printf("[Timeout] %s: nao foi possivel confirmar o cancelamento da sessao %s: %v\n", config.Slug, sessionID, err)
+		return timeoutErr
+	}
+
+	if stillRunning {
+		fmt.Printf("[Timeout] %s: sessao %s ainda executava apos o timeout, cancelada no servidor\n", config.Slug, sessionID)
+	}
+	timeoutErr.CancelledOnServer = true
+
+	return timeoutErr
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/sijms/go-ora/v2/network"
+)
+
+func TestWithMaxExecutionTime(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want string
+	}{
+		{"select simples", "SELECT * FROM t", "SELECT /*+ MAX_EXECUTION_TIME(500) */ * FROM t"},
+		{"minusculo", "select id from t", "select /*+ MAX_EXECUTION_TIME(500) */ id from t"},
+		{"comentario antes", "-- relatorio\nSELECT 1", "-- relatorio\nSELECT /*+ MAX_EXECUTION_TIME(500) */ 1"},
+		{"with usa o select de fora", "WITH x AS (SELECT 1 AS n) SELECT n FROM x", "WITH x AS (SELECT 1 AS n) SELECT /*+ MAX_EXECUTION_TIME(500) */ n FROM x"},
+		{"select em string antes", "WITH x AS (SELECT 'select' AS s) SELECT s FROM x", "WITH x AS (SELECT 'select' AS s) SELECT /*+ MAX_EXECUTION_TIME(500) */ s FROM x"},
+		{"acentos antes do select", "WITH x AS (SELECT 'ção' AS s) SELECT s FROM x", "WITH x AS (SELECT 'ção' AS s) SELECT /*+ MAX_EXECUTION_TIME(500) */ s FROM x"},
+		{"select entre parenteses fica igual", "(SELECT 1) UNION (SELECT 2)", "(SELECT 1) UNION (SELECT 2)"},
+		{"show fica igual", "SHOW TABLES", "SHOW TABLES"},
+		{"coluna chamada selected", "SELECTED", "SELECTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withMaxExecutionTime(tt.sql, "500"); got != tt.want {
+				t.Fatalf("withMaxExecutionTime(%q) = %q, esperava %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsStatementTimeout(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		want bool
+	}{
+		{"postgres 57014", context.Background(), fmt.Errorf("erro ao executar query: %w", &pq.Error{Code: "57014"}), true},
+		{"mysql max_execution_time", context.Background(), &mysql.MySQLError{Number: 3024}, true},
+		{"mysql query interrompida", context.Background(), &mysql.MySQLError{Number: 1317}, true},
+		{"oracle ORA-01013", context.Background(), &network.OracleError{ErrCode: 1013}, true},
+		{"deadline do contexto", context.Background(), context.DeadlineExceeded, true},
+		{"contexto expirado com erro do driver", expired, errors.New("driver: bad connection"), true},
+		{"erro de sql", context.Background(), &pq.Error{Code: "42P01"}, false},
+		{"cliente cancelou", context.Background(), context.Canceled, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isStatementTimeout(tt.ctx, tt.err); got != tt.want {
+				t.Fatalf("isStatementTimeout() = %v, esperava %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsQueryTimeout(t *testing.T) {
+	timeoutErr := &StatementTimeoutError{Timeout: time.Second, Err: &pq.Error{Code: "57014"}}
+
+	if !isQueryTimeout(timeoutErr) || !isQueryTimeout(fmt.Errorf("datasource vendas: %w", timeoutErr)) {
+		t.Fatal("StatementTimeoutError nao reconhecido")
+	}
+	if !isQueryTimeout(context.DeadlineExceeded) {
+		t.Fatal("DeadlineExceeded nao reconhecido")
+	}
+	if isQueryTimeout(context.Canceled) || isQueryTimeout(errConnect) {
+		t.Fatal("erro que nao e timeout reconhecido como timeout")
+	}
+}
+
+func TestCancelOnServerOracle(t *testing.T) {
+	cm := NewConnectionManager(models.PoolConfig{})
+	config := DatasourceConfig{Slug: "erp", Driver: "oracle"}
+
+	// O break do go-ora confirmado pelo servidor dispensa qualquer consulta
+	err := cm.cancelOnServer(nil, config, "", time.Second, &network.OracleError{ErrCode: 1013})
+	var timeoutErr *StatementTimeoutError
+	if !errors.As(err, &timeoutErr) || !timeoutErr.CancelledOnServer {
+		t.Fatalf("cancelOnServer() = %#v, esperava cancelamento confirmado", err)
+	}
+
+	err = cm.cancelOnServer(nil, config, "", time.Second, context.DeadlineExceeded)
+	if !errors.As(err, &timeoutErr) || timeoutErr.CancelledOnServer {
+		t.Fatalf("cancelOnServer() = %#v, esperava cancelamento sem confirmacao", err)
+	}
+}
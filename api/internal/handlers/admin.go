@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	connManager *database.ConnectionManager
+}
+
+func NewAdminHandler(connManager *database.ConnectionManager) *AdminHandler {
+	return &AdminHandler{
+		connManager: connManager,
+	}
+}
+
+// DatasourceStatus mostra o estado dos pools e circuit breakers.
+// GET /api/admin/datasources/status
+func (h *AdminHandler) DatasourceStatus(c *gin.Context) {
+	statuses := h.connManager.Status()
+
+	c.JSON(http.StatusOK, gin.H{
+		"datasources": statuses,
+		"count":       len(statuses),
+	})
+}
+
+// PoolStats mostra as estatisticas de conexao (sql.DBStats) de cada pool.
+// GET /api/admin/pools
+func (h *AdminHandler) PoolStats(c *gin.Context) {
+	stats := h.connManager.PoolStats()
+
+	c.JSON(http.StatusOK, gin.H{
+		"pools": stats,
+		"count": len(stats),
+	})
+}
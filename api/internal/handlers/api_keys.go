@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/adolp26/querybase/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyAdminHandler emite, rotaciona e revoga as API keys guardadas no banco.
+// A chave em texto puro so aparece na resposta da emissao e da rotacao.
+type APIKeyAdminHandler struct {
+	keyRepo    *repository.APIKeyRepository
+	keyService *services.APIKeyService
+}
+
+func NewAPIKeyAdminHandler(keyRepo *repository.APIKeyRepository, keyService *services.APIKeyService) *APIKeyAdminHandler {
+	return &APIKeyAdminHandler{
+		keyRepo:    keyRepo,
+		keyService: keyService,
+	}
+}
+
+type apiKeyRequest struct {
+	Name      string       `json:"name"`
+	Owner     *string      `json:"owner"`
+	ExpiresAt *time.Time   `json:"expires_at"`
+	Scopes    models.Scope `json:"scopes"`
+	Roles     []string     `json:"roles"`
+
+	// Attributes alimenta os parametros vinculados a credencial (bind_from).
+	Attributes map[string]string `json:"attributes"`
+
+	// Quota limita o consumo diario da chave; campos zerados usam
+	// quotas.default_per_key.
+	Quota models.Quota `json:"quota"`
+}
+
+type rotateRequest struct {
+	GraceSeconds int `json:"grace_seconds"`
+}
+
+// List lista as chaves, sem os segredos.
+// GET /api/admin/api-keys
+func (h *APIKeyAdminHandler) List(c *gin.Context) {
+	keys, err := h.keyRepo.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar API keys",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"api_keys": keys,
+		"count":    len(keys),
+	})
+}
+
+// Create emite uma nova chave.
+// POST /api/admin/api-keys
+func (h *APIKeyAdminHandler) Create(c *gin.Context) {
+	var req apiKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if errs := validateAPIKeyRequest(req); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Definicao de API key invalida",
+			"validation": errs,
+		})
+		return
+	}
+
+	actor := requestActor(c)
+	key := &models.APIKey{
+		Name:       req.Name,
+		Owner:      req.Owner,
+		ExpiresAt:  req.ExpiresAt,
+		Scopes:     req.Scopes,
+		Roles:      models.NormalizeRoles(req.Roles),
+		Attributes: req.Attributes,
+		Quota:      req.Quota,
+		CreatedBy:  &actor,
+	}
+
+	plain, err := h.keyService.Issue(c.Request.Context(), key)
+	if err != nil {
+		respondWriteError(c, "", "Erro ao emitir API key", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key": key,
+		"key":     plain,
+	})
+}
+
+// Rotate emite uma chave nova com os mesmos dados e encerra a antiga, na hora
+// ou depois de grace_seconds, para dar tempo de trocar nos clientes.
+// POST /api/admin/api-keys/:id/rotate
+func (h *APIKeyAdminHandler) Rotate(c *gin.Context) {
+	old, ok := h.findKey(c)
+	if !ok {
+		return
+	}
+
+	var req rotateRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "JSON invalido",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+	if req.GraceSeconds < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Definicao de API key invalida",
+			"validation": map[string]string{"grace_seconds": "nao pode ser negativo"},
+		})
+		return
+	}
+
+	if !old.Usable(time.Now()) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "API key revogada ou expirada",
+			"code":  "api_key_unusable",
+			"id":    old.ID,
+		})
+		return
+	}
+
+	grace := time.Duration(req.GraceSeconds) * time.Second
+	key, plain, err := h.keyService.Rotate(c.Request.Context(), old, grace, requestActor(c))
+	if err != nil {
+		respondWriteError(c, "", "Erro ao rotacionar API key", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"api_key":             key,
+		"key":                 plain,
+		"previous_id":         old.ID,
+		"previous_expires_in": grace.String(),
+	})
+}
+
+// Revoke invalida a chave imediatamente.
+// DELETE /api/admin/api-keys/:id
+func (h *APIKeyAdminHandler) Revoke(c *gin.Context) {
+	key, ok := h.findKey(c)
+	if !ok {
+		return
+	}
+
+	if err := h.keyService.Revoke(c.Request.Context(), key.ID); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Erro ao revogar API key",
+			"id":      key.ID,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"revoked": true,
+		"id":      key.ID,
+	})
+}
+
+func (h *APIKeyAdminHandler) findKey(c *gin.Context) (*models.APIKey, bool) {
+	id := c.Param("id")
+
+	key, err := h.keyRepo.FindByID(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "API key nao encontrada",
+			"id":      id,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	return key, true
+}
+
+func validateAPIKeyRequest(req apiKeyRequest) map[string]string {
+	errs := make(map[string]string)
+
+	if req.Name == "" {
+		errs["name"] = "obrigatorio"
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		errs["expires_at"] = "deve estar no futuro"
+	}
+
+	for field, patterns := range map[string][]string{
+		"scopes.queries":     req.Scopes.Queries,
+		"scopes.datasources": req.Scopes.Datasources,
+		"scopes.tags":        req.Scopes.Tags,
+	} {
+		for _, pattern := range patterns {
+			if strings.TrimSpace(pattern) == "" {
+				errs[field] = "valores vazios nao sao permitidos"
+				break
+			}
+			if _, err := path.Match(pattern, ""); err != nil {
+				errs[field] = fmt.Sprintf("padrao '%s' invalido", pattern)
+				break
+			}
+		}
+	}
+
+	for name, value := range req.Attributes {
+		if !paramNamePattern.MatchString(name) {
+			errs["attributes."+name] = "nome invalido: use letras, numeros e '_'"
+		} else if value == "" {
+			errs["attributes."+name] = "valor vazio nao e permitido"
+		}
+	}
+
+	if field := req.Quota.Invalid(); field != "" {
+		errs["quota."+field] = "nao pode ser negativo"
+	}
+
+	return errs
+}
@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adolp26/querybase/internal/catalog"
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/masking"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/adolp26/querybase/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// CatalogHandler exporta o catalogo de queries e aplica um catalogo versionado
+// em Git no banco de metadados.
+type CatalogHandler struct {
+	queryRepo      *repository.QueryRepository
+	datasourceRepo *repository.DatasourceRepository
+	cacheService   *services.CacheService
+	masker         *masking.Masker
+}
+
+func NewCatalogHandler(
+	queryRepo *repository.QueryRepository,
+	datasourceRepo *repository.DatasourceRepository,
+	cacheService *services.CacheService,
+	masker *masking.Masker,
+) *CatalogHandler {
+	return &CatalogHandler{
+		queryRepo:      queryRepo,
+		datasourceRepo: datasourceRepo,
+		cacheService:   cacheService,
+		masker:         masker,
+	}
+}
+
+// Export devolve o catalogo completo em YAML (padrao) ou JSON.
+// GET /api/admin/catalog?format=yaml|json
+func (h *CatalogHandler) Export(c *gin.Context) {
+	queries, err := h.queryRepo.ListAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar queries",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	format := c.DefaultQuery("format", "yaml")
+	data, err := catalog.FromModels(queries).Marshal(format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Erro ao exportar catalogo",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	contentType := "application/yaml; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json; charset=utf-8"
+	}
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// Plan mostra o que aplicar o catalogo enviado mudaria, sem gravar nada.
+// POST /api/admin/catalog/plan?prune=true
+func (h *CatalogHandler) Plan(c *gin.Context) {
+	plan, _, ok := h.buildPlan(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"plan": plan})
+}
+
+// Apply reconcilia o banco com o catalogo enviado em uma unica transacao.
+// POST /api/admin/catalog/apply?prune=true
+func (h *CatalogHandler) Apply(c *gin.Context) {
+	plan, validated, ok := h.buildPlan(c)
+	if !ok {
+		return
+	}
+
+	if !plan.HasChanges() {
+		c.JSON(http.StatusOK, gin.H{"plan": plan, "applied": false})
+		return
+	}
+
+	deprecated, err := deprecatedChanges(plan, validated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao comparar versoes",
+			"details": err.Error(),
+		})
+		return
+	}
+	if len(deprecated) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Catalogo altera SQL, parametros ou datasource de queries depreciadas",
+			"code":    "query_deprecated",
+			"queries": deprecated,
+		})
+		return
+	}
+
+	actor := requestActor(c)
+	var creates, updates []*models.Query
+	var deleteIDs []string
+
+	for _, change := range plan.Changes {
+		switch change.Action {
+		case catalog.ActionCreate, catalog.ActionUpdate:
+			// Grava o mesmo modelo que passou pela validacao do plano
+			query := validated[change.Slug]
+			query.UpdatedBy = &actor
+			if change.Action == catalog.ActionCreate {
+				query.CreatedBy = &actor
+				creates = append(creates, query)
+			} else {
+				query.ID = change.Current.ID
+				updates = append(updates, query)
+			}
+		case catalog.ActionDelete:
+			deleteIDs = append(deleteIDs, change.Current.ID)
+		}
+	}
+
+	if err := h.queryRepo.ApplyChanges(c.Request.Context(), creates, updates, deleteIDs); err != nil {
+		respondWriteError(c, "", "Erro ao aplicar catalogo", err)
+		return
+	}
+
+	for _, change := range plan.Changes {
+		if change.Action == catalog.ActionUpdate || change.Action == catalog.ActionDelete {
+			if err := h.cacheService.InvalidateQuery(c.Request.Context(), change.Slug); err != nil {
+				fmt.Printf("[Cache] Erro ao invalidar cache da query '%s': %v\n", change.Slug, err)
+			}
+		}
+	}
+
+	fmt.Printf("[Catalog] Aplicado por %s: %d criadas, %d alteradas, %d removidas\n",
+		actor, plan.Summary.Create, plan.Summary.Update, plan.Summary.Delete)
+
+	c.JSON(http.StatusOK, gin.H{"plan": plan, "applied": true})
+}
+
+// deprecatedChanges lista as queries depreciadas que o plano alteraria em SQL,
+// parametros ou datasource. Como na API de queries, depreciada so aceita
+// mudancas fora da versao.
+func deprecatedChanges(plan *catalog.Plan, validated map[string]*models.Query) ([]string, error) {
+	var slugs []string
+	for _, change := range plan.Changes {
+		if change.Action != catalog.ActionUpdate || change.Current.Status != models.QueryStatusDeprecated {
+			continue
+		}
+		changed, err := catalog.VersionChanged(change.Current, validated[change.Slug])
+		if err != nil {
+			return nil, err
+		}
+		if changed {
+			slugs = append(slugs, change.Slug)
+		}
+	}
+	return slugs, nil
+}
+
+// buildPlan le o catalogo do corpo, valida cada query com as mesmas regras da
+// API de queries e compara com o banco. Qualquer erro recusa o catalogo
+// inteiro. Devolve tambem os modelos validados, por slug, para o Apply gravar.
+func (h *CatalogHandler) buildPlan(c *gin.Context) (*catalog.Plan, map[string]*models.Query, bool) {
+	ctx := c.Request.Context()
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Erro ao ler o corpo da requisicao",
+			"details": err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	desired, err := catalog.Parse(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Catalogo invalido",
+			"details": err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	datasources := make(map[string]*database.DatasourceConfig)
+	validated := make(map[string]*models.Query, len(desired.Queries))
+	lookupErrs := make(map[string]error)
+	invalid := make(map[string]map[string]string)
+
+	for _, q := range desired.Queries {
+		datasource, seen := datasources[q.Datasource]
+		if !seen && q.Datasource != "" {
+			datasource, lookupErrs[q.Datasource] = h.datasourceRepo.FindBySlug(ctx, q.Datasource)
+			datasources[q.Datasource] = datasource
+		}
+
+		datasourceID := ""
+		if datasource != nil {
+			datasourceID = datasource.ID
+		}
+
+		query, err := q.ToModel(datasourceID)
+		if err != nil {
+			invalid[q.Slug] = map[string]string{"parameters": err.Error()}
+			continue
+		}
+		if datasourceID == "" {
+			query.DatasourceID = nil
+		}
+
+		errs := validateQueryDefinition(query, datasource, h.masker)
+		if datasource == nil && q.Datasource != "" {
+			errs["datasource"] = lookupErrs[q.Datasource].Error()
+		}
+		if len(errs) > 0 {
+			invalid[q.Slug] = errs
+			continue
+		}
+		validated[q.Slug] = query
+	}
+
+	if len(invalid) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Catalogo contem queries invalidas",
+			"validation": invalid,
+		})
+		return nil, nil, false
+	}
+
+	current, err := h.queryRepo.ListAll(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar queries",
+			"details": err.Error(),
+		})
+		return nil, nil, false
+	}
+
+	return catalog.BuildPlan(desired, current, c.Query("prune") == "true"), validated, true
+}
@@ -43,11 +43,6 @@ func (h *ConnectionHandler) TestConnection(c *gin.Context) {
 		return
 	}
 
-	supportedDrivers := map[string]bool{
-		"oracle":   true,
-		"postgres": true,
-		"mysql":    true,
-	}
 	if !supportedDrivers[req.Driver] {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
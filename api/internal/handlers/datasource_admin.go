@@ -0,0 +1,493 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+var supportedDrivers = map[string]bool{
+	"oracle":   true,
+	"postgres": true,
+	"mysql":    true,
+}
+
+// DatasourceAdminHandler cadastra, altera, testa e desativa datasources. A
+// senha e criptografada no repositorio e nunca volta nas respostas; com
+// password_ref ela fica num provedor externo e so a referencia e gravada.
+type DatasourceAdminHandler struct {
+	datasourceRepo *repository.DatasourceRepository
+	connManager    *database.ConnectionManager
+}
+
+func NewDatasourceAdminHandler(
+	datasourceRepo *repository.DatasourceRepository,
+	connManager *database.ConnectionManager,
+) *DatasourceAdminHandler {
+	return &DatasourceAdminHandler{
+		datasourceRepo: datasourceRepo,
+		connManager:    connManager,
+	}
+}
+
+// Campos omitidos (nil) mantem o valor atual na alteracao.
+type datasourceRequest struct {
+	Slug                   *string `json:"slug"`
+	Name                   *string `json:"name"`
+	Driver                 *string `json:"driver"`
+	Host                   *string `json:"host"`
+	Port                   *int    `json:"port"`
+	DatabaseName           *string `json:"database_name"`
+	Username               *string `json:"username"`
+	Password               *string `json:"password"`
+	MaxOpenConns           *int    `json:"max_open_conns"`
+	MaxIdleConns           *int    `json:"max_idle_conns"`
+	IsActive               *bool   `json:"is_active"`
+	MaxConcurrentQueries   *int    `json:"max_concurrent_queries"`
+	MaxQueuedQueries       *int    `json:"max_queued_queries"`
+	AllowWrites            *bool   `json:"allow_writes"`
+	ConnMaxLifetimeSeconds *int    `json:"conn_max_lifetime_seconds"`
+	ConnMaxIdleTimeSeconds *int    `json:"conn_max_idle_time_seconds"`
+
+	// AllowedRoles vazio libera o datasource para qualquer chamador.
+	AllowedRoles *[]string `json:"allowed_roles"`
+
+	// PasswordRef substitui a senha por uma referencia (env://, file://,
+	// vault://). Vazio na alteracao volta a usar a senha criptografada.
+	PasswordRef *string `json:"password_ref"`
+}
+
+func (r datasourceRequest) applyTo(ds *models.Datasource) {
+	setString := func(dst *string, src *string) {
+		if src != nil {
+			*dst = strings.TrimSpace(*src)
+		}
+	}
+	setInt := func(dst *int, src *int) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+
+	setString(&ds.Slug, r.Slug)
+	setString(&ds.Name, r.Name)
+	setString(&ds.Driver, r.Driver)
+	setString(&ds.Host, r.Host)
+	setString(&ds.DatabaseName, r.DatabaseName)
+	setString(&ds.Username, r.Username)
+	if r.Port != nil {
+		ds.Port = strconv.Itoa(*r.Port)
+	}
+	setInt(&ds.MaxOpenConns, r.MaxOpenConns)
+	setInt(&ds.MaxIdleConns, r.MaxIdleConns)
+	setInt(&ds.MaxConcurrentQueries, r.MaxConcurrentQueries)
+	setInt(&ds.MaxQueuedQueries, r.MaxQueuedQueries)
+	setInt(&ds.ConnMaxLifetimeSeconds, r.ConnMaxLifetimeSeconds)
+	setInt(&ds.ConnMaxIdleTimeSeconds, r.ConnMaxIdleTimeSeconds)
+	if r.IsActive != nil {
+		ds.IsActive = *r.IsActive
+	}
+	if r.AllowWrites != nil {
+		ds.AllowWrites = *r.AllowWrites
+	}
+	if r.AllowedRoles != nil {
+		ds.AllowedRoles = models.NormalizeRoles(*r.AllowedRoles)
+	}
+}
+
+// List lista todos os datasources, inclusive inativos.
+// GET /api/admin/datasources
+func (h *DatasourceAdminHandler) List(c *gin.Context) {
+	datasources, err := h.datasourceRepo.ListRecords(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar datasources",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"datasources": datasources,
+		"count":       len(datasources),
+	})
+}
+
+// Get devolve o cadastro de um datasource, sem credenciais.
+// GET /api/admin/datasources/:slug
+func (h *DatasourceAdminHandler) Get(c *gin.Context) {
+	ds, ok := h.findDatasource(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datasource": ds})
+}
+
+// Create cadastra um datasource. Se ele for criado ativo, a conexao e testada
+// antes de gravar.
+// POST /api/admin/datasources
+func (h *DatasourceAdminHandler) Create(c *gin.Context) {
+	var req datasourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	ds := &models.Datasource{
+		Driver:       "oracle",
+		MaxOpenConns: 25,
+		MaxIdleConns: 5,
+		IsActive:     true,
+	}
+	req.applyTo(ds)
+
+	if req.Password != nil && *req.Password == "" {
+		req.Password = nil
+	}
+	if ref := trimmedRef(req.PasswordRef); ref != "" {
+		ds.PasswordRef = &ref
+	}
+	if req.Password == nil && ds.PasswordRef == nil {
+		respondDatasourceValidation(c, ds.Slug, map[string]string{"password": "obrigatorio (ou password_ref)"})
+		return
+	}
+	if req.Password != nil && ds.PasswordRef != nil {
+		respondDatasourceValidation(c, ds.Slug, map[string]string{"password_ref": "informe password ou password_ref, nao os dois"})
+		return
+	}
+	if !validateDatasource(c, ds) {
+		return
+	}
+
+	password, ok := h.resolveCredential(c, ds, req.Password)
+	if !ok {
+		return
+	}
+	if ds.IsActive && !h.testBeforeActivation(c, ds, password) {
+		return
+	}
+
+	if req.Password != nil {
+		ds.Password = *req.Password
+	}
+	if err := h.datasourceRepo.Create(c.Request.Context(), ds); err != nil {
+		respondWriteError(c, ds.Slug, "Erro ao criar datasource", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"datasource": ds})
+}
+
+// Update altera o cadastro. Se o datasource ficar ativo, a conexao e testada
+// com os novos dados antes de gravar.
+// PUT /api/admin/datasources/:slug
+func (h *DatasourceAdminHandler) Update(c *gin.Context) {
+	ds, ok := h.findDatasource(c)
+	if !ok {
+		return
+	}
+	wasActive := ds.IsActive
+
+	var req datasourceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	req.applyTo(ds)
+	if req.Password != nil && *req.Password == "" {
+		req.Password = nil
+	}
+
+	// Trocar para referencia descarta a senha salva; informar uma senha nova
+	// descarta a referencia
+	if req.PasswordRef != nil {
+		if ref := trimmedRef(req.PasswordRef); ref != "" {
+			if req.Password != nil {
+				respondDatasourceValidation(c, ds.Slug, map[string]string{"password_ref": "informe password ou password_ref, nao os dois"})
+				return
+			}
+			ds.PasswordRef = &ref
+			ds.Password = ""
+		} else {
+			ds.PasswordRef = nil
+		}
+	} else if req.Password != nil {
+		ds.PasswordRef = nil
+	}
+	if ds.PasswordRef == nil && ds.Password == "" && req.Password == nil {
+		respondDatasourceValidation(c, ds.Slug, map[string]string{"password": "obrigatorio ao remover password_ref"})
+		return
+	}
+	if !validateDatasource(c, ds) {
+		return
+	}
+
+	if ds.IsActive || req.PasswordRef != nil {
+		password, ok := h.resolveCredential(c, ds, req.Password)
+		if !ok {
+			return
+		}
+		if ds.IsActive && !h.testBeforeActivation(c, ds, password) {
+			return
+		}
+	}
+
+	if err := h.datasourceRepo.Update(c.Request.Context(), ds, req.Password); err != nil {
+		respondWriteError(c, ds.Slug, "Erro ao atualizar datasource", err)
+		return
+	}
+
+	if wasActive && !ds.IsActive {
+		h.connManager.CloseDatasource(ds.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"datasource": ds})
+}
+
+// Activate testa a conexao com os dados salvos e ativa o datasource.
+// POST /api/admin/datasources/:slug/activate
+func (h *DatasourceAdminHandler) Activate(c *gin.Context) {
+	ds, ok := h.findDatasource(c)
+	if !ok {
+		return
+	}
+
+	password, ok := h.plainPassword(c, ds, nil)
+	if !ok || !h.testBeforeActivation(c, ds, password) {
+		return
+	}
+
+	if err := h.datasourceRepo.SetActive(c.Request.Context(), ds.ID, true); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao ativar datasource",
+			"slug":    ds.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+	ds.IsActive = true
+
+	c.JSON(http.StatusOK, gin.H{"datasource": ds})
+}
+
+// Deactivate desativa o datasource e fecha os pools dele. As queries
+// vinculadas passam a responder erro ate ele ser reativado.
+// POST /api/admin/datasources/:slug/deactivate
+func (h *DatasourceAdminHandler) Deactivate(c *gin.Context) {
+	ds, ok := h.findDatasource(c)
+	if !ok {
+		return
+	}
+
+	if err := h.datasourceRepo.SetActive(c.Request.Context(), ds.ID, false); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao desativar datasource",
+			"slug":    ds.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+	ds.IsActive = false
+
+	h.connManager.CloseDatasource(ds.ID)
+
+	c.JSON(http.StatusOK, gin.H{"datasource": ds})
+}
+
+// Test testa a conexao com os dados salvos, sem alterar o cadastro.
+// POST /api/admin/datasources/:slug/test
+func (h *DatasourceAdminHandler) Test(c *gin.Context) {
+	ds, ok := h.findDatasource(c)
+	if !ok {
+		return
+	}
+
+	password, ok := h.plainPassword(c, ds, nil)
+	if !ok {
+		return
+	}
+
+	result, err := h.testConnection(c.Request.Context(), ds, password)
+	if err != nil {
+		c.JSON(http.StatusOK, gin.H{
+			"success": false,
+			"slug":    ds.Slug,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        result.Success,
+		"slug":           ds.Slug,
+		"message":        result.Message,
+		"duration_ms":    result.DurationMs,
+		"server_version": result.ServerVersion,
+	})
+}
+
+func (h *DatasourceAdminHandler) findDatasource(c *gin.Context) (*models.Datasource, bool) {
+	slug := c.Param("slug")
+
+	ds, err := h.datasourceRepo.FindRecordBySlug(c.Request.Context(), slug)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Datasource nao encontrado",
+			"slug":    slug,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	return ds, true
+}
+
+// plainPassword devolve a nova senha informada ou a salva, resolvendo o
+// password_ref ou descriptografando a senha.
+func (h *DatasourceAdminHandler) plainPassword(c *gin.Context, ds *models.Datasource, newPassword *string) (string, bool) {
+	if newPassword != nil {
+		return *newPassword, true
+	}
+
+	password, err := h.datasourceRepo.PlainPassword(c.Request.Context(), ds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao obter a senha salva",
+			"slug":    ds.Slug,
+			"details": err.Error(),
+		})
+		return "", false
+	}
+
+	return password, true
+}
+
+// resolveCredential e o plainPassword da gravacao: uma referencia que nao
+// resolve e erro de validacao, para nao gravar um datasource sem senha. Uma
+// referencia fora das origens de secrets.* e recusada aqui, antes de o teste
+// de conexao enviar o valor ao host do datasource.
+func (h *DatasourceAdminHandler) resolveCredential(c *gin.Context, ds *models.Datasource, newPassword *string) (string, bool) {
+	if ds.PasswordRef == nil {
+		return h.plainPassword(c, ds, newPassword)
+	}
+
+	password, err := h.datasourceRepo.ResolveSecret(c.Request.Context(), *ds.PasswordRef)
+	if err != nil {
+		respondDatasourceValidation(c, ds.Slug, map[string]string{"password_ref": err.Error()})
+		return "", false
+	}
+
+	return password, true
+}
+
+func trimmedRef(ref *string) string {
+	if ref == nil {
+		return ""
+	}
+	return strings.TrimSpace(*ref)
+}
+
+func (h *DatasourceAdminHandler) testBeforeActivation(c *gin.Context, ds *models.Datasource, password string) bool {
+	if _, err := h.testConnection(c.Request.Context(), ds, password); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "Teste de conexao falhou; o datasource nao foi ativado",
+			"code":    "connection_test_failed",
+			"slug":    ds.Slug,
+			"details": err.Error(),
+		})
+		return false
+	}
+	return true
+}
+
+func (h *DatasourceAdminHandler) testConnection(ctx context.Context, ds *models.Datasource, password string) (*database.ConnectionTestResult, error) {
+	port, _ := strconv.Atoi(ds.Port)
+
+	config := database.DatasourceConfig{
+		ID:           ds.ID,
+		Slug:         ds.Slug,
+		Driver:       ds.Driver,
+		Host:         ds.Host,
+		Port:         port,
+		Database:     ds.DatabaseName,
+		Username:     ds.Username,
+		Password:     password,
+		MaxOpenConns: ds.MaxOpenConns,
+		MaxIdleConns: ds.MaxIdleConns,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	return h.connManager.TestConnection(ctx, config)
+}
+
+func validateDatasource(c *gin.Context, ds *models.Datasource) bool {
+	errs := make(map[string]string)
+
+	if !slugPattern.MatchString(ds.Slug) {
+		errs["slug"] = "use apenas letras minusculas, numeros, '-' e '_' (ate 100 caracteres)"
+	}
+	if ds.Name == "" {
+		errs["name"] = "obrigatorio"
+	}
+	if !supportedDrivers[ds.Driver] {
+		errs["driver"] = fmt.Sprintf("driver nao suportado: %s", ds.Driver)
+	}
+	if ds.Host == "" {
+		errs["host"] = "obrigatorio"
+	}
+	if port, err := strconv.Atoi(ds.Port); err != nil || port < 1 || port > 65535 {
+		errs["port"] = "deve estar entre 1 e 65535"
+	}
+	if ds.DatabaseName == "" {
+		errs["database_name"] = "obrigatorio"
+	}
+	if ds.Username == "" {
+		errs["username"] = "obrigatorio"
+	}
+
+	for field, value := range map[string]int{
+		"max_open_conns":             ds.MaxOpenConns,
+		"max_idle_conns":             ds.MaxIdleConns,
+		"max_concurrent_queries":     ds.MaxConcurrentQueries,
+		"max_queued_queries":         ds.MaxQueuedQueries,
+		"conn_max_lifetime_seconds":  ds.ConnMaxLifetimeSeconds,
+		"conn_max_idle_time_seconds": ds.ConnMaxIdleTimeSeconds,
+	} {
+		if value < 0 {
+			errs[field] = "nao pode ser negativo"
+		}
+	}
+
+	if len(errs) > 0 {
+		respondDatasourceValidation(c, ds.Slug, errs)
+		return false
+	}
+
+	return true
+}
+
+func respondDatasourceValidation(c *gin.Context, slug string, errs map[string]string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":      "Definicao de datasource invalida",
+		"slug":       slug,
+		"validation": errs,
+	})
+}
@@ -3,13 +3,18 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"time"
+	"unicode/utf8"
 
 	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/masking"
+	"github.com/adolp26/querybase/internal/middleware"
 	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/paramcheck"
 	"github.com/adolp26/querybase/internal/repository"
 	"github.com/adolp26/querybase/internal/services"
 	"github.com/gin-gonic/gin"
@@ -22,6 +27,8 @@ type DynamicQueryHandler struct {
 	datasourceRepo *repository.DatasourceRepository
 	connManager    *database.ConnectionManager
 	cacheService   *services.CacheService
+	masker         *masking.Masker
+	quotas         *services.QuotaService
 }
 
 func NewDynamicQueryHandler(
@@ -29,12 +36,16 @@ func NewDynamicQueryHandler(
 	datasourceRepo *repository.DatasourceRepository,
 	connManager *database.ConnectionManager,
 	cacheService *services.CacheService,
+	masker *masking.Masker,
+	quotas *services.QuotaService,
 ) *DynamicQueryHandler {
 	return &DynamicQueryHandler{
 		queryRepo:      queryRepo,
 		datasourceRepo: datasourceRepo,
 		connManager:    connManager,
 		cacheService:   cacheService,
+		masker:         masker,
+		quotas:         quotas,
 	}
 }
 
@@ -45,7 +56,7 @@ func (h *DynamicQueryHandler) Execute(c *gin.Context) {
 
 	ctx := c.Request.Context()
 
-	query, err := h.queryRepo.FindBySlug(ctx, slug)
+	query, err := h.findExecutable(c, slug)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"error":   "Query nao encontrada",
@@ -55,6 +66,11 @@ func (h *DynamicQueryHandler) Execute(c *gin.Context) {
 		return
 	}
 
+	query, ok := h.resolveVersion(c, query, false)
+	if !ok {
+		return
+	}
+
 	if query.DatasourceID == nil || *query.DatasourceID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error": "Query nao possui datasource vinculado",
@@ -73,7 +89,24 @@ func (h *DynamicQueryHandler) Execute(c *gin.Context) {
 		return
 	}
 
-	params, validationErrors := h.extractAndValidateParams(c, query)
+	if !h.authorize(c, query, datasource, startTime) {
+		return
+	}
+
+	if !datasource.AllowWrites {
+		if err := database.CheckReadOnlySQL(query.SQLQuery); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Query contem comandos de escrita",
+				"code":       "write_not_allowed",
+				"slug":       slug,
+				"datasource": datasource.Slug,
+				"details":    err.Error(),
+			})
+			return
+		}
+	}
+
+	params, validationErrors := h.extractAndValidateParams(c, query, true)
 	if len(validationErrors) > 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":      "Parametros invalidos",
@@ -83,35 +116,62 @@ func (h *DynamicQueryHandler) Execute(c *gin.Context) {
 		return
 	}
 
-	cacheKey := h.buildCacheKey(slug, c, query.Parameters)
+	quotaSubjects := h.quotaSubjects(c, query)
+	quotaStatuses, ok := h.checkQuota(c, query, quotaSubjects, params, startTime)
+	if !ok {
+		return
+	}
+
+	// Cada versao tem seu proprio cache, para nao misturar resultados de SQLs diferentes
+	cacheSlug := slug
+	if query.Version > 0 {
+		cacheSlug = fmt.Sprintf("%s:v%d", slug, query.Version)
+	}
+	cacheKey := h.buildCacheKey(cacheSlug, query.Parameters, params)
 	args := h.buildQueryArgs(params, query.Parameters)
 
 	queryCtx, cancel := context.WithTimeout(ctx, time.Duration(query.TimeoutSeconds)*time.Second)
 	defer cancel()
 
-	results, cacheHit, err := h.executeWithCache(queryCtx, cacheKey, query.CacheTTL, query, datasource, args)
+	executionStart := time.Now()
+	results, cacheHit, endpoint, err := h.executeWithCache(queryCtx, cacheKey, query.CacheTTL, query, datasource, args)
+	executionTime := time.Since(executionStart)
 	duration := time.Since(startTime)
 
-	go h.logExecution(query, params, duration, cacheHit, results, err, c)
+	// O registro e montado aqui: o contexto do Gin nao pode ser usado depois
+	// que o handler retorna
+	go h.logExecution(newExecution(c, query, params, duration, cacheHit, results, err))
+
+	h.recordQuota(c, quotaSubjects, quotaStatuses, executionUsage(results, cacheHit, executionTime, err))
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":      "Erro ao executar query",
-			"slug":       slug,
-			"datasource": datasource.Slug,
-			"details":    err.Error(),
-			"duration":   duration.String(),
-		})
+		h.respondExecutionError(c, slug, datasource, err, duration)
 		return
 	}
 
+	// O cache guarda os dados completos; cada requisicao mascara a sua copia
+	// conforme as roles de quem chamou
+	h.masker.Apply(results, query.ColumnPolicies, middleware.PrincipalFromContext(c))
+
+	var servedBy interface{}
+	if endpoint != "" {
+		servedBy = endpoint
+	}
+
+	if query.Status == models.QueryStatusDeprecated {
+		c.Header("Deprecation", "true")
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data": results,
 		"meta": gin.H{
 			"slug":       slug,
 			"name":       query.Name,
+			"version":    query.Version,
+			"status":     query.Status,
 			"datasource": datasource.Slug,
 			"driver":     datasource.Driver,
+			"endpoint":   servedBy,
 			"count":      len(results),
 			"cache_hit":  cacheHit,
 			"duration":   duration.String(),
@@ -120,6 +180,357 @@ func (h *DynamicQueryHandler) Execute(c *gin.Context) {
 	})
 }
 
+// Explain valida os parametros e devolve o plano de execucao da query sem
+// executa-la. Aceita queries inativas, para revisao antes de publicar.
+// GET /api/admin/queries/:slug/explain?param1=value1
+func (h *DynamicQueryHandler) Explain(c *gin.Context) {
+	slug := c.Param("slug")
+	startTime := time.Now()
+
+	ctx := c.Request.Context()
+
+	query, err := h.queryRepo.FindBySlugAny(ctx, slug)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Query nao encontrada",
+			"slug":    slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	query, ok := h.resolveVersion(c, query, true)
+	if !ok {
+		return
+	}
+
+	if query.DatasourceID == nil || *query.DatasourceID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Query nao possui datasource vinculado",
+			"slug":  slug,
+		})
+		return
+	}
+
+	datasource, err := h.datasourceRepo.FindByID(ctx, *query.DatasourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao buscar datasource",
+			"slug":    slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	// Mesmo sem executar, so gera plano para SQL que poderia ser executado
+	if !datasource.AllowWrites {
+		if err := database.CheckReadOnlySQL(query.SQLQuery); err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Query contem comandos de escrita",
+				"code":       "write_not_allowed",
+				"slug":       slug,
+				"datasource": datasource.Slug,
+				"details":    err.Error(),
+			})
+			return
+		}
+	}
+
+	// No explain o admin informa na query string o valor dos parametros
+	// vinculados, para ver o plano de qualquer filial/tenant
+	params, validationErrors := h.extractAndValidateParams(c, query, false)
+	if len(validationErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Parametros invalidos",
+			"slug":       slug,
+			"validation": validationErrors,
+		})
+		return
+	}
+
+	args := h.buildQueryArgs(params, query.Parameters)
+
+	queryCtx, cancel := context.WithTimeout(ctx, time.Duration(query.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	opts := database.QueryOptions{
+		QueryKey:       query.Slug,
+		MaxConcurrency: query.MaxConcurrency,
+	}
+	plan, err := h.connManager.Explain(queryCtx, *datasource, opts, query.SQLQuery, args...)
+
+	var openErr *database.CircuitOpenError
+	var limitErr *database.LimitExceededError
+	if errors.As(err, &openErr) || errors.As(err, &limitErr) {
+		h.respondExecutionError(c, slug, datasource, err, time.Since(startTime))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":      "Erro ao gerar plano de execucao",
+			"code":       "explain_failed",
+			"slug":       slug,
+			"datasource": datasource.Slug,
+			"details":    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": plan,
+		"meta": gin.H{
+			"slug":       slug,
+			"name":       query.Name,
+			"version":    query.Version,
+			"status":     query.Status,
+			"datasource": datasource.Slug,
+			"is_active":  query.IsActive,
+			"duration":   time.Since(startTime).String(),
+			"parameters": params,
+		},
+	})
+}
+
+// resolveVersion escolhe a definicao que sera executada. Para consumidores
+// vale, nesta ordem: a versao pedida no header X-Query-Version (ou ?version=,
+// quando a query nao tem um parametro com esse nome), a versao fixada e a
+// versao publicada. Versoes nao aprovadas e queries que nunca foram publicadas
+// so podem ser executadas pelo autor. Em preview (dry-run do admin) qualquer
+// versao e aceita e o padrao e a definicao atual.
+func (h *DynamicQueryHandler) resolveVersion(c *gin.Context, query *models.Query, preview bool) (*models.Query, bool) {
+	ctx := c.Request.Context()
+
+	requested := c.GetHeader("X-Query-Version")
+	if requested == "" && !hasParameter(query, "version") {
+		requested = c.Query("version")
+	}
+
+	number := 0
+	if requested != "" {
+		n, err := strconv.Atoi(requested)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Versao invalida",
+				"code":  "invalid_version",
+				"slug":  query.Slug,
+			})
+			return nil, false
+		}
+		number = n
+	} else if !preview {
+		if query.PinnedVersion != nil {
+			number = *query.PinnedVersion
+		} else if query.PublishedVersion != nil {
+			number = *query.PublishedVersion
+		}
+	}
+
+	if number == 0 {
+		// Leitura apenas: versoes sao gravadas ao salvar e ao enviar para revisao
+		version, err := h.queryRepo.CurrentVersion(ctx, query)
+		if err != nil {
+			fmt.Printf("[Versions] Erro ao buscar versao da query '%s': %v\n", query.Slug, err)
+		}
+		query.Version = version
+
+		// Sem versao publicada, a definicao atual ainda nao foi aprovada
+		published := version > 0 && query.PublishedVersion != nil && *query.PublishedVersion == version
+		if !preview && !published && !isAuthor(c, query.UpdatedBy, query.CreatedBy) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Query nao publicada",
+				"code":  "query_not_published",
+				"slug":  query.Slug,
+			})
+			return nil, false
+		}
+
+		return query, true
+	}
+
+	version, err := h.queryRepo.FindVersion(ctx, query.ID, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Versao nao encontrada",
+			"code":    "version_not_found",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	if !preview && version.ApprovedAt == nil && !isAuthor(c, version.CreatedBy) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "Versao nao publicada",
+			"code":    "version_not_published",
+			"slug":    query.Slug,
+			"version": number,
+		})
+		return nil, false
+	}
+
+	resolved, err := queryFromVersion(query, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao ler versao",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	if err := enforceBindings(query, resolved); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Versao incompativel com os parametros vinculados da query",
+			"code":    "version_missing_binding",
+			"slug":    query.Slug,
+			"version": number,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	return resolved, true
+}
+
+// servedQuery devolve a definicao que os consumidores executam por padrao (a
+// versao fixada ou a publicada), para que a listagem mostre os parametros que
+// a execucao vai aceitar e nao os do draft em edicao.
+func (h *DynamicQueryHandler) servedQuery(ctx context.Context, query *models.Query) (*models.Query, error) {
+	number := 0
+	if query.PinnedVersion != nil {
+		number = *query.PinnedVersion
+	} else if query.PublishedVersion != nil {
+		number = *query.PublishedVersion
+	}
+	if number == 0 {
+		return query, nil
+	}
+
+	version, err := h.queryRepo.FindVersion(ctx, query.ID, number)
+	if err != nil {
+		return nil, err
+	}
+
+	served, err := queryFromVersion(query, version)
+	if err != nil {
+		return nil, err
+	}
+	if err := enforceBindings(query, served); err != nil {
+		return nil, err
+	}
+	return served, nil
+}
+
+// findExecutable busca a query servida aos consumidores. Uma query que ainda
+// nao foi publicada so e encontrada pelo seu autor, para testes.
+func (h *DynamicQueryHandler) findExecutable(c *gin.Context, slug string) (*models.Query, error) {
+	ctx := c.Request.Context()
+
+	query, err := h.queryRepo.FindBySlug(ctx, slug)
+	if err == nil {
+		return query, nil
+	}
+
+	if _, ok := requestAuthor(c); ok {
+		draft, draftErr := h.queryRepo.FindBySlugAny(ctx, slug)
+		if draftErr == nil && draft.IsActive && isAuthor(c, draft.UpdatedBy, draft.CreatedBy) {
+			return draft, nil
+		}
+	}
+
+	return nil, err
+}
+
+// requestAuthor identifica o autor que esta testando um draft pelo nome da
+// admin key nomeada da requisicao.
+func requestAuthor(c *gin.Context) (string, bool) {
+	return middleware.AdminIdentity(c)
+}
+
+func isAuthor(c *gin.Context, authors ...*string) bool {
+	actor, ok := requestAuthor(c)
+	if !ok {
+		return false
+	}
+	for _, author := range authors {
+		if author != nil && *author == actor {
+			return true
+		}
+	}
+	return false
+}
+
+func hasParameter(query *models.Query, name string) bool {
+	for _, p := range query.Parameters {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *DynamicQueryHandler) respondExecutionError(
+	c *gin.Context,
+	slug string,
+	datasource *database.DatasourceConfig,
+	err error,
+	duration time.Duration,
+) {
+	var openErr *database.CircuitOpenError
+	if errors.As(err, &openErr) {
+		c.Header("Retry-After", strconv.Itoa(openErr.RetryAfterSeconds()))
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":       "Datasource temporariamente indisponivel",
+			"code":        "datasource_unavailable",
+			"slug":        slug,
+			"datasource":  datasource.Slug,
+			"details":     err.Error(),
+			"retry_after": openErr.RetryAfterSeconds(),
+		})
+		return
+	}
+
+	var timeoutErr *database.StatementTimeoutError
+	if errors.As(err, &timeoutErr) || errors.Is(err, context.DeadlineExceeded) {
+		c.JSON(http.StatusGatewayTimeout, gin.H{
+			"error":      "Tempo limite da query excedido",
+			"code":       "query_timeout",
+			"slug":       slug,
+			"datasource": datasource.Slug,
+			"details":    err.Error(),
+			"duration":   duration.String(),
+		})
+		return
+	}
+
+	var limitErr *database.LimitExceededError
+	if errors.As(err, &limitErr) {
+		status := http.StatusServiceUnavailable
+		code := "queue_timeout"
+		if limitErr.Saturated {
+			status = http.StatusTooManyRequests
+			code = "concurrency_limit"
+		}
+		c.Header("Retry-After", "1")
+		c.JSON(status, gin.H{
+			"error":      "Limite de execucoes simultaneas atingido",
+			"code":       code,
+			"slug":       slug,
+			"datasource": datasource.Slug,
+			"details":    err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":      "Erro ao executar query",
+		"slug":       slug,
+		"datasource": datasource.Slug,
+		"details":    err.Error(),
+		"duration":   duration.String(),
+	})
+}
+
 func (h *DynamicQueryHandler) executeWithCache(
 	ctx context.Context,
 	cacheKey string,
@@ -127,8 +538,9 @@ func (h *DynamicQueryHandler) executeWithCache(
 	query *models.Query,
 	datasource *database.DatasourceConfig,
 	args []interface{},
-) ([]map[string]interface{}, bool, error) {
+) ([]map[string]interface{}, bool, string, error) {
 	var cacheHit bool = true
+	var endpoint string
 	var results []map[string]interface{}
 
 	data, err := h.cacheService.GetOrSet(ctx, cacheKey, cacheTTL, func() (interface{}, error) {
@@ -136,11 +548,21 @@ func (h *DynamicQueryHandler) executeWithCache(
 		fmt.Printf("[Query] Executando '%s' no datasource '%s' (%s)...\n",
 			query.Slug, datasource.Slug, datasource.Driver)
 
-		return h.connManager.Query(ctx, *datasource, query.SQLQuery, args...)
+		opts := database.QueryOptions{
+			QueryKey:       query.Slug,
+			MaxConcurrency: query.MaxConcurrency,
+		}
+		result, err := h.connManager.QueryWithOptions(ctx, *datasource, opts, query.SQLQuery, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		endpoint = result.Endpoint
+		return result.Rows, nil
 	})
 
 	if err != nil {
-		return nil, false, err
+		return nil, false, "", err
 	}
 
 	if cacheHit {
@@ -149,25 +571,62 @@ func (h *DynamicQueryHandler) executeWithCache(
 
 	jsonData, err := json.Marshal(data)
 	if err != nil {
-		return nil, cacheHit, err
+		return nil, cacheHit, endpoint, err
 	}
 
 	if err := json.Unmarshal(jsonData, &results); err != nil {
-		return nil, cacheHit, err
+		return nil, cacheHit, endpoint, err
 	}
 
-	return results, cacheHit, nil
+	return results, cacheHit, endpoint, nil
 }
 
+// extractAndValidateParams le e converte os parametros da query string. Com
+// bindFromPrincipal, os parametros com bind_from recebem o valor da credencial
+// e o cliente nao pode informa-los. Os valores enviados pelo cliente passam
+// pela politica do parametro (validations); cada recusa vira um evento de
+// seguranca no log.
 func (h *DynamicQueryHandler) extractAndValidateParams(
 	c *gin.Context,
 	query *models.Query,
+	bindFromPrincipal bool,
 ) (map[string]interface{}, map[string]string) {
 	params := make(map[string]interface{})
 	errors := make(map[string]string)
 
 	for _, p := range query.Parameters {
-		rawValue := c.Query(p.Name)
+		rawValue, sent := c.GetQuery(p.Name)
+
+		if p.BindFrom != nil && bindFromPrincipal {
+			if sent {
+				errors[p.Name] = "parametro vinculado a credencial: nao pode ser informado"
+				middleware.LogSecurityEvent(c, "bound_parameter_sent",
+					"slug", query.Slug, "param", p.Name, "length", strconv.Itoa(utf8.RuneCountInString(rawValue)))
+				continue
+			}
+			value, ok := middleware.PrincipalFromContext(c).Attribute(*p.BindFrom)
+			if !ok {
+				errors[p.Name] = fmt.Sprintf("credencial sem o atributo '%s'", *p.BindFrom)
+				continue
+			}
+			rawValue = value
+		}
+
+		policy, err := paramcheck.Parse(p.ParamType, p.Validations)
+		if err != nil {
+			fmt.Printf("[Query] Politica invalida no parametro '%s' da query '%s': %v\n", p.Name, query.Slug, err)
+			errors[p.Name] = "politica de validacao do parametro invalida"
+			continue
+		}
+
+		if sent {
+			sanitized, err := policy.Sanitize(rawValue)
+			if err != nil {
+				errors[p.Name] = rejectParam(c, query, p, rawValue, err)
+				continue
+			}
+			rawValue = sanitized
+		}
 
 		if rawValue == "" {
 			if p.IsRequired {
@@ -181,50 +640,70 @@ func (h *DynamicQueryHandler) extractAndValidateParams(
 			}
 		}
 
-		converted, err := h.convertParamType(rawValue, p.ParamType)
+		converted, err := paramcheck.Convert(rawValue, p.ParamType)
 		if err != nil {
-			errors[p.Name] = fmt.Sprintf("tipo invalido: esperado %s, erro: %s", p.ParamType, err.Error())
+			typeErr := &paramcheck.Violation{
+				Rule:    "type",
+				Message: fmt.Sprintf("tipo invalido: esperado %s, erro: %s", p.ParamType, err.Error()),
+			}
+			if sent {
+				errors[p.Name] = rejectParam(c, query, p, rawValue, typeErr)
+			} else {
+				errors[p.Name] = typeErr.Message
+			}
 			continue
 		}
 
+		if sent {
+			if err := policy.Check(rawValue, converted); err != nil {
+				errors[p.Name] = rejectParam(c, query, p, rawValue, err)
+				continue
+			}
+		}
+
 		params[p.Name] = converted
 	}
 
 	return params, errors
 }
 
-func (h *DynamicQueryHandler) convertParamType(value string, paramType string) (interface{}, error) {
-	switch paramType {
-	case "string":
-		return value, nil
-	case "integer":
-		return strconv.Atoi(value)
-	case "number":
-		return strconv.ParseFloat(value, 64)
-	case "boolean":
-		return strconv.ParseBool(value)
-	case "date":
-		return time.Parse("2006-01-02", value)
-	case "datetime":
-		return time.Parse("2006-01-02 15:04:05", value)
-	default:
-		return value, nil
+// rejectParam registra a recusa de um valor enviado pelo cliente como evento
+// de seguranca e devolve a mensagem de validacao. O log leva a regra e o
+// tamanho do valor, nunca o valor: ele pode ser um CPF ou um email.
+func rejectParam(c *gin.Context, query *models.Query, param models.QueryParameter, value string, err error) string {
+	rule := "policy"
+	var violation *paramcheck.Violation
+	if errors.As(err, &violation) {
+		rule = violation.Rule
 	}
+
+	middleware.LogSecurityEvent(c, "parameter_rejected",
+		"slug", query.Slug, "param", param.Name, "type", param.ParamType, "rule", rule,
+		"length", strconv.Itoa(utf8.RuneCountInString(value)))
+
+	return err.Error()
 }
 
+// buildCacheKey monta a chave com os valores ja sanitizados e convertidos de
+// cada parametro, para que " 10" (com trim) e "10", ou "010" e "10" em
+// integer, caiam na mesma entrada. Os vinculados a credencial entram pelo
+// valor resolvido, para que cada filial/tenant tenha o seu cache.
 func (h *DynamicQueryHandler) buildCacheKey(
 	slug string,
-	c *gin.Context,
 	definitions []models.QueryParameter,
+	params map[string]interface{},
 ) string {
 	key := fmt.Sprintf("query:%s", slug)
 
 	for _, def := range definitions {
-		rawValue := c.Query(def.Name)
-		if rawValue == "" && def.DefaultValue != nil {
-			rawValue = *def.DefaultValue
+		value, ok := params[def.Name]
+		if !ok {
+			value = ""
+		}
+		if t, isTime := value.(time.Time); isTime {
+			value = t.Format(time.RFC3339Nano)
 		}
-		key += fmt.Sprintf(":%s=%s", def.Name, rawValue)
+		key += fmt.Sprintf(":%s=%v", def.Name, value)
 	}
 
 	return key
@@ -256,15 +735,55 @@ func (h *DynamicQueryHandler) buildQueryArgs(
 	return args
 }
 
-func (h *DynamicQueryHandler) logExecution(
+// authorize confere os scopes da credencial e as ACLs da query e do
+// datasource antes de qualquer execucao. A recusa responde 403 e entra no log
+// de execucoes.
+func (h *DynamicQueryHandler) authorize(c *gin.Context, query *models.Query, datasource *database.DatasourceConfig, startTime time.Time) bool {
+	principal := middleware.PrincipalFromContext(c)
+
+	var code, reason string
+	switch {
+	case !principal.Allows(query.Slug, datasource.Slug, query.Tags):
+		code, reason = "scope_denied", "query fora dos scopes da credencial"
+	case !principal.HasAnyRole(query.AllowedRoles):
+		code, reason = "access_denied", "nenhuma role com acesso a query"
+	case !principal.HasAnyRole(datasource.AllowedRoles):
+		code, reason = "access_denied", "nenhuma role com acesso ao datasource"
+	default:
+		return true
+	}
+
+	execution := newExecution(c, query, nil, time.Since(startTime), false, nil, errors.New(reason))
+	execution.Denied = true
+	go h.logExecution(execution)
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":      "Sem permissao para esta query",
+		"code":       code,
+		"slug":       query.Slug,
+		"datasource": datasource.Slug,
+		"details":    reason,
+	})
+	return false
+}
+
+// canList diz se a query aparece na listagem do chamador: so entram as que
+// ele conseguiria executar.
+func canList(principal *models.Principal, q *models.Query) bool {
+	return principal.Allows(q.Slug, derefString(q.DatasourceSlug), q.Tags) &&
+		principal.HasAnyRole(q.AllowedRoles) &&
+		principal.HasAnyRole(q.DatasourceAllowedRoles)
+}
+
+func newExecution(
+	c *gin.Context,
 	query *models.Query,
 	params map[string]interface{},
 	duration time.Duration,
 	cacheHit bool,
 	results []map[string]interface{},
 	execError error,
-	c *gin.Context,
-) {
+) models.QueryExecution {
 	paramsJSON, _ := json.Marshal(params)
 
 	var errMsg *string
@@ -284,7 +803,14 @@ func (h *DynamicQueryHandler) logExecution(
 		ClientIP:   stringPtr(c.ClientIP()),
 		UserAgent:  stringPtr(c.Request.UserAgent()),
 	}
+	if principal := middleware.PrincipalFromContext(c); principal != nil {
+		execution.Principal = &principal.Subject
+	}
+
+	return execution
+}
 
+func (h *DynamicQueryHandler) logExecution(execution models.QueryExecution) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
@@ -297,7 +823,7 @@ func stringPtr(s string) *string {
 	return &s
 }
 
-// ListQueries lista todas as queries ativas.
+// ListQueries lista as queries ativas que o chamador pode executar.
 // GET /api/queries
 func (h *DynamicQueryHandler) ListQueries(c *gin.Context) {
 	ctx := c.Request.Context()
@@ -310,16 +836,29 @@ func (h *DynamicQueryHandler) ListQueries(c *gin.Context) {
 		return
 	}
 
+	principal := middleware.PrincipalFromContext(c)
+
 	var endpoints []gin.H
 	for _, q := range queries {
+		if !canList(principal, &q) {
+			continue
+		}
+
+		served, err := h.servedQuery(ctx, &q)
+		if err != nil {
+			fmt.Printf("[Catalog] Query '%s' fora da listagem: %v\n", q.Slug, err)
+			continue
+		}
+
 		endpoint := gin.H{
 			"slug":        q.Slug,
-			"name":        q.Name,
-			"description": q.Description,
+			"name":        served.Name,
+			"description": served.Description,
 			"endpoint":    fmt.Sprintf("/api/query/%s", q.Slug),
-			"cache_ttl":   q.CacheTTL,
+			"cache_ttl":   served.CacheTTL,
 			"datasource":  q.DatasourceSlug,
-			"parameters":  q.Parameters,
+			"tags":        served.Tags,
+			"parameters":  served.Parameters,
 		}
 		endpoints = append(endpoints, endpoint)
 	}
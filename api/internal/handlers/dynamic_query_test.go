@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/middleware"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanList(t *testing.T) {
+	erp := "erp"
+	query := &models.Query{
+		Slug:                   "vendas",
+		DatasourceSlug:         &erp,
+		AllowedRoles:           []string{"vendas"},
+		DatasourceAllowedRoles: []string{"vendas", "financeiro"},
+	}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		want      bool
+	}{
+		{"role da query e do datasource", &models.Principal{Roles: []string{"vendas"}}, true},
+		{"so a role do datasource", &models.Principal{Roles: []string{"financeiro"}}, false},
+		{"fora dos scopes", &models.Principal{Roles: []string{"vendas"}, Restricted: true, Scopes: []models.Scope{{Queries: []string{"outra"}}}}, false},
+		{"admin", &models.Principal{Admin: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := canList(tt.principal, query); got != tt.want {
+				t.Fatalf("canList() = %v, esperava %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeKeys autentica qualquer chave com os atributos informados.
+type fakeKeys map[string]string
+
+func (f fakeKeys) Authenticate(ctx context.Context, key string) (*models.APIKey, error) {
+	if key == "" {
+		return nil, errors.New("sem chave")
+	}
+	return &models.APIKey{Name: "loja", Prefix: "abc", Attributes: f}, nil
+}
+
+// boundParams passa a requisicao pelo APIKeyAuth e devolve o resultado da
+// validacao dos parametros da query.
+func boundParams(t *testing.T, keys fakeKeys, rawQuery string, bindFromPrincipal bool) (map[string]interface{}, map[string]string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	tenant := "tenant_id"
+	query := &models.Query{
+		Slug: "pedidos",
+		Parameters: []models.QueryParameter{
+			{Name: "loja", ParamType: "integer", IsRequired: true, BindFrom: &tenant},
+			{Name: "status", ParamType: "string"},
+		},
+	}
+
+	auth := middleware.NewAuthConfig()
+	auth.SetEnabled(true)
+	auth.Keys = keys
+
+	var params map[string]interface{}
+	var validation map[string]string
+	router := gin.New()
+	router.GET("/pedidos", middleware.APIKeyAuth(auth), func(c *gin.Context) {
+		params, validation = (&DynamicQueryHandler{}).extractAndValidateParams(c, query, bindFromPrincipal)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/pedidos?"+rawQuery, nil)
+	req.Header.Set("X-API-Key", "qb_abc_segredo")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+	}
+	return params, validation
+}
+
+func TestBoundParameterComesFromCredential(t *testing.T) {
+	params, validation := boundParams(t, fakeKeys{"tenant_id": "42"}, "status=aberto", true)
+	if len(validation) != 0 {
+		t.Fatalf("erros de validacao: %v", validation)
+	}
+	if params["loja"] != 42 || params["status"] != "aberto" {
+		t.Fatalf("params = %v", params)
+	}
+}
+
+func TestBoundParameterRefusesOverride(t *testing.T) {
+	params, validation := boundParams(t, fakeKeys{"tenant_id": "42"}, "loja=7", true)
+	if !strings.Contains(validation["loja"], "vinculado a credencial") {
+		t.Fatalf("loja informada na URL foi aceita: params = %v, erros = %v", params, validation)
+	}
+	if _, ok := params["loja"]; ok {
+		t.Fatal("valor do cliente chegou aos parametros")
+	}
+
+	// Parametro vazio tambem conta como tentativa de sobrescrever
+	if _, validation := boundParams(t, fakeKeys{"tenant_id": "42"}, "loja=", true); validation["loja"] == "" {
+		t.Fatal("loja vazia na URL foi aceita")
+	}
+}
+
+func TestBoundParameterWithoutAttribute(t *testing.T) {
+	_, validation := boundParams(t, fakeKeys{"outro": "1"}, "", true)
+	if !strings.Contains(validation["loja"], "tenant_id") {
+		t.Fatalf("erros = %v, esperava atributo ausente", validation)
+	}
+}
+
+func TestBoundParameterOnExplain(t *testing.T) {
+	// No explain o admin informa o valor na URL
+	params, validation := boundParams(t, fakeKeys{"tenant_id": "42"}, "loja=7", false)
+	if len(validation) != 0 || params["loja"] != 7 {
+		t.Fatalf("params = %v, erros = %v", params, validation)
+	}
+}
+
+func TestRespondExecutionErrorTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	datasource := &database.DatasourceConfig{Slug: "erp"}
+
+	for _, err := range []error{
+		&database.StatementTimeoutError{Timeout: 30 * time.Second, CancelledOnServer: true, Err: errors.New("canceling statement due to statement timeout")},
+		fmt.Errorf("erro ao executar query: %w", context.DeadlineExceeded),
+	} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+
+		(&DynamicQueryHandler{}).respondExecutionError(c, "vendas", datasource, err, 30*time.Second)
+
+		var body map[string]interface{}
+		if jsonErr := json.Unmarshal(w.Body.Bytes(), &body); jsonErr != nil {
+			t.Fatal(jsonErr)
+		}
+		if w.Code != http.StatusGatewayTimeout || body["code"] != "query_timeout" {
+			t.Fatalf("%v: status %d, code %v; esperava 504 query_timeout", err, w.Code, body["code"])
+		}
+	}
+
+	// Erro comum da query continua 500
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	(&DynamicQueryHandler{}).respondExecutionError(c, "vendas", datasource, errors.New("syntax error"), time.Second)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d para erro de SQL, esperava 500", w.Code)
+	}
+}
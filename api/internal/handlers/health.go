@@ -3,13 +3,46 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/adolp26/querybase/internal/database"
 	"github.com/gin-gonic/gin"
 )
 
-func HealthCheck(c *gin.Context) {
+type HealthHandler struct {
+	connManager *database.ConnectionManager
+}
+
+func NewHealthHandler(connManager *database.ConnectionManager) *HealthHandler {
+	return &HealthHandler{
+		connManager: connManager,
+	}
+}
+
+// HealthCheck sempre responde 200 enquanto a API estiver de pe; datasources
+// fora do ar so mudam o status para "degraded". O endpoint e publico, entao
+// so devolve contagens: slugs, erros e estado dos breakers ficam em
+// /api/admin/datasources/status.
+func (h *HealthHandler) HealthCheck(c *gin.Context) {
+	datasources := h.connManager.Status()
+
+	unavailable := 0
+	for _, ds := range datasources {
+		if ds.State != database.PoolHealthy || (ds.Breaker != nil && ds.Breaker.State != database.BreakerClosed) {
+			unavailable++
+		}
+	}
+
+	status := "healthy"
+	if unavailable > 0 {
+		status = "degraded"
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status":  "healthy",
+		"status":  status,
 		"service": "QueryBase API",
 		"version": "1.0.0",
+		"datasources": gin.H{
+			"total":       len(datasources),
+			"unavailable": unavailable,
+		},
 	})
 }
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	connManager *database.ConnectionManager
+}
+
+func NewMetricsHandler(connManager *database.ConnectionManager) *MetricsHandler {
+	return &MetricsHandler{
+		connManager: connManager,
+	}
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	samples []string
+}
+
+func (m *metricFamily) add(labels string, value interface{}) {
+	m.samples = append(m.samples, fmt.Sprintf("%s{%s} %v", m.name, labels, value))
+}
+
+// Metrics exporta o estado dos pools no formato texto do Prometheus.
+// GET /metrics
+func (h *MetricsHandler) Metrics(c *gin.Context) {
+	families := map[string]*metricFamily{}
+	var order []string
+
+	family := func(name, kind, help string) *metricFamily {
+		if f, exists := families[name]; exists {
+			return f
+		}
+		f := &metricFamily{name: name, kind: kind, help: help}
+		families[name] = f
+		order = append(order, name)
+		return f
+	}
+
+	for _, p := range h.connManager.PoolStats() {
+		labels := metricLabels("datasource", p.Slug, "endpoint", p.Endpoint, "role", p.Role, "driver", p.Driver)
+
+		up := 0
+		if p.State != database.PoolDown {
+			up = 1
+		}
+		family("querybase_pool_up", "gauge", "1 se o pool nao esta down").add(labels, up)
+		family("querybase_pool_max_open_connections", "gauge", "Limite de conexoes abertas do pool").add(labels, p.MaxOpenConnections)
+		family("querybase_pool_open_connections", "gauge", "Conexoes abertas (em uso + ociosas)").add(labels, p.OpenConnections)
+		family("querybase_pool_in_use_connections", "gauge", "Conexoes em uso").add(labels, p.InUse)
+		family("querybase_pool_idle_connections", "gauge", "Conexoes ociosas").add(labels, p.Idle)
+		family("querybase_pool_active_queries", "gauge", "Execucoes em andamento no pool").add(labels, p.ActiveQueries)
+		family("querybase_pool_wait_count_total", "counter", "Total de esperas por uma conexao livre").add(labels, p.WaitCount)
+		family("querybase_pool_wait_duration_seconds_total", "counter", "Tempo total esperando por conexao").add(labels, float64(p.WaitDurationMs)/1000)
+		family("querybase_pool_max_idle_closed_total", "counter", "Conexoes fechadas por SetMaxIdleConns").add(labels, p.MaxIdleClosed)
+		family("querybase_pool_max_idle_time_closed_total", "counter", "Conexoes fechadas por SetConnMaxIdleTime").add(labels, p.MaxIdleTimeClosed)
+		family("querybase_pool_max_lifetime_closed_total", "counter", "Conexoes fechadas por SetConnMaxLifetime").add(labels, p.MaxLifetimeClosed)
+
+		if p.LastSuccessAt != nil {
+			family("querybase_pool_last_success_timestamp_seconds", "gauge", "Horario da ultima execucao com sucesso").add(labels, p.LastSuccessAt.Unix())
+		}
+		if p.LastErrorAt != nil {
+			family("querybase_pool_last_error_timestamp_seconds", "gauge", "Horario do ultimo erro de execucao").add(labels, p.LastErrorAt.Unix())
+		}
+	}
+
+	var out strings.Builder
+	for _, name := range order {
+		f := families[name]
+		fmt.Fprintf(&out, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&out, "# TYPE %s %s\n", f.name, f.kind)
+		for _, sample := range f.samples {
+			out.WriteString(sample)
+			out.WriteByte('\n')
+		}
+	}
+
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(out.String()))
+}
+
+// metricLabels monta os labels no formato nome="valor", escapando os valores.
+func metricLabels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+	labels := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+
+	return strings.Join(labels, ",")
+}
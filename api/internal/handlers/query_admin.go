@@ -0,0 +1,679 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/adolp26/querybase/internal/catalog"
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/masking"
+	"github.com/adolp26/querybase/internal/middleware"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/paramcheck"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/adolp26/querybase/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	slugPattern      = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,99}$`)
+	paramNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,99}$`)
+
+	// bind_from aceita caminhos de claim com ponto, como "tenant.branch_id"
+	bindFromPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+	validColumnActions = map[string]bool{
+		models.ColumnPolicyHide:     true,
+		models.ColumnPolicyMask:     true,
+		models.ColumnPolicyHash:     true,
+		models.ColumnPolicyTruncate: true,
+	}
+
+	validParamTypes = map[string]bool{
+		"string":   true,
+		"integer":  true,
+		"number":   true,
+		"boolean":  true,
+		"date":     true,
+		"datetime": true,
+	}
+)
+
+// QueryAdminHandler expoe o CRUD de queries e parametros, para gerenciar os
+// endpoints sem a interface Laravel.
+type QueryAdminHandler struct {
+	queryRepo      *repository.QueryRepository
+	datasourceRepo *repository.DatasourceRepository
+	cacheService   *services.CacheService
+	masker         *masking.Masker
+}
+
+func NewQueryAdminHandler(
+	queryRepo *repository.QueryRepository,
+	datasourceRepo *repository.DatasourceRepository,
+	cacheService *services.CacheService,
+	masker *masking.Masker,
+) *QueryAdminHandler {
+	return &QueryAdminHandler{
+		queryRepo:      queryRepo,
+		datasourceRepo: datasourceRepo,
+		cacheService:   cacheService,
+		masker:         masker,
+	}
+}
+
+type queryRequest struct {
+	Slug           string                `json:"slug"`
+	Name           string                `json:"name"`
+	Description    *string               `json:"description"`
+	SQLQuery       string                `json:"sql_query"`
+	Datasource     string                `json:"datasource"`
+	CacheTTL       *int                  `json:"cache_ttl"`
+	TimeoutSeconds *int                  `json:"timeout_seconds"`
+	MaxConcurrency int                   `json:"max_concurrency"`
+	Tags           []string              `json:"tags"`
+	AllowedRoles   []string              `json:"allowed_roles"`
+	ColumnPolicies []models.ColumnPolicy `json:"column_policies"`
+	Quota          *models.Quota         `json:"quota"`
+	IsActive       *bool                 `json:"is_active"`
+	Parameters     []parameterRequest    `json:"parameters"`
+}
+
+type parameterRequest struct {
+	Name         string          `json:"name"`
+	ParamType    string          `json:"param_type"`
+	IsRequired   bool            `json:"is_required"`
+	DefaultValue *string         `json:"default_value"`
+	Description  *string         `json:"description"`
+	Position     int             `json:"position"`
+	Validations  json.RawMessage `json:"validations"`
+	BindFrom     *string         `json:"bind_from"`
+}
+
+func (p parameterRequest) toModel() models.QueryParameter {
+	param := models.QueryParameter{
+		Name:         p.Name,
+		ParamType:    p.ParamType,
+		IsRequired:   p.IsRequired,
+		DefaultValue: p.DefaultValue,
+		Description:  p.Description,
+		Position:     p.Position,
+	}
+	if p.BindFrom != nil && strings.TrimSpace(*p.BindFrom) != "" {
+		bindFrom := strings.TrimSpace(*p.BindFrom)
+		param.BindFrom = &bindFrom
+	}
+	if param.ParamType == "" {
+		param.ParamType = "string"
+	}
+	if len(p.Validations) > 0 && string(p.Validations) != "null" {
+		validations := string(p.Validations)
+		param.Validations = &validations
+	}
+	return param
+}
+
+// requestActor identifica quem fez a alteracao. Com uma admin key nomeada vale
+// o nome dela; com as demais, o header X-Actor so nomeia (sem garantia) a
+// pessoa ou automacao por tras da chave e nunca identifica um revisor.
+func requestActor(c *gin.Context) string {
+	if name, ok := middleware.AdminIdentity(c); ok {
+		return name
+	}
+	if actor := strings.TrimSpace(c.GetHeader("X-Actor")); actor != "" {
+		return "unverified:" + actor
+	}
+	return "admin-api"
+}
+
+// List lista todas as queries, inclusive as inativas.
+// GET /api/admin/queries
+func (h *QueryAdminHandler) List(c *gin.Context) {
+	queries, err := h.queryRepo.ListAll(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar queries",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"queries": queries,
+		"count":   len(queries),
+	})
+}
+
+// Get devolve a definicao completa de uma query.
+// GET /api/admin/queries/:slug
+func (h *QueryAdminHandler) Get(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query})
+}
+
+// Create cadastra uma query com seus parametros.
+// POST /api/admin/queries
+func (h *QueryAdminHandler) Create(c *gin.Context) {
+	var req queryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	query := &models.Query{IsActive: true}
+	actor := requestActor(c)
+	query.CreatedBy = &actor
+	query.UpdatedBy = &actor
+
+	if !h.applyRequest(c, query, req) {
+		return
+	}
+
+	if err := h.queryRepo.Create(c.Request.Context(), query); err != nil {
+		respondWriteError(c, query.Slug, "Erro ao criar query", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"query": query})
+}
+
+// Update substitui a definicao da query e todos os seus parametros.
+// PUT /api/admin/queries/:slug
+func (h *QueryAdminHandler) Update(c *gin.Context) {
+	current, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	var req queryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+	if req.Slug == "" {
+		req.Slug = current.Slug
+	}
+
+	query := *current
+	query.Parameters = nil
+	if !h.applyRequest(c, &query, req) {
+		return
+	}
+
+	h.save(c, current, &query)
+}
+
+// Delete remove a query e seus parametros.
+// DELETE /api/admin/queries/:slug
+func (h *QueryAdminHandler) Delete(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	if err := h.queryRepo.Delete(c.Request.Context(), query.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao remover query",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.invalidateCache(c.Request.Context(), query.Slug)
+
+	c.JSON(http.StatusOK, gin.H{
+		"deleted": true,
+		"slug":    query.Slug,
+	})
+}
+
+// AddParameter inclui um parametro na query.
+// POST /api/admin/queries/:slug/parameters
+func (h *QueryAdminHandler) AddParameter(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	var req parameterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	updated := *query
+	updated.Parameters = append(append([]models.QueryParameter{}, query.Parameters...), req.toModel())
+
+	if !h.validate(c, &updated) {
+		return
+	}
+
+	h.save(c, query, &updated)
+}
+
+// UpdateParameter substitui a definicao de um parametro da query.
+// PUT /api/admin/queries/:slug/parameters/:name
+func (h *QueryAdminHandler) UpdateParameter(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	var req parameterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	name := c.Param("name")
+	if req.Name == "" {
+		req.Name = name
+	}
+
+	updated := *query
+	updated.Parameters = nil
+	found := false
+	for _, p := range query.Parameters {
+		if p.Name == name {
+			updated.Parameters = append(updated.Parameters, req.toModel())
+			found = true
+			continue
+		}
+		updated.Parameters = append(updated.Parameters, p)
+	}
+
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "Parametro nao encontrado",
+			"slug":      query.Slug,
+			"parameter": name,
+		})
+		return
+	}
+
+	if !h.validate(c, &updated) {
+		return
+	}
+
+	h.save(c, query, &updated)
+}
+
+// DeleteParameter remove um parametro da query. O SQL precisa deixar de usar
+// o placeholder na mesma alteracao, senao a validacao recusa a remocao.
+// DELETE /api/admin/queries/:slug/parameters/:name
+func (h *QueryAdminHandler) DeleteParameter(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	updated := *query
+	updated.Parameters = nil
+	for _, p := range query.Parameters {
+		if p.Name != name {
+			updated.Parameters = append(updated.Parameters, p)
+		}
+	}
+
+	if len(updated.Parameters) == len(query.Parameters) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":     "Parametro nao encontrado",
+			"slug":      query.Slug,
+			"parameter": name,
+		})
+		return
+	}
+
+	if !h.validate(c, &updated) {
+		return
+	}
+
+	h.save(c, query, &updated)
+}
+
+func (h *QueryAdminHandler) findQuery(c *gin.Context) (*models.Query, bool) {
+	slug := c.Param("slug")
+
+	query, err := h.queryRepo.FindBySlugAny(c.Request.Context(), slug)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Query nao encontrada",
+			"slug":    slug,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	return query, true
+}
+
+// applyRequest copia o corpo da requisicao para a query, resolve o datasource
+// e valida a definicao completa.
+func (h *QueryAdminHandler) applyRequest(c *gin.Context, query *models.Query, req queryRequest) bool {
+	query.Slug = strings.TrimSpace(req.Slug)
+	query.Name = strings.TrimSpace(req.Name)
+	query.Description = req.Description
+	query.SQLQuery = strings.TrimSpace(req.SQLQuery)
+	query.MaxConcurrency = req.MaxConcurrency
+
+	// Campos omitidos mantem o valor atual, ou o padrao da tabela na criacao
+	if query.ID == "" {
+		query.CacheTTL = 300
+		query.TimeoutSeconds = 30
+	}
+	if req.CacheTTL != nil {
+		query.CacheTTL = *req.CacheTTL
+	}
+	if req.TimeoutSeconds != nil {
+		query.TimeoutSeconds = *req.TimeoutSeconds
+	}
+	if req.IsActive != nil {
+		query.IsActive = *req.IsActive
+	}
+	if req.Tags != nil {
+		query.Tags = catalog.NormalizeTags(req.Tags)
+	}
+	if req.AllowedRoles != nil {
+		query.AllowedRoles = models.NormalizeRoles(req.AllowedRoles)
+	}
+	if req.ColumnPolicies != nil {
+		query.ColumnPolicies = catalog.NormalizeColumnPolicies(req.ColumnPolicies)
+	}
+	if req.Quota != nil {
+		query.Quota = *req.Quota
+	}
+
+	if req.Datasource != "" {
+		datasource, err := h.datasourceRepo.FindBySlug(c.Request.Context(), req.Datasource)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Datasource invalido",
+				"slug":    query.Slug,
+				"details": err.Error(),
+			})
+			return false
+		}
+		query.DatasourceID = &datasource.ID
+		query.DatasourceSlug = &datasource.Slug
+	}
+
+	query.Parameters = make([]models.QueryParameter, 0, len(req.Parameters))
+	for _, p := range req.Parameters {
+		query.Parameters = append(query.Parameters, p.toModel())
+	}
+
+	return h.validate(c, query)
+}
+
+func (h *QueryAdminHandler) validate(c *gin.Context, query *models.Query) bool {
+	var datasource *database.DatasourceConfig
+	var datasourceErr error
+	if query.DatasourceID != nil && *query.DatasourceID != "" {
+		datasource, datasourceErr = h.datasourceRepo.FindByID(c.Request.Context(), *query.DatasourceID)
+	}
+
+	errs := validateQueryDefinition(query, datasource, h.masker)
+	if datasourceErr != nil {
+		errs["datasource"] = datasourceErr.Error()
+	}
+
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "Definicao de query invalida",
+			"slug":       query.Slug,
+			"validation": errs,
+		})
+		return false
+	}
+
+	return true
+}
+
+// validateQueryDefinition confere a definicao inteira da query: campos basicos,
+// tipo e default de cada parametro e se as posicoes batem com os placeholders
+// do SQL. datasource nil pula as checagens que dependem do driver.
+func validateQueryDefinition(query *models.Query, datasource *database.DatasourceConfig, masker *masking.Masker) map[string]string {
+	errs := make(map[string]string)
+
+	if !slugPattern.MatchString(query.Slug) {
+		errs["slug"] = "use apenas letras minusculas, numeros, '-' e '_' (ate 100 caracteres)"
+	}
+	if query.Name == "" {
+		errs["name"] = "obrigatorio"
+	}
+	if query.SQLQuery == "" {
+		errs["sql_query"] = "obrigatorio"
+	}
+	if query.CacheTTL < 0 {
+		errs["cache_ttl"] = "nao pode ser negativo"
+	}
+	if query.TimeoutSeconds <= 0 {
+		errs["timeout_seconds"] = "deve ser maior que zero"
+	}
+	if query.MaxConcurrency < 0 {
+		errs["max_concurrency"] = "nao pode ser negativo"
+	}
+	if field := query.Quota.Invalid(); field != "" {
+		errs["quota."+field] = "nao pode ser negativo"
+	}
+	for _, tag := range query.Tags {
+		if !slugPattern.MatchString(tag) {
+			errs["tags"] = fmt.Sprintf("tag '%s' invalida: use letras minusculas, numeros, '-' e '_'", tag)
+			break
+		}
+	}
+
+	if query.DatasourceID == nil || *query.DatasourceID == "" {
+		errs["datasource"] = "obrigatorio"
+	}
+
+	columns := make(map[string]bool)
+	for _, policy := range query.ColumnPolicies {
+		key := "column_policies." + policy.Column
+
+		switch {
+		case policy.Column == "":
+			errs["column_policies"] = "column obrigatorio"
+		case columns[strings.ToLower(policy.Column)]:
+			errs[key] = "coluna repetida"
+		case !validColumnActions[policy.Action]:
+			errs[key] = fmt.Sprintf("action '%s' invalida: use hide, mask, hash ou truncate", policy.Action)
+		case policy.Action == models.ColumnPolicyTruncate && policy.Length < 1:
+			errs[key] = "truncate exige length maior que zero"
+		case policy.Action == models.ColumnPolicyHash && !masker.CanHash():
+			errs[key] = "hash exige security.mask_hash_key configurada"
+		}
+		columns[strings.ToLower(policy.Column)] = true
+	}
+
+	names := make(map[string]bool)
+	positions := make(map[int]string)
+	for _, p := range query.Parameters {
+		key := "parameters." + p.Name
+
+		if !paramNamePattern.MatchString(p.Name) {
+			errs[key] = "nome invalido: use letras, numeros e '_'"
+			continue
+		}
+		if names[p.Name] {
+			errs[key] = "nome duplicado"
+			continue
+		}
+		names[p.Name] = true
+
+		if !validParamTypes[p.ParamType] {
+			errs[key] = fmt.Sprintf("tipo '%s' invalido", p.ParamType)
+			continue
+		}
+		if p.Position < 1 {
+			errs[key] = "position deve ser maior ou igual a 1"
+			continue
+		}
+		if other, exists := positions[p.Position]; exists {
+			errs[key] = fmt.Sprintf("position %d ja usada por '%s'", p.Position, other)
+			continue
+		}
+		positions[p.Position] = p.Name
+
+		if p.BindFrom != nil {
+			if !bindFromPattern.MatchString(*p.BindFrom) || len(*p.BindFrom) > 100 {
+				errs[key] = fmt.Sprintf("bind_from '%s' invalido", *p.BindFrom)
+				continue
+			}
+			// O valor vem sempre da credencial: um default abriria os dados de
+			// quem nao tem o atributo
+			if p.DefaultValue != nil {
+				errs[key] = "parametro com bind_from nao aceita default_value"
+				continue
+			}
+		}
+
+		policy, err := paramcheck.Parse(p.ParamType, p.Validations)
+		if err != nil {
+			errs[key] = err.Error()
+			continue
+		}
+
+		if p.DefaultValue != nil {
+			converted, err := paramcheck.Convert(*p.DefaultValue, p.ParamType)
+			if err != nil {
+				errs[key] = fmt.Sprintf("default_value invalido para o tipo %s: %s", p.ParamType, err.Error())
+				continue
+			}
+			if err := policy.Check(*p.DefaultValue, converted); err != nil {
+				errs[key] = fmt.Sprintf("default_value fora das validations: %s", err.Error())
+				continue
+			}
+		}
+	}
+
+	if datasource != nil && query.SQLQuery != "" {
+		if !datasource.AllowWrites {
+			if err := database.CheckReadOnlySQL(query.SQLQuery); err != nil {
+				errs["sql_query"] = err.Error()
+			}
+		}
+
+		used := database.PlaceholderPositions(datasource.Driver, query.SQLQuery)
+		usedSet := make(map[int]bool, len(used))
+		var missing []string
+		for _, pos := range used {
+			usedSet[pos] = true
+			if _, exists := positions[pos]; !exists {
+				missing = append(missing, fmt.Sprint(pos))
+			}
+		}
+		if len(missing) > 0 && errs["sql_query"] == "" {
+			errs["sql_query"] = fmt.Sprintf("placeholders sem parametro nas posicoes: %s", strings.Join(missing, ", "))
+		}
+
+		for pos, name := range positions {
+			if !usedSet[pos] {
+				errs["parameters."+name] = fmt.Sprintf("position %d nao corresponde a nenhum placeholder do SQL (%d encontrados)", pos, len(used))
+			}
+		}
+	}
+
+	return errs
+}
+
+// save grava a alteracao de uma query existente. Query depreciada so aceita
+// mudancas fora da versao (cache, ACL, ativa...): uma nova versao voltaria o
+// ciclo de revisao de uma query que esta saindo de uso.
+func (h *QueryAdminHandler) save(c *gin.Context, current, query *models.Query) {
+	if !allowVersionChange(c, current, query) {
+		return
+	}
+
+	actor := requestActor(c)
+	query.UpdatedBy = &actor
+
+	if err := h.queryRepo.Update(c.Request.Context(), query); err != nil {
+		respondWriteError(c, query.Slug, "Erro ao atualizar query", err)
+		return
+	}
+
+	h.invalidateCache(c.Request.Context(), current.Slug)
+	if query.Slug != current.Slug {
+		h.invalidateCache(c.Request.Context(), query.Slug)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"query": query})
+}
+
+// invalidateCache descarta os resultados em cache da query, que podem ter sido
+// gerados com a definicao anterior.
+func (h *QueryAdminHandler) invalidateCache(ctx context.Context, slug string) {
+	if err := h.cacheService.InvalidateQuery(ctx, slug); err != nil {
+		fmt.Printf("[Cache] Erro ao invalidar cache da query '%s': %v\n", slug, err)
+	}
+}
+
+// allowVersionChange recusa com 409 uma nova versao de query depreciada.
+func allowVersionChange(c *gin.Context, current, query *models.Query) bool {
+	if current.Status != models.QueryStatusDeprecated {
+		return true
+	}
+
+	changed, err := catalog.VersionChanged(current, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao comparar versoes",
+			"slug":    current.Slug,
+			"details": err.Error(),
+		})
+		return false
+	}
+	if changed {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Query depreciada nao aceita alteracao de SQL, parametros ou datasource",
+			"code":  "query_deprecated",
+			"slug":  current.Slug,
+		})
+		return false
+	}
+
+	return true
+}
+
+func respondWriteError(c *gin.Context, slug, message string, err error) {
+	if errors.Is(err, repository.ErrDuplicate) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Ja existe um registro com esses dados",
+			"code":    "duplicate",
+			"slug":    slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   message,
+		"slug":    slug,
+		"details": err.Error(),
+	})
+}
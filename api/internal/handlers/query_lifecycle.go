@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adolp26/querybase/internal/middleware"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+// Submit envia a definicao atual da query para revisao.
+// POST /api/admin/queries/:slug/submit
+func (h *QueryAdminHandler) Submit(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	actor, ok := namedActor(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.queryRepo.EnsureVersion(c.Request.Context(), query, derefString(query.UpdatedBy))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao registrar versao atual",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	if err := h.queryRepo.SubmitForReview(c.Request.Context(), query.ID, version, actor); err != nil {
+		respondLifecycleError(c, query, "Erro ao enviar para revisao", err)
+		return
+	}
+
+	fmt.Printf("[Lifecycle] Query '%s' versao %d enviada para revisao por %s\n", query.Slug, version, actor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":    query.Slug,
+		"status":  models.QueryStatusPendingReview,
+		"version": version,
+	})
+}
+
+// Approve publica a versao em revisao. Precisa ser feito por um usuario
+// diferente de quem enviou e de quem escreveu a versao.
+// POST /api/admin/queries/:slug/approve
+func (h *QueryAdminHandler) Approve(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	actor, ok := namedActor(c)
+	if !ok {
+		return
+	}
+
+	version, err := h.queryRepo.Approve(c.Request.Context(), query.ID, actor)
+	if err != nil {
+		respondLifecycleError(c, query, "Erro ao aprovar query", err)
+		return
+	}
+
+	h.invalidateCache(c.Request.Context(), query.Slug)
+
+	fmt.Printf("[Lifecycle] Query '%s' versao %d publicada, aprovada por %s\n", query.Slug, version, actor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":              query.Slug,
+		"status":            models.QueryStatusPublished,
+		"published_version": version,
+	})
+}
+
+type rejectRequest struct {
+	Comment string `json:"comment"`
+}
+
+// Reject devolve a query em revisao para draft.
+// POST /api/admin/queries/:slug/reject
+func (h *QueryAdminHandler) Reject(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	actor, ok := namedActor(c)
+	if !ok {
+		return
+	}
+
+	var req rejectRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "JSON invalido",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	var comment *string
+	if trimmed := strings.TrimSpace(req.Comment); trimmed != "" {
+		comment = &trimmed
+	}
+
+	if err := h.queryRepo.Reject(c.Request.Context(), query.ID, actor, comment); err != nil {
+		respondLifecycleError(c, query, "Erro ao rejeitar query", err)
+		return
+	}
+
+	fmt.Printf("[Lifecycle] Revisao da query '%s' rejeitada por %s\n", query.Slug, actor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":    query.Slug,
+		"status":  models.QueryStatusDraft,
+		"comment": comment,
+	})
+}
+
+// Deprecate marca a query publicada como obsoleta; ela continua sendo
+// servida, com o header Deprecation na resposta.
+// POST /api/admin/queries/:slug/deprecate
+func (h *QueryAdminHandler) Deprecate(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	actor, ok := namedActor(c)
+	if !ok {
+		return
+	}
+
+	if err := h.queryRepo.Deprecate(c.Request.Context(), query.ID, actor); err != nil {
+		respondLifecycleError(c, query, "Erro ao depreciar query", err)
+		return
+	}
+
+	fmt.Printf("[Lifecycle] Query '%s' depreciada por %s\n", query.Slug, actor)
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":   query.Slug,
+		"status": models.QueryStatusDeprecated,
+	})
+}
+
+// namedActor exige uma admin key nomeada (security.named_admin_keys): sem uma
+// identidade autenticada nao da para garantir que quem aprova e diferente de
+// quem enviou para revisao e de quem escreveu a versao, nem registrar quem
+// depreciou a query.
+func namedActor(c *gin.Context) (string, bool) {
+	actor, ok := middleware.AdminIdentity(c)
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Revisao e depreciacao de queries exigem uma admin key nomeada (security.named_admin_keys)",
+			"code":  "identity_required",
+		})
+		return "", false
+	}
+	return actor, true
+}
+
+func respondLifecycleError(c *gin.Context, query *models.Query, message string, err error) {
+	switch {
+	case errors.Is(err, repository.ErrSelfApproval):
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":   "A aprovacao precisa ser feita por outro usuario",
+			"code":    "self_approval",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+	case errors.Is(err, repository.ErrInvalidStatus):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Transicao invalida para o status atual",
+			"code":    "invalid_status",
+			"slug":    query.Slug,
+			"status":  query.Status,
+			"details": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   message,
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adolp26/querybase/internal/catalog"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// queryFromVersion monta a query a partir de uma versao do historico: SQL,
+// parametros e datasource vem da versao; identidade, configuracao (nome,
+// cache, timeout, tags, ativa), estado, ACL, politicas de coluna e cota vem da
+// query atual.
+func queryFromVersion(current *models.Query, v *models.QueryVersion) (*models.Query, error) {
+	definition, err := catalog.ParseSnapshot(v.Definition)
+	if err != nil {
+		return nil, err
+	}
+
+	datasourceID := ""
+	if v.DatasourceID != nil {
+		datasourceID = *v.DatasourceID
+	}
+
+	query, err := definition.ToModel(datasourceID)
+	if err != nil {
+		return nil, err
+	}
+	if v.DatasourceID == nil {
+		query.DatasourceID = nil
+	}
+
+	query.ID = current.ID
+	query.Slug = current.Slug
+	query.Name = current.Name
+	query.Description = current.Description
+	query.CacheTTL = current.CacheTTL
+	query.TimeoutSeconds = current.TimeoutSeconds
+	query.MaxConcurrency = current.MaxConcurrency
+	query.Tags = current.Tags
+	query.IsActive = current.IsActive
+	query.PinnedVersion = current.PinnedVersion
+	query.AllowedRoles = current.AllowedRoles
+	query.ColumnPolicies = current.ColumnPolicies
+	query.Quota = current.Quota
+	query.DatasourceAllowedRoles = current.DatasourceAllowedRoles
+	query.Status = current.Status
+	query.PublishedVersion = current.PublishedVersion
+	query.CreatedAt = current.CreatedAt
+	query.CreatedBy = current.CreatedBy
+	query.Version = v.Version
+
+	return query, nil
+}
+
+// errMissingBinding indica uma versao antiga sem um parametro que a definicao
+// atual vincula a credencial (bind_from).
+var errMissingBinding = errors.New("versao sem parametro vinculado exigido pela definicao atual")
+
+// enforceBindings aplica sobre uma versao do historico os bind_from da
+// definicao atual: uma versao aprovada antes do vinculo deixaria o cliente
+// informar o valor (ex.: o tenant) pela query string. Se a versao nem tem o
+// parametro, o SQL dela nao filtra por ele e a versao e recusada.
+func enforceBindings(current, resolved *models.Query) error {
+	for _, bound := range current.Parameters {
+		if bound.BindFrom == nil {
+			continue
+		}
+
+		found := false
+		for i := range resolved.Parameters {
+			if resolved.Parameters[i].Name == bound.Name {
+				bindFrom := *bound.BindFrom
+				resolved.Parameters[i].BindFrom = &bindFrom
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: '%s'", errMissingBinding, bound.Name)
+		}
+	}
+
+	return nil
+}
+
+// Versions lista o historico de versoes da query.
+// GET /api/admin/queries/:slug/versions
+func (h *QueryAdminHandler) Versions(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	// Leitura apenas: uma alteracao feita direto no banco entra no historico
+	// ao salvar, ao enviar para revisao ou na subida da API
+	current, err := h.queryRepo.CurrentVersion(c.Request.Context(), query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao buscar versao atual",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	versions, err := h.queryRepo.ListVersions(c.Request.Context(), query.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao listar versoes",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":            query.Slug,
+		"current_version": current,
+		"pinned_version":  query.PinnedVersion,
+		"versions":        versions,
+		"count":           len(versions),
+	})
+}
+
+// GetVersion devolve uma versao especifica da query.
+// GET /api/admin/queries/:slug/versions/:version
+func (h *QueryAdminHandler) GetVersion(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	version, ok := h.findVersion(c, query, c.Param("version"))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"version": version})
+}
+
+// DiffVersions compara duas versoes da query. Sem "to", compara com a
+// definicao atual.
+// GET /api/admin/queries/:slug/diff?from=N&to=M
+func (h *QueryAdminHandler) DiffVersions(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	fromVersion, ok := h.findVersion(c, query, c.Query("from"))
+	if !ok {
+		return
+	}
+	from, err := catalog.ParseSnapshot(fromVersion.Definition)
+	if err != nil {
+		respondVersionError(c, query.Slug, err)
+		return
+	}
+
+	var to *catalog.Query
+	toLabel := "current"
+	if raw := c.Query("to"); raw != "" {
+		toVersion, ok := h.findVersion(c, query, raw)
+		if !ok {
+			return
+		}
+		if to, err = catalog.ParseSnapshot(toVersion.Definition); err != nil {
+			respondVersionError(c, query.Slug, err)
+			return
+		}
+		toLabel = raw
+	} else {
+		current := catalog.Versioned(catalog.FromModel(query))
+		to = &current
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":     query.Slug,
+		"from":     fromVersion.Version,
+		"to":       toLabel,
+		"fields":   catalog.Diff(from, to),
+		"sql_diff": catalog.DiffLines(from.SQL, to.SQL),
+	})
+}
+
+type versionRequest struct {
+	Version int `json:"version" binding:"required"`
+}
+
+// Rollback restaura a definicao de uma versao anterior. O historico nao e
+// reescrito: a restauracao vira uma nova versao com o conteudo antigo.
+// POST /api/admin/queries/:slug/rollback
+func (h *QueryAdminHandler) Rollback(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	var req versionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	version, ok := h.findVersion(c, query, strconv.Itoa(req.Version))
+	if !ok {
+		return
+	}
+
+	restored, err := queryFromVersion(query, version)
+	if err != nil {
+		respondVersionError(c, query.Slug, err)
+		return
+	}
+	restored.Version = 0
+
+	if !h.validate(c, restored) {
+		return
+	}
+
+	h.save(c, query, restored)
+}
+
+// Pin fixa a versao servida quando a requisicao nao pede uma versao. So
+// aceita versoes que ja foram aprovadas.
+// PUT /api/admin/queries/:slug/pin
+func (h *QueryAdminHandler) Pin(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	var req versionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "JSON invalido",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	version, ok := h.findVersion(c, query, strconv.Itoa(req.Version))
+	if !ok {
+		return
+	}
+
+	// Fixar uma versao nao aprovada seria publicar sem revisao
+	if version.ApprovedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Apenas versoes aprovadas podem ser fixadas",
+			"code":    "version_not_published",
+			"slug":    query.Slug,
+			"version": version.Version,
+		})
+		return
+	}
+
+	h.setPin(c, query, &req.Version)
+}
+
+// Unpin volta a servir a versao publicada.
+// DELETE /api/admin/queries/:slug/pin
+func (h *QueryAdminHandler) Unpin(c *gin.Context) {
+	query, ok := h.findQuery(c)
+	if !ok {
+		return
+	}
+
+	h.setPin(c, query, nil)
+}
+
+func (h *QueryAdminHandler) setPin(c *gin.Context, query *models.Query, version *int) {
+	if err := h.queryRepo.SetPinnedVersion(c.Request.Context(), query.ID, version); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Erro ao fixar versao",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return
+	}
+
+	h.invalidateCache(c.Request.Context(), query.Slug)
+
+	c.JSON(http.StatusOK, gin.H{
+		"slug":           query.Slug,
+		"pinned_version": version,
+	})
+}
+
+func (h *QueryAdminHandler) findVersion(c *gin.Context, query *models.Query, raw string) (*models.QueryVersion, bool) {
+	number, err := strconv.Atoi(raw)
+	if err != nil || number < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Versao invalida",
+			"slug":  query.Slug,
+		})
+		return nil, false
+	}
+
+	version, err := h.queryRepo.FindVersion(c.Request.Context(), query.ID, number)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "Versao nao encontrada",
+			"code":    "version_not_found",
+			"slug":    query.Slug,
+			"details": err.Error(),
+		})
+		return nil, false
+	}
+
+	return version, true
+}
+
+func respondVersionError(c *gin.Context, slug string, err error) {
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   "Erro ao ler versao",
+		"slug":    slug,
+		"details": err.Error(),
+	})
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestEnforceBindings(t *testing.T) {
+	tenant := "tenant_id"
+	current := &models.Query{
+		Parameters: []models.QueryParameter{
+			{Name: "loja", ParamType: "integer", BindFrom: &tenant},
+			{Name: "status", ParamType: "string"},
+		},
+	}
+
+	t.Run("versao antiga recebe o vinculo atual", func(t *testing.T) {
+		old := &models.Query{
+			Parameters: []models.QueryParameter{
+				{Name: "status", ParamType: "string"},
+				{Name: "loja", ParamType: "integer"},
+			},
+		}
+		if err := enforceBindings(current, old); err != nil {
+			t.Fatal(err)
+		}
+		if bindFrom := old.Parameters[1].BindFrom; bindFrom == nil || *bindFrom != "tenant_id" {
+			t.Fatalf("bind_from de loja = %v", bindFrom)
+		}
+		if old.Parameters[0].BindFrom != nil {
+			t.Fatal("parametro sem vinculo recebeu bind_from")
+		}
+
+		// A versao recebe uma copia: mexer nela nao altera a definicao atual
+		*old.Parameters[1].BindFrom = "outro"
+		if *current.Parameters[0].BindFrom != "tenant_id" {
+			t.Fatal("bind_from da definicao atual foi alterado")
+		}
+	})
+
+	t.Run("versao sem o parametro e recusada", func(t *testing.T) {
+		old := &models.Query{
+			Parameters: []models.QueryParameter{{Name: "status", ParamType: "string"}},
+		}
+		if err := enforceBindings(current, old); !errors.Is(err, errMissingBinding) {
+			t.Fatalf("enforceBindings() = %v, esperava errMissingBinding", err)
+		}
+	})
+
+	t.Run("query sem vinculo aceita qualquer versao", func(t *testing.T) {
+		if err := enforceBindings(&models.Query{}, &models.Query{}); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestAllowVersionChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deprecated := &models.Query{
+		Slug:     "vendas",
+		SQLQuery: "SELECT * FROM vendas",
+		IsActive: true,
+		Status:   models.QueryStatusDeprecated,
+	}
+
+	tests := []struct {
+		name     string
+		current  *models.Query
+		edit     func(q *models.Query)
+		want     bool
+		wantCode int
+	}{
+		{"depreciada aceita desativar", deprecated, func(q *models.Query) { q.IsActive = false }, true, http.StatusOK},
+		{"depreciada aceita mudar o cache", deprecated, func(q *models.Query) { q.CacheTTL = 60 }, true, http.StatusOK},
+		{"depreciada recusa novo SQL", deprecated, func(q *models.Query) { q.SQLQuery += " WHERE ativo" }, false, http.StatusConflict},
+		{
+			"publicada aceita novo SQL",
+			&models.Query{Slug: "vendas", SQLQuery: "SELECT 1", Status: models.QueryStatusPublished},
+			func(q *models.Query) { q.SQLQuery = "SELECT 2" },
+			true, http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+
+			edited := *tt.current
+			tt.edit(&edited)
+
+			if got := allowVersionChange(c, tt.current, &edited); got != tt.want {
+				t.Fatalf("allowVersionChange() = %v, esperava %v", got, tt.want)
+			}
+			if w.Code != tt.wantCode {
+				t.Fatalf("status %d, esperava %d", w.Code, tt.wantCode)
+			}
+		})
+	}
+}
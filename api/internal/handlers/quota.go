@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/middleware"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Quota devolve o consumo do dia da credencial e, com ?query=slug, o da query.
+// GET /api/quota
+func (h *DynamicQueryHandler) Quota(c *gin.Context) {
+	var subjects []services.QuotaSubject
+	if subject, ok := h.keySubject(c); ok {
+		subjects = append(subjects, subject)
+	}
+
+	if slug := c.Query("query"); slug != "" {
+		query, err := h.findExecutable(c, slug)
+		if err != nil || !canList(middleware.PrincipalFromContext(c), query) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "Query nao encontrada",
+				"slug":  slug,
+			})
+			return
+		}
+		subjects = append(subjects, services.QuerySubject(query))
+	}
+
+	statuses := []services.QuotaStatus{}
+	if len(subjects) > 0 {
+		var err error
+		statuses, err = h.quotas.Status(c.Request.Context(), subjects...)
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{
+				"error":   "Erro ao consultar cotas",
+				"details": err.Error(),
+			})
+			return
+		}
+		setQuotaHeaders(c, statuses)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"quotas": statuses})
+}
+
+// keySubject identifica a credencial que consome a cota por chave. Admin keys
+// e requisicoes sem autenticacao ficam fora.
+func (h *DynamicQueryHandler) keySubject(c *gin.Context) (services.QuotaSubject, bool) {
+	if record := middleware.APIKeyFromContext(c); record != nil {
+		return h.quotas.KeySubject("api_key:"+record.ID, record.Quota), true
+	}
+
+	principal := middleware.PrincipalFromContext(c)
+	if principal == nil || principal.Admin {
+		return services.QuotaSubject{}, false
+	}
+
+	id := principal.Type + ":" + principal.Subject
+	if principal.Type == models.PrincipalStaticKey {
+		// As chaves do config.yaml dividem o mesmo subject; o hash as separa
+		sum := sha256.Sum256([]byte(c.GetString("api_key")))
+		id = principal.Type + ":" + hex.EncodeToString(sum[:8])
+	}
+
+	return h.quotas.KeySubject(id, models.Quota{}), true
+}
+
+// quotaSubjects monta os consumidores de uma execucao: a credencial e a query.
+func (h *DynamicQueryHandler) quotaSubjects(c *gin.Context, query *models.Query) []services.QuotaSubject {
+	subjects := []services.QuotaSubject{services.QuerySubject(query)}
+	if subject, ok := h.keySubject(c); ok {
+		subjects = append(subjects, subject)
+	}
+	return subjects
+}
+
+// checkQuota confere as cotas antes da execucao. Cota esgotada responde 429
+// ate a virada do dia (UTC). Se o Redis falhar a execucao segue, sem cota.
+func (h *DynamicQueryHandler) checkQuota(
+	c *gin.Context,
+	query *models.Query,
+	subjects []services.QuotaSubject,
+	params map[string]interface{},
+	startTime time.Time,
+) ([]services.QuotaStatus, bool) {
+	statuses, err := h.quotas.Status(c.Request.Context(), subjects...)
+	if err != nil {
+		fmt.Printf("[Quota] Cotas ignoradas para '%s': %v\n", query.Slug, err)
+		return nil, true
+	}
+
+	for _, status := range statuses {
+		exceeded := status.Exceeded()
+		if exceeded == "" {
+			continue
+		}
+
+		reason := fmt.Sprintf("cota %s da %s esgotada", exceeded, quotaScopeLabel(status.Scope))
+		go h.logExecution(newExecution(c, query, params, time.Since(startTime), false, nil, errors.New(reason)))
+
+		retryAfter := int(math.Ceil(time.Until(status.ResetsAt).Seconds()))
+		setQuotaHeaders(c, statuses)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Cota diaria esgotada",
+			"code":        "quota_exceeded",
+			"slug":        query.Slug,
+			"scope":       status.Scope,
+			"quota":       exceeded,
+			"details":     reason,
+			"resets_at":   status.ResetsAt,
+			"retry_after": retryAfter,
+		})
+		return nil, false
+	}
+
+	return statuses, true
+}
+
+// recordQuota soma o consumo da execucao e escreve os headers com o saldo. O
+// registro usa um contexto proprio: o cliente desconectar nao apaga o consumo.
+func (h *DynamicQueryHandler) recordQuota(
+	c *gin.Context,
+	subjects []services.QuotaSubject,
+	statuses []services.QuotaStatus,
+	usage services.QuotaUsage,
+) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := h.quotas.Record(ctx, usage, subjects...); err != nil {
+		fmt.Printf("[Quota] Erro ao registrar consumo: %v\n", err)
+	}
+
+	after := make([]services.QuotaStatus, len(statuses))
+	for i, status := range statuses {
+		after[i] = status.Plus(usage)
+	}
+	setQuotaHeaders(c, after)
+}
+
+// executionUsage e o consumo de uma execucao. Recusas do limite de
+// concorrencia e do circuit breaker nao chegaram ao banco.
+func executionUsage(results []map[string]interface{}, cacheHit bool, duration time.Duration, err error) services.QuotaUsage {
+	usage := services.QuotaUsage{Rows: int64(len(results))}
+	if cacheHit {
+		return usage
+	}
+
+	var limitErr *database.LimitExceededError
+	var openErr *database.CircuitOpenError
+	if errors.As(err, &limitErr) || errors.As(err, &openErr) {
+		return usage
+	}
+
+	usage.Executions = 1
+	usage.DBTimeMillis = duration.Milliseconds()
+	return usage
+}
+
+// setQuotaHeaders escreve o menor saldo de cada limite entre os consumidores.
+func setQuotaHeaders(c *gin.Context, statuses []services.QuotaStatus) {
+	var rows, executions *int64
+	var dbSeconds *float64
+	var resetsAt time.Time
+
+	for _, status := range statuses {
+		if r := status.Remaining.Rows; r != nil && (rows == nil || *r < *rows) {
+			rows = r
+		}
+		if e := status.Remaining.Executions; e != nil && (executions == nil || *e < *executions) {
+			executions = e
+		}
+		if d := status.Remaining.DBSeconds; d != nil && (dbSeconds == nil || *d < *dbSeconds) {
+			dbSeconds = d
+		}
+		resetsAt = status.ResetsAt
+	}
+
+	if rows != nil {
+		c.Header("X-Quota-Rows-Remaining", strconv.FormatInt(*rows, 10))
+	}
+	if executions != nil {
+		c.Header("X-Quota-Executions-Remaining", strconv.FormatInt(*executions, 10))
+	}
+	if dbSeconds != nil {
+		c.Header("X-Quota-DB-Seconds-Remaining", strconv.FormatFloat(*dbSeconds, 'f', 3, 64))
+	}
+	if rows != nil || executions != nil || dbSeconds != nil {
+		c.Header("X-Quota-Reset", strconv.Itoa(int(math.Ceil(time.Until(resetsAt).Seconds()))))
+	}
+}
+
+func quotaScopeLabel(scope string) string {
+	if scope == services.QuotaScopeQuery {
+		return "query"
+	}
+	return "credencial"
+}
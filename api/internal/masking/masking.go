@@ -0,0 +1,166 @@
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+// visibleSuffix e quantos caracteres o mask sem pattern deixa visiveis no fim.
+const visibleSuffix = 4
+
+// Masker aplica as politicas de coluna das queries no resultado de cada
+// requisicao. O cache guarda os dados completos; o mascaramento acontece por
+// requisicao, conforme as roles de quem chamou.
+type Masker struct {
+	hashKey []byte
+}
+
+// NewMasker cria o Masker. A acao hash usa HMAC-SHA256 com hashKey e exige a
+// chave: SHA-256 puro seria revertido por forca bruta em valores curtos (CPF).
+func NewMasker(hashKey string) *Masker {
+	return &Masker{hashKey: []byte(hashKey)}
+}
+
+// CanHash diz se a acao hash pode ser usada, isto e, se ha chave configurada.
+func (m *Masker) CanHash() bool {
+	return len(m.hashKey) > 0
+}
+
+// CheckPolicies recusa politicas com a acao hash quando nao ha chave.
+func (m *Masker) CheckPolicies(policies []models.ColumnPolicy) error {
+	if m.CanHash() {
+		return nil
+	}
+	for _, policy := range policies {
+		if policy.Action == models.ColumnPolicyHash {
+			return fmt.Errorf("coluna '%s' usa hash, que exige security.mask_hash_key", policy.Column)
+		}
+	}
+	return nil
+}
+
+// Apply mascara as linhas no lugar: os handlers recebem uma copia do
+// resultado por requisicao. Os nomes de coluna sao comparados sem diferenciar
+// maiusculas, porque Oracle devolve tudo em maiusculas.
+func (m *Masker) Apply(rows []map[string]interface{}, policies []models.ColumnPolicy, principal *models.Principal) {
+	active := make(map[string]models.ColumnPolicy)
+	for _, policy := range policies {
+		if policy.AppliesTo(principal) {
+			active[strings.ToLower(policy.Column)] = policy
+		}
+	}
+	if len(active) == 0 {
+		return
+	}
+
+	for _, row := range rows {
+		for column, value := range row {
+			policy, ok := active[strings.ToLower(column)]
+			if !ok {
+				continue
+			}
+			if policy.Action == models.ColumnPolicyHide {
+				delete(row, column)
+				continue
+			}
+			if value == nil {
+				continue
+			}
+			row[column] = m.apply(policy, toString(value))
+		}
+	}
+}
+
+func (m *Masker) apply(policy models.ColumnPolicy, value string) string {
+	switch policy.Action {
+	case models.ColumnPolicyMask:
+		if policy.Pattern != "" {
+			return maskPattern(value, policy.Pattern)
+		}
+		return maskDefault(value)
+	case models.ColumnPolicyHash:
+		return m.hash(value)
+	case models.ColumnPolicyTruncate:
+		runes := []rune(value)
+		if policy.Length < len(runes) {
+			return string(runes[:policy.Length])
+		}
+		return value
+	}
+	// Acao desconhecida: melhor esconder o valor do que devolve-lo
+	return strings.Repeat("*", len([]rune(value)))
+}
+
+func (m *Masker) hash(value string) string {
+	if !m.CanHash() {
+		// Politica gravada por fora da API sem chave configurada: esconde
+		return strings.Repeat("*", len([]rune(value)))
+	}
+	mac := hmac.New(sha256.New, m.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// maskPattern preenche o pattern com as letras e numeros do valor, ignorando
+// a pontuacao (CPF com ou sem mascara da o mesmo resultado): '#' mostra o
+// caractere, '*' esconde e qualquer outro caractere e copiado.
+// Ex.: "12345678901" com "***.###.###-**" vira "***.456.789-**".
+func maskPattern(value, pattern string) string {
+	var chars []rune
+	for _, r := range value {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			chars = append(chars, r)
+		}
+	}
+
+	var out strings.Builder
+	next := 0
+	for _, p := range pattern {
+		switch p {
+		case '#':
+			if next < len(chars) {
+				out.WriteRune(chars[next])
+			}
+			next++
+		case '*':
+			out.WriteRune('*')
+			next++
+		default:
+			out.WriteRune(p)
+		}
+	}
+	return out.String()
+}
+
+// maskDefault mostra so o fim do valor; em emails, a primeira letra e o
+// dominio ("j***@empresa.com").
+func maskDefault(value string) string {
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		local := []rune(value[:at])
+		return string(local[0]) + "***" + value[at:]
+	}
+
+	runes := []rune(value)
+	if len(runes) <= visibleSuffix {
+		return strings.Repeat("*", len(runes))
+	}
+	return strings.Repeat("*", len(runes)-visibleSuffix) + string(runes[len(runes)-visibleSuffix:])
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
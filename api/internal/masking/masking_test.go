@@ -0,0 +1,112 @@
+package masking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func TestApply(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("segredo"))
+	mac.Write([]byte("12345678901"))
+	hashed := hex.EncodeToString(mac.Sum(nil))
+
+	tests := []struct {
+		name   string
+		policy models.ColumnPolicy
+		value  interface{}
+		want   interface{}
+		hidden bool
+	}{
+		{"mask com pattern", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask, Pattern: "***.###.###-**"}, "12345678901", "***.456.789-**", false},
+		{"pattern ignora pontuacao", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask, Pattern: "***.###.###-**"}, "123.456.789-01", "***.456.789-**", false},
+		{"mask padrao mostra o fim", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask}, "12345678901", "*******8901", false},
+		{"mask padrao em valor curto", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask}, "123", "***", false},
+		{"mask padrao em email", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask}, "joao@empresa.com", "j***@empresa.com", false},
+		{"mask em numero", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask}, float64(1234567), "***4567", false},
+		{"hash usa HMAC", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyHash}, "12345678901", hashed, false},
+		{"truncate", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyTruncate, Length: 3}, "12345678901", "123", false},
+		{"truncate maior que o valor", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyTruncate, Length: 30}, "123", "123", false},
+		{"acao desconhecida esconde", models.ColumnPolicy{Column: "cpf", Action: "reverse"}, "abc", "***", false},
+		{"nulo continua nulo", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyMask}, nil, nil, false},
+		{"hide remove a coluna", models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyHide}, "12345678901", nil, true},
+		{"coluna sem diferenciar maiusculas", models.ColumnPolicy{Column: "CPF", Action: models.ColumnPolicyTruncate, Length: 1}, "12345678901", "1", false},
+	}
+
+	masker := NewMasker("segredo")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := []map[string]interface{}{{"cpf": tt.value, "nome": "Joao"}}
+			masker.Apply(rows, []models.ColumnPolicy{tt.policy}, nil)
+
+			got, present := rows[0]["cpf"]
+			if tt.hidden {
+				if present {
+					t.Fatalf("coluna deveria ter sido removida, veio %v", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Fatalf("cpf = %v, esperava %v", got, tt.want)
+			}
+			if rows[0]["nome"] != "Joao" {
+				t.Fatalf("coluna sem politica foi alterada: %v", rows[0]["nome"])
+			}
+		})
+	}
+}
+
+func TestApplyRoles(t *testing.T) {
+	policy := models.ColumnPolicy{Column: "cpf", Action: models.ColumnPolicyHide, UnmaskedRoles: []string{"auditor"}}
+
+	tests := []struct {
+		name      string
+		principal *models.Principal
+		wantSeen  bool
+	}{
+		{"sem autenticacao", nil, false},
+		{"sem a role", &models.Principal{Roles: []string{"vendas"}}, false},
+		{"com a role", &models.Principal{Roles: []string{"vendas", "auditor"}}, true},
+		{"admin key", &models.Principal{Admin: true}, true},
+	}
+
+	masker := NewMasker("segredo")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := []map[string]interface{}{{"cpf": "12345678901"}}
+			masker.Apply(rows, []models.ColumnPolicy{policy}, tt.principal)
+
+			if _, seen := rows[0]["cpf"]; seen != tt.wantSeen {
+				t.Fatalf("coluna visivel = %v, esperava %v", seen, tt.wantSeen)
+			}
+		})
+	}
+}
+
+func TestHashWithoutKey(t *testing.T) {
+	masker := NewMasker("")
+	policies := []models.ColumnPolicy{{Column: "cpf", Action: models.ColumnPolicyHash}}
+
+	if masker.CanHash() {
+		t.Fatal("CanHash() sem chave deveria ser false")
+	}
+	if err := masker.CheckPolicies(policies); err == nil {
+		t.Fatal("CheckPolicies() deveria recusar hash sem chave")
+	}
+	if err := masker.CheckPolicies([]models.ColumnPolicy{{Column: "cpf", Action: models.ColumnPolicyMask}}); err != nil {
+		t.Fatalf("CheckPolicies() recusou mask sem chave: %v", err)
+	}
+	if err := NewMasker("segredo").CheckPolicies(policies); err != nil {
+		t.Fatalf("CheckPolicies() recusou hash com chave: %v", err)
+	}
+
+	// Sem chave o valor nao pode sair como SHA-256 puro, reversivel por forca bruta
+	rows := []map[string]interface{}{{"cpf": "12345678901"}}
+	masker.Apply(rows, policies, nil)
+	if rows[0]["cpf"] != "***********" {
+		t.Fatalf("cpf = %v, esperava o valor escondido", rows[0]["cpf"])
+	}
+}
@@ -1,23 +1,58 @@
 package middleware
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 	"strings"
 
+	"github.com/adolp26/querybase/internal/models"
 	"github.com/gin-gonic/gin"
 )
 
+// KeyStore valida as API keys guardadas no banco de metadados.
+type KeyStore interface {
+	Authenticate(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+// TokenVerifier valida tokens JWT (Authorization: Bearer) e devolve o principal.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (*models.Principal, error)
+}
+
+// apiKeyContextKey guarda no contexto do Gin o registro da API key do banco
+// que autenticou a requisicao.
+const apiKeyContextKey = "api_key_record"
+
+// principalContextKey guarda no contexto do Gin quem fez a requisicao.
+const principalContextKey = "principal"
+
+// adminNameContextKey guarda o nome da admin key nomeada que autenticou a
+// requisicao.
+const adminNameContextKey = "admin_name"
+
 type AuthConfig struct {
 	APIKeys     []string
+	AdminKeys   []string
+	AdminNames  map[string]string
 	HeaderName  string
 	QueryParam  string
 	SkipPaths   []string
 	Enabled     bool
+
+	// Keys valida chaves emitidas pela API; as chaves do config.yaml continuam
+	// valendo.
+	Keys KeyStore
+
+	// Tokens valida tokens OIDC; nil desliga a autenticacao por Bearer.
+	Tokens TokenVerifier
 }
 
 func NewAuthConfig() *AuthConfig {
 	return &AuthConfig{
 		APIKeys:    []string{},
+		AdminKeys:  []string{},
+		AdminNames: map[string]string{},
 		HeaderName: "X-API-Key",
 		QueryParam: "api_key",
 		SkipPaths:  []string{"/health"},
@@ -29,12 +64,56 @@ func (c *AuthConfig) AddKey(key string) {
 	c.APIKeys = append(c.APIKeys, key)
 }
 
+// AddAdminKey registra uma chave com acesso tambem as rotas /api/admin.
+func (c *AuthConfig) AddAdminKey(key string) {
+	c.AdminKeys = append(c.AdminKeys, key)
+}
+
+// AddNamedAdminKey registra uma admin key ligada a uma pessoa; o nome passa a
+// ser a identidade dela na revisao de queries.
+func (c *AuthConfig) AddNamedAdminKey(name, key string) {
+	c.AddAdminKey(key)
+	c.AdminNames[key] = name
+}
+
+// markAdmin marca a requisicao feita com uma admin key e, se ela for nomeada,
+// guarda a identidade de quem a usou.
+func (c *AuthConfig) markAdmin(ctx *gin.Context, key string) {
+	ctx.Set("is_admin", true)
+	if name, ok := c.AdminNames[key]; ok {
+		ctx.Set(adminNameContextKey, name)
+	}
+}
+
+func (c *AuthConfig) isAdminKey(key string) bool {
+	for _, adminKey := range c.AdminKeys {
+		if key == adminKey {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *AuthConfig) requestKey(ctx *gin.Context) string {
+	apiKey := ctx.GetHeader(c.HeaderName)
+	if apiKey == "" {
+		apiKey = ctx.Query(c.QueryParam)
+	}
+	return apiKey
+}
+
 func (c *AuthConfig) SetEnabled(enabled bool) {
 	c.Enabled = enabled
 }
 
 func APIKeyAuth(config *AuthConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Marca requisicoes com admin key mesmo com a autenticacao desligada:
+		// o autor de uma query em draft so pode executa-la com uma admin key.
+		if key := config.requestKey(c); key != "" && config.isAdminKey(key) {
+			config.markAdmin(c, key)
+		}
+
 		if !config.Enabled {
 			c.Next()
 			return
@@ -47,11 +126,27 @@ func APIKeyAuth(config *AuthConfig) gin.HandlerFunc {
 			}
 		}
 
-		apiKey := c.GetHeader(config.HeaderName)
-		if apiKey == "" {
-			apiKey = c.Query(config.QueryParam)
+		// So "Authorization: Bearer" segue para o OIDC; outros esquemas (Basic
+		// de um proxy, por exemplo) continuam no fluxo de API key
+		if token, ok := extractBearerToken(c.GetHeader("Authorization")); config.Tokens != nil && ok {
+			principal, err := config.Tokens.Verify(c.Request.Context(), token)
+			if err != nil {
+				// O motivo fica no log: na resposta ajudaria a forjar tokens
+				fmt.Printf("[Auth] Token recusado (%s %s): %v\n", c.Request.Method, c.Request.URL.Path, err)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"error":   "Invalid token",
+					"message": "The provided token is not valid",
+				})
+				return
+			}
+
+			c.Set(principalContextKey, principal)
+			c.Next()
+			return
 		}
 
+		apiKey := config.requestKey(c)
+
 		if apiKey == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "API key required",
@@ -60,7 +155,7 @@ func APIKeyAuth(config *AuthConfig) gin.HandlerFunc {
 			return
 		}
 
-		valid := false
+		valid := config.isAdminKey(apiKey)
 		for _, key := range config.APIKeys {
 			if apiKey == key {
 				valid = true
@@ -68,6 +163,23 @@ func APIKeyAuth(config *AuthConfig) gin.HandlerFunc {
 			}
 		}
 
+		if !valid && config.Keys != nil {
+			if record, err := config.Keys.Authenticate(c.Request.Context(), apiKey); err == nil {
+				c.Set(apiKeyContextKey, record)
+				c.Set("api_key", record.Prefix)
+				c.Set(principalContextKey, &models.Principal{
+					Subject:    "api_key:" + record.Name,
+					Type:       models.PrincipalAPIKey,
+					Roles:      record.Roles,
+					Attributes: record.Attributes,
+					Restricted: true,
+					Scopes:     []models.Scope{record.Scopes},
+				})
+				c.Next()
+				return
+			}
+		}
+
 		if !valid {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
 				"error":   "Invalid API key",
@@ -76,14 +188,79 @@ func APIKeyAuth(config *AuthConfig) gin.HandlerFunc {
 			return
 		}
 
+		principal := &models.Principal{Subject: "config_key", Type: models.PrincipalStaticKey}
+		if config.isAdminKey(apiKey) {
+			principal.Subject = "admin_key"
+			principal.Admin = true
+			if name, ok := config.AdminNames[apiKey]; ok {
+				principal.Subject = "admin_key:" + name
+			}
+		}
+
 		c.Set("api_key", apiKey)
+		c.Set(principalContextKey, principal)
 		c.Next()
 	}
 }
 
-func extractBearerToken(header string) string {
-	if strings.HasPrefix(header, "Bearer ") {
-		return strings.TrimPrefix(header, "Bearer ")
+// RequireAdmin restringe o grupo a chaves de administrador. Vale mesmo com
+// enable_auth desligado: sem admin keys configuradas as rotas ficam fechadas.
+func RequireAdmin(config *AuthConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := config.requestKey(c)
+
+		if apiKey == "" || !config.isAdminKey(apiKey) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":   "Admin API key required",
+				"message": "This endpoint requires a key listed in security.admin_api_keys",
+			})
+			return
+		}
+
+		c.Set("api_key", apiKey)
+		config.markAdmin(c, apiKey)
+		c.Next()
+	}
+}
+
+// APIKeyFromContext devolve a API key do banco que autenticou a requisicao, ou
+// nil quando a requisicao usou uma chave do config.yaml.
+func APIKeyFromContext(c *gin.Context) *models.APIKey {
+	if value, exists := c.Get(apiKeyContextKey); exists {
+		if key, ok := value.(*models.APIKey); ok {
+			return key
+		}
 	}
-	return header
+	return nil
+}
+
+// AdminIdentity devolve o nome da admin key nomeada que autenticou a
+// requisicao. Admin keys sem nome e headers como X-Actor nao identificam
+// ninguem.
+func AdminIdentity(c *gin.Context) (string, bool) {
+	name := c.GetString(adminNameContextKey)
+	return name, name != ""
+}
+
+// PrincipalFromContext devolve quem fez a requisicao, ou nil com a
+// autenticacao desligada.
+func PrincipalFromContext(c *gin.Context) *models.Principal {
+	if value, exists := c.Get(principalContextKey); exists {
+		if principal, ok := value.(*models.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// extractBearerToken devolve o token de um header "Authorization: Bearer
+// <token>". O esquema nao diferencia maiusculas (RFC 6750).
+func extractBearerToken(header string) (string, bool) {
+	const scheme = "Bearer "
+	if len(header) <= len(scheme) || !strings.EqualFold(header[:len(scheme)], scheme) {
+		return "", false
+	}
+
+	token := strings.TrimSpace(header[len(scheme):])
+	return token, token != ""
 }
@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+func TestExtractBearerToken(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+		ok     bool
+	}{
+		{"Bearer abc.def.ghi", "abc.def.ghi", true},
+		{"bearer abc.def.ghi", "abc.def.ghi", true},
+		{"Bearer   abc ", "abc", true},
+		{"Bearer ", "", false},
+		{"Basic dXNlcjpzZW5oYQ==", "", false},
+		{"abc.def.ghi", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		token, ok := extractBearerToken(tt.header)
+		if token != tt.token || ok != tt.ok {
+			t.Errorf("extractBearerToken(%q) = %q, %v; esperava %q, %v", tt.header, token, ok, tt.token, tt.ok)
+		}
+	}
+}
+
+// fakeTokens aceita apenas o token "valido".
+type fakeTokens struct{ calls int }
+
+func (f *fakeTokens) Verify(ctx context.Context, token string) (*models.Principal, error) {
+	f.calls++
+	if token != "valido" {
+		return nil, errors.New("assinatura invalida para a chave k1")
+	}
+	return &models.Principal{Subject: "joao", Type: models.PrincipalJWT}, nil
+}
+
+func TestAPIKeyAuthBearer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tokens := &fakeTokens{}
+	config := NewAuthConfig()
+	config.SetEnabled(true)
+	config.AddKey("chave-config")
+	config.Tokens = tokens
+
+	router := gin.New()
+	router.Use(APIKeyAuth(config))
+	router.GET("/api/queries", func(c *gin.Context) {
+		c.String(http.StatusOK, PrincipalFromContext(c).Subject)
+	})
+
+	request := func(headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/queries", nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("token valido", func(t *testing.T) {
+		w := request(map[string]string{"Authorization": "Bearer valido"})
+		if w.Code != http.StatusOK || w.Body.String() != "joao" {
+			t.Fatalf("status %d, corpo %q", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("token invalido nao expoe o motivo", func(t *testing.T) {
+		w := request(map[string]string{"Authorization": "Bearer forjado"})
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("status %d, esperava 401", w.Code)
+		}
+		if strings.Contains(w.Body.String(), "assinatura") {
+			t.Fatalf("resposta expoe o erro da verificacao: %s", w.Body.String())
+		}
+	})
+
+	t.Run("outro esquema segue para a API key", func(t *testing.T) {
+		calls := tokens.calls
+		w := request(map[string]string{
+			"Authorization": "Basic dXNlcjpzZW5oYQ==",
+			"X-API-Key":     "chave-config",
+		})
+		if w.Code != http.StatusOK || w.Body.String() != "config_key" {
+			t.Fatalf("status %d, corpo %q", w.Code, w.Body.String())
+		}
+		if tokens.calls != calls {
+			t.Fatal("header Basic foi enviado ao verificador OIDC")
+		}
+	})
+}
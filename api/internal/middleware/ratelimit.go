@@ -1,18 +1,50 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/ratelimit"
 	"github.com/gin-gonic/gin"
 )
 
+// Partes que compoem a chave de uma regra de rate limit.
+const (
+	RateLimitByKey       = "key"
+	RateLimitByPrincipal = "principal"
+	RateLimitByIP        = "ip"
+	RateLimitBySlug      = "slug"
+)
+
+// RateLimitConfig limita as requisicoes com o estado no Redis (Limiter), de
+// modo que o limite vale para o conjunto das replicas. A instancia principal
+// roda depois do APIKeyAuth, para poder separar os limites por chave ou
+// principal; uma instancia PreAuth roda antes, para que chaves invalidas e
+// tokens forjados tambem sejam limitados.
 type RateLimitConfig struct {
 	RequestsPerMinute int
 	BurstSize         int
 	Enabled           bool
 	SkipPaths         []string
+
+	Limiter ratelimit.Limiter
+
+	// Rules sao avaliadas em ordem e todas precisam liberar a requisicao. Sem
+	// regras, vale uma por chave com RequestsPerMinute e BurstSize; regras sem
+	// limite tambem herdam esses valores.
+	Rules []models.RateLimitRule
+
+	// PreAuth marca a instancia que roda antes do APIKeyAuth: ainda nao ha
+	// chave nem principal, entao as regras so agrupam por ip e slug, e sem
+	// regras nada e limitado.
+	PreAuth bool
 }
 
 func NewRateLimitConfig() *RateLimitConfig {
@@ -24,77 +56,100 @@ func NewRateLimitConfig() *RateLimitConfig {
 	}
 }
 
-type client struct {
-	tokens     float64
-	lastUpdate time.Time
-}
-
-type rateLimiter struct {
-	clients map[string]*client
-	mu      sync.Mutex
-	config  *RateLimitConfig
-}
-
-func newRateLimiter(config *RateLimitConfig) *rateLimiter {
-	rl := &rateLimiter{
-		clients: make(map[string]*client),
-		config:  config,
+// Validate confere as regras na inicializacao.
+func (c *RateLimitConfig) Validate() error {
+	if c.Enabled && c.Limiter == nil {
+		return fmt.Errorf("rate limit habilitado sem limiter")
 	}
 
-	go rl.cleanup()
-
-	return rl
-}
+	names := make(map[string]bool)
+	for i, rule := range c.Rules {
+		if rule.Name == "" {
+			return fmt.Errorf("regra de rate limit %d sem name", i+1)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("regra de rate limit '%s' repetida", rule.Name)
+		}
+		names[rule.Name] = true
 
-func (rl *rateLimiter) cleanup() {
-	ticker := time.NewTicker(5 * time.Minute)
-	for range ticker.C {
-		rl.mu.Lock()
-		for ip, c := range rl.clients {
-			if time.Since(c.lastUpdate) > 10*time.Minute {
-				delete(rl.clients, ip)
+		if len(rule.KeyBy) == 0 {
+			return fmt.Errorf("regra de rate limit '%s' sem key_by", rule.Name)
+		}
+		for _, part := range rule.KeyBy {
+			switch part {
+			case RateLimitByKey, RateLimitByPrincipal:
+				if c.PreAuth {
+					return fmt.Errorf("regra de rate limit '%s': key_by '%s' nao existe antes da autenticacao (use ip ou slug)", rule.Name, part)
+				}
+			case RateLimitByIP, RateLimitBySlug:
+			default:
+				return fmt.Errorf("regra de rate limit '%s': key_by '%s' invalido (use key, principal, ip ou slug)", rule.Name, part)
 			}
 		}
-		rl.mu.Unlock()
-	}
-}
-
-func (rl *rateLimiter) allow(ip string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	c, exists := rl.clients[ip]
-	now := time.Now()
-
-	if !exists {
-		rl.clients[ip] = &client{
-			tokens:     float64(rl.config.BurstSize) - 1,
-			lastUpdate: now,
+		if rule.RequestsPerMinute < 0 || rule.Burst < 0 {
+			return fmt.Errorf("regra de rate limit '%s': limites nao podem ser negativos", rule.Name)
 		}
-		return true
 	}
 
-	elapsed := now.Sub(c.lastUpdate).Seconds()
-	tokensPerSecond := float64(rl.config.RequestsPerMinute) / 60.0
-	c.tokens += elapsed * tokensPerSecond
+	return nil
+}
 
-	if c.tokens > float64(rl.config.BurstSize) {
-		c.tokens = float64(rl.config.BurstSize)
+func (c *RateLimitConfig) rules() []models.RateLimitRule {
+	if len(c.Rules) > 0 || c.PreAuth {
+		return c.Rules
 	}
+	return []models.RateLimitRule{{Name: "default", KeyBy: []string{RateLimitByKey}}}
+}
 
-	c.lastUpdate = now
+func (c *RateLimitConfig) limit(rule models.RateLimitRule) ratelimit.Limit {
+	limit := ratelimit.Limit{RequestsPerMinute: rule.RequestsPerMinute, Burst: rule.Burst}
+	if limit.RequestsPerMinute == 0 {
+		limit.RequestsPerMinute = c.RequestsPerMinute
+	}
+	if limit.Burst == 0 {
+		limit.Burst = c.BurstSize
+	}
+	return limit
+}
 
-	if c.tokens >= 1 {
-		c.tokens--
-		return true
+// rateLimitKey monta a chave da regra para a requisicao. Sem chave ou
+// principal (autenticacao desligada), o IP identifica o chamador. Regras por
+// slug so valem nas rotas com :slug.
+func rateLimitKey(c *gin.Context, rule models.RateLimitRule) (string, bool) {
+	parts := make([]string, 0, len(rule.KeyBy)+1)
+	parts = append(parts, rule.Name)
+
+	for _, part := range rule.KeyBy {
+		switch part {
+		case RateLimitByKey:
+			if apiKey := c.GetString("api_key"); apiKey != "" {
+				// A chave do config.yaml chega em texto puro; o Redis so ve o hash
+				sum := sha256.Sum256([]byte(apiKey))
+				parts = append(parts, "key="+hex.EncodeToString(sum[:8]))
+			} else {
+				parts = append(parts, "ip="+c.ClientIP())
+			}
+		case RateLimitByPrincipal:
+			if principal := PrincipalFromContext(c); principal != nil {
+				parts = append(parts, "principal="+principal.Type+":"+principal.Subject)
+			} else {
+				parts = append(parts, "ip="+c.ClientIP())
+			}
+		case RateLimitByIP:
+			parts = append(parts, "ip="+c.ClientIP())
+		case RateLimitBySlug:
+			slug := c.Param("slug")
+			if slug == "" {
+				return "", false
+			}
+			parts = append(parts, "slug="+slug)
+		}
 	}
 
-	return false
+	return strings.Join(parts, "|"), true
 }
 
 func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
-	limiter := newRateLimiter(config)
-
 	return func(c *gin.Context) {
 		if !config.Enabled {
 			c.Next()
@@ -108,18 +163,77 @@ func RateLimit(config *RateLimitConfig) gin.HandlerFunc {
 			}
 		}
 
-		ip := c.ClientIP()
+		// Os headers descrevem a regra mais perto de esgotar
+		var tightest *ratelimit.Result
+		var tightestLimit ratelimit.Limit
 
-		if !limiter.allow(ip) {
-			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-				"error":   "Rate limit exceeded",
-				"message": "Too many requests. Please try again later.",
-				"limit":   config.RequestsPerMinute,
-				"unit":    "requests per minute",
-			})
-			return
+		for _, rule := range config.rules() {
+			key, applies := rateLimitKey(c, rule)
+			if !applies {
+				continue
+			}
+			if config.PreAuth {
+				// Regras com o mesmo nome nas duas instancias nao dividem o contador
+				key = "pre_auth|" + key
+			}
+
+			limit := config.limit(rule)
+			result, err := config.Limiter.Allow(c.Request.Context(), key, limit)
+			if err != nil {
+				// Sem Redis a API continua respondendo, sem limite
+				fmt.Printf("[RateLimit] Regra '%s' ignorada: %v\n", rule.Name, err)
+				continue
+			}
+
+			if !result.Allowed {
+				setRateLimitHeaders(c, result, limit)
+				retryAfter := ceilSeconds(result.RetryAfter)
+				if retryAfter < 1 {
+					retryAfter = 1
+				}
+				c.Header("Retry-After", strconv.Itoa(retryAfter))
+
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+					"error":       "Rate limit exceeded",
+					"message":     "Too many requests. Please try again later.",
+					"rule":        rule.Name,
+					"limit":       limit.RequestsPerMinute,
+					"unit":        "requests per minute",
+					"retry_after": retryAfter,
+				})
+				return
+			}
+
+			if tightest == nil || result.Remaining < tightest.Remaining {
+				tightest = result
+				tightestLimit = limit
+			}
+		}
+
+		// Os headers da outra instancia (pre ou pos autenticacao) ficam se a
+		// regra dela estiver mais perto de esgotar
+		if tightest != nil && !tighterHeaderSet(c, tightest.Remaining) {
+			setRateLimitHeaders(c, tightest, tightestLimit)
 		}
 
 		c.Next()
 	}
 }
+
+// setRateLimitHeaders escreve os headers RateLimit-* (draft IETF
+// ratelimit-headers): limite, restante e segundos ate o reset.
+func setRateLimitHeaders(c *gin.Context, result *ratelimit.Result, limit ratelimit.Limit) {
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+	c.Header("RateLimit-Policy", fmt.Sprintf("%d;w=60", limit.RequestsPerMinute))
+}
+
+func tighterHeaderSet(c *gin.Context, remaining int) bool {
+	previous, err := strconv.Atoi(c.Writer.Header().Get("RateLimit-Remaining"))
+	return err == nil && previous <= remaining
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
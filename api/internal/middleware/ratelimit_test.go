@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// countingLimiter libera as primeiras Burst chamadas de cada chave.
+type countingLimiter struct {
+	counts map[string]int
+	err    error
+}
+
+func (l *countingLimiter) Allow(_ context.Context, key string, limit ratelimit.Limit) (*ratelimit.Result, error) {
+	if l.err != nil {
+		return nil, l.err
+	}
+	l.counts[key]++
+	remaining := limit.Burst - l.counts[key]
+	return &ratelimit.Result{
+		Allowed:   remaining >= 0,
+		Limit:     limit.Burst,
+		Remaining: max(remaining, 0),
+	}, nil
+}
+
+// rateLimitedRouter monta a mesma ordem do main: limite por IP, autenticacao
+// e limite por chave.
+func rateLimitedRouter(limiter ratelimit.Limiter) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	postAuth := NewRateLimitConfig()
+	postAuth.Enabled = true
+	postAuth.Limiter = limiter
+	postAuth.Rules = []models.RateLimitRule{{Name: "por-chave", KeyBy: []string{RateLimitByKey}, Burst: 5}}
+
+	preAuth := *postAuth
+	preAuth.PreAuth = true
+	preAuth.Rules = []models.RateLimitRule{{Name: "por-ip", KeyBy: []string{RateLimitByIP}, Burst: 3}}
+
+	auth := NewAuthConfig()
+	auth.SetEnabled(true)
+	auth.AddKey("chave-valida")
+
+	router := gin.New()
+	router.Use(RateLimit(&preAuth))
+	router.Use(APIKeyAuth(auth))
+	router.Use(RateLimit(postAuth))
+	router.GET("/api/queries", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return router
+}
+
+func get(router *gin.Engine, apiKey string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/queries", nil)
+	req.RemoteAddr = "10.0.0.7:5555"
+	req.Header.Set("X-API-Key", apiKey)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimitBeforeAuth(t *testing.T) {
+	limiter := &countingLimiter{counts: map[string]int{}}
+	router := rateLimitedRouter(limiter)
+
+	for i := 0; i < 3; i++ {
+		if w := get(router, "chave-errada"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("tentativa %d: status %d, esperava 401", i+1, w.Code)
+		}
+	}
+
+	// Esgotado o limite por IP, nem a autenticacao roda
+	w := get(router, "chave-errada")
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), "por-ip") {
+		t.Fatalf("status %d, corpo %s; esperava 429 da regra por-ip", w.Code, w.Body.String())
+	}
+
+	for key := range limiter.counts {
+		if !strings.HasPrefix(key, "pre_auth|") {
+			t.Fatalf("chave invalida contou na regra pos-autenticacao: %s", key)
+		}
+	}
+}
+
+func TestRateLimitHeadersKeepTightestRule(t *testing.T) {
+	router := rateLimitedRouter(&countingLimiter{counts: map[string]int{}})
+
+	w := get(router, "chave-valida")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, esperava 200", w.Code)
+	}
+
+	// por-ip (burst 3) esta mais perto de esgotar que por-chave (burst 5)
+	if got := w.Header().Get("RateLimit-Remaining"); got != "2" {
+		t.Fatalf("RateLimit-Remaining = %s, esperava 2", got)
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	router := rateLimitedRouter(&countingLimiter{err: errors.New("redis: connection refused")})
+
+	for i := 0; i < 10; i++ {
+		if w := get(router, "chave-valida"); w.Code != http.StatusOK {
+			t.Fatalf("requisicao %d com o Redis fora: status %d, esperava 200", i+1, w.Code)
+		}
+	}
+}
+
+func TestRateLimitValidatePreAuth(t *testing.T) {
+	config := NewRateLimitConfig()
+	config.PreAuth = true
+	config.Rules = []models.RateLimitRule{{Name: "por-chave", KeyBy: []string{RateLimitByKey}}}
+
+	if err := config.Validate(); err == nil {
+		t.Fatal("regra por chave aceita antes da autenticacao")
+	}
+
+	config.Rules = []models.RateLimitRule{{Name: "por-ip-query", KeyBy: []string{RateLimitByIP, RateLimitBySlug}}}
+	if err := config.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sem regras, a instancia pre-autenticacao nao limita nada
+	config.Rules = nil
+	if rules := config.rules(); len(rules) != 0 {
+		t.Fatalf("rules() = %v, esperava nenhuma", rules)
+	}
+}
@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"regexp"
+	"fmt"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -22,43 +22,21 @@ func SecurityHeaders() gin.HandlerFunc {
 	}
 }
 
-var dangerousPatterns = []*regexp.Regexp{
-	regexp.MustCompile(`(?i)(union\s+select)`),
-	regexp.MustCompile(`(?i)(insert\s+into)`),
-	regexp.MustCompile(`(?i)(delete\s+from)`),
-	regexp.MustCompile(`(?i)(drop\s+table)`),
-	regexp.MustCompile(`(?i)(update\s+\w+\s+set)`),
-	regexp.MustCompile(`(?i)(<script)`),
-	regexp.MustCompile(`(?i)(javascript:)`),
-	regexp.MustCompile(`(?i)(on\w+\s*=)`),
-}
-
-func InputSanitizer() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		for key, values := range c.Request.URL.Query() {
-			for _, value := range values {
-				if containsDangerousPattern(value) {
-					c.AbortWithStatusJSON(400, gin.H{
-						"error":   "Invalid input",
-						"message": "Parameter '" + key + "' contains invalid characters",
-					})
-					return
-				}
-			}
-		}
-
-		c.Next()
+// LogSecurityEvent registra uma recusa por motivo de seguranca (parametro fora
+// da politica, parametro vinculado enviado pelo cliente), com quem fez a
+// requisicao. fields sao pares chave/valor e nunca devem trazer o valor
+// enviado: CPF, email e textos de busca sao dados pessoais e nao vao para o
+// log, so o nome do parametro, a regra e o tamanho.
+func LogSecurityEvent(c *gin.Context, event string, fields ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "[Security] event=%s path=%s ip=%s", event, c.Request.URL.Path, c.ClientIP())
+	if principal := PrincipalFromContext(c); principal != nil {
+		fmt.Fprintf(&b, " principal=%q", principal.Subject)
 	}
-}
 
-func containsDangerousPattern(input string) bool {
-	normalized := strings.ToLower(strings.TrimSpace(input))
-
-	for _, pattern := range dangerousPatterns {
-		if pattern.MatchString(normalized) {
-			return true
-		}
+	for i := 0; i+1 < len(fields); i += 2 {
+		fmt.Fprintf(&b, " %s=%q", fields[i], fields[i+1])
 	}
 
-	return false
+	fmt.Println(b.String())
 }
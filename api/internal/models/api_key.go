@@ -0,0 +1,32 @@
+package models
+
+import "time"
+
+// APIKey e uma chave emitida pela API. O segredo nunca e guardado: apenas o
+// prefixo, usado para localizar o registro, e o hash com salt.
+type APIKey struct {
+	ID          string            `json:"id" db:"id"`
+	Name        string            `json:"name" db:"name"`
+	Owner       *string           `json:"owner,omitempty" db:"owner"`
+	Prefix      string            `json:"prefix" db:"key_prefix"`
+	Hash        string            `json:"-" db:"key_hash"`
+	Salt        string            `json:"-" db:"salt"`
+	Scopes      Scope             `json:"scopes" db:"scopes"`
+	Roles       []string          `json:"roles" db:"roles"`
+	Attributes  map[string]string `json:"attributes" db:"attributes"`
+	Quota       Quota             `json:"quota" db:"quota"`
+	ExpiresAt   *time.Time        `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt  *time.Time        `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt   *time.Time        `json:"revoked_at,omitempty" db:"revoked_at"`
+	RotatedFrom *string           `json:"rotated_from,omitempty" db:"rotated_from"`
+	CreatedAt   time.Time         `json:"created_at" db:"created_at"`
+	CreatedBy   *string           `json:"created_by,omitempty" db:"created_by"`
+}
+
+// Usable diz se a chave ainda pode autenticar.
+func (k *APIKey) Usable(now time.Time) bool {
+	if k.RevokedAt != nil {
+		return false
+	}
+	return k.ExpiresAt == nil || now.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAPIKeyUsable(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Minute)
+	future := now.Add(time.Minute)
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{"sem expiracao", APIKey{}, true},
+		{"expira depois", APIKey{ExpiresAt: &future}, true},
+		{"expirada", APIKey{ExpiresAt: &past}, false},
+		{"revogada", APIKey{RevokedAt: &past, ExpiresAt: &future}, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.key.Usable(now); got != tt.want {
+			t.Errorf("%s: Usable() = %v, esperava %v", tt.name, got, tt.want)
+		}
+	}
+}
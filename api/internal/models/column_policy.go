@@ -0,0 +1,38 @@
+package models
+
+// Acoes das politicas de coluna.
+const (
+	ColumnPolicyHide     = "hide"
+	ColumnPolicyMask     = "mask"
+	ColumnPolicyHash     = "hash"
+	ColumnPolicyTruncate = "truncate"
+)
+
+// ColumnPolicy mascara uma coluna do resultado para quem nao tem uma das
+// UnmaskedRoles. Pattern vale para mask e Length para truncate.
+type ColumnPolicy struct {
+	Column        string   `json:"column" yaml:"column"`
+	Action        string   `json:"action" yaml:"action"`
+	Pattern       string   `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Length        int      `json:"length,omitempty" yaml:"length,omitempty"`
+	UnmaskedRoles []string `json:"unmasked_roles,omitempty" yaml:"unmasked_roles,omitempty"`
+}
+
+// AppliesTo diz se o principal recebe a coluna mascarada. Admin keys veem os
+// valores completos; sem autenticacao a politica sempre vale.
+func (p ColumnPolicy) AppliesTo(principal *Principal) bool {
+	if principal == nil {
+		return true
+	}
+	if principal.Admin {
+		return false
+	}
+	for _, role := range principal.Roles {
+		for _, unmasked := range p.UnmaskedRoles {
+			if role == unmasked {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -5,15 +5,79 @@ type Config struct {
 	Redis    RedisConfig    `mapstructure:"redis"`
 	Postgres PostgresConfig `mapstructure:"postgres"`
 	Security SecurityConfig `mapstructure:"security"`
+	Pool     PoolConfig     `mapstructure:"pool"`
+	OIDC     OIDCConfig     `mapstructure:"oidc"`
+	Secrets  SecretsConfig  `mapstructure:"secrets"`
+
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	Quotas    QuotasConfig    `mapstructure:"quotas"`
 }
 
-type SecurityConfig struct {
-	APIKeys           []string `mapstructure:"api_keys"`
-	EnableAuth        bool     `mapstructure:"enable_auth"`
-	EnableRateLimit   bool     `mapstructure:"enable_rate_limit"`
+// QuotasConfig traz a cota diaria padrao das credenciais; a API key pode
+// definir a sua, campo a campo.
+type QuotasConfig struct {
+	DefaultPerKey Quota `mapstructure:"default_per_key"`
+}
+
+// RateLimitConfig configura o rate limit distribuido (Redis). Liga com
+// security.enable_rate_limit.
+type RateLimitConfig struct {
+	Algorithm string          `mapstructure:"algorithm"`
+	Rules     []RateLimitRule `mapstructure:"rules"`
+
+	// PreAuthRules rodam antes da autenticacao (so ip e slug), para limitar
+	// tambem quem tenta chaves ou tokens invalidos.
+	PreAuthRules []RateLimitRule `mapstructure:"pre_auth_rules"`
+}
+
+// RateLimitRule limita as requisicoes agrupadas por KeyBy (key, principal, ip,
+// slug). Limites zerados herdam security.requests_per_minute/burst_size.
+type RateLimitRule struct {
+	Name              string   `mapstructure:"name"`
+	KeyBy             []string `mapstructure:"key_by"`
 	RequestsPerMinute int      `mapstructure:"requests_per_minute"`
-	BurstSize         int      `mapstructure:"burst_size"`
-	AllowedOrigins    []string `mapstructure:"allowed_origins"`
+	Burst             int      `mapstructure:"burst"`
+}
+
+// SecretsConfig configura a resolucao de password_ref dos datasources.
+// EnvPrefix, FileDirs e Vault.MountPrefix limitam o que um password_ref pode
+// ler; vazio desabilita o esquema.
+type SecretsConfig struct {
+	CacheTTL  int               `mapstructure:"cache_ttl"`
+	EnvPrefix string            `mapstructure:"env_prefix"`
+	FileDirs  []string          `mapstructure:"file_dirs"`
+	Vault     VaultSecretConfig `mapstructure:"vault"`
+}
+
+type VaultSecretConfig struct {
+	Address     string `mapstructure:"address"`
+	Token       string `mapstructure:"token"`
+	MountPrefix string `mapstructure:"mount_prefix"`
+}
+
+type SecurityConfig struct {
+	APIKeys           []string        `mapstructure:"api_keys"`
+	AdminAPIKeys      []string        `mapstructure:"admin_api_keys"`
+	NamedAdminKeys    []NamedAdminKey `mapstructure:"named_admin_keys"`
+	APIKeyCacheTTL    int             `mapstructure:"api_key_cache_ttl"`
+	MaskHashKey       string          `mapstructure:"mask_hash_key"`
+	EnableAuth        bool            `mapstructure:"enable_auth"`
+	EnableRateLimit   bool            `mapstructure:"enable_rate_limit"`
+	RequestsPerMinute int             `mapstructure:"requests_per_minute"`
+	BurstSize         int             `mapstructure:"burst_size"`
+	AllowedOrigins    []string        `mapstructure:"allowed_origins"`
+
+	// TrustedProxies sao os proxies cujo X-Forwarded-For vale como IP do
+	// cliente. Vazio usa o IP da conexao: o header de qualquer cliente
+	// burlaria o rate limit por IP.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
+}
+
+// NamedAdminKey e uma admin key ligada a uma pessoa. O nome e a identidade
+// usada na revisao de queries: quem envia, aprova e escreve cada versao.
+type NamedAdminKey struct {
+	Name string `mapstructure:"name"`
+	Key  string `mapstructure:"key"`
 }
 
 type ServerConfig struct {
@@ -37,3 +101,36 @@ type PostgresConfig struct {
 	Password string `mapstructure:"password"`
 	SSLMode  string `mapstructure:"sslmode"`
 }
+
+type PoolConfig struct {
+	HealthCheckInterval int `mapstructure:"health_check_interval"`
+	HealthCheckTimeout  int `mapstructure:"health_check_timeout"`
+	DownAfterFailures   int `mapstructure:"down_after_failures"`
+
+	BreakerFailureThreshold int `mapstructure:"breaker_failure_threshold"`
+	BreakerOpenTimeout      int `mapstructure:"breaker_open_timeout"`
+	BreakerHalfOpenProbes   int `mapstructure:"breaker_half_open_probes"`
+
+	MaxQueuedQueries int `mapstructure:"max_queued_queries"`
+	QueueTimeout     int `mapstructure:"queue_timeout"`
+
+	IdlePoolTimeout int `mapstructure:"idle_pool_timeout"`
+	JanitorInterval int `mapstructure:"janitor_interval"`
+}
+
+// OIDCConfig habilita tokens JWT (Authorization: Bearer) emitidos por um
+// provedor OIDC, alem das API keys.
+type OIDCConfig struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	Issuer          string `mapstructure:"issuer"`
+	Audience        string `mapstructure:"audience"`
+	JWKSURL         string `mapstructure:"jwks_url"`
+	JWKSFile        string `mapstructure:"jwks_file"`
+	RefreshInterval int    `mapstructure:"refresh_interval"`
+	Leeway          int    `mapstructure:"leeway"`
+
+	SubjectClaim string              `mapstructure:"subject_claim"`
+	RoleClaims   []string            `mapstructure:"role_claims"`
+	RoleMappings map[string][]string `mapstructure:"role_mappings"`
+	Permissions  map[string]Scope    `mapstructure:"permissions"`
+}
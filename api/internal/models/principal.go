@@ -0,0 +1,154 @@
+package models
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tipos de credencial que autenticam um Principal.
+const (
+	PrincipalStaticKey = "static_key"
+	PrincipalAPIKey    = "api_key"
+	PrincipalJWT       = "jwt"
+)
+
+// Principal e quem fez a requisicao, seja uma API key ou um usuario com token
+// OIDC. Fica no contexto do Gin para autorizacao e para o log de execucoes.
+type Principal struct {
+	Subject string   `json:"subject"`
+	Type    string   `json:"type"`
+	Roles   []string `json:"roles,omitempty"`
+
+	// Admin marca as admin keys do config.yaml, que passam pelas ACLs.
+	Admin bool `json:"admin,omitempty"`
+
+	// Restricted limita as queries aos Scopes; sem restricao, Scopes e ignorado.
+	Restricted bool    `json:"restricted"`
+	Scopes     []Scope `json:"scopes,omitempty"`
+
+	// Claims guarda os claims do token (JWT) para uso pelos handlers.
+	Claims map[string]interface{} `json:"-"`
+
+	// Attributes guarda os atributos da API key (ex.: branch_id).
+	Attributes map[string]string `json:"-"`
+}
+
+// Attribute devolve o valor usado pelos parametros vinculados: primeiro os
+// atributos da API key, depois os claims do token (aceita caminhos com ponto).
+// Apenas textos, numeros e booleanos servem como valor.
+func (p *Principal) Attribute(name string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	if value, ok := p.Attributes[name]; ok && value != "" {
+		return value, true
+	}
+
+	switch v := LookupClaim(p.Claims, name).(type) {
+	case string:
+		return v, v != ""
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// LookupClaim aceita caminhos com ponto, como "realm_access.roles".
+func LookupClaim(claims map[string]interface{}, path string) interface{} {
+	var current interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		current = object[part]
+	}
+	return current
+}
+
+// Allows diz se o principal pode executar a query: basta um dos scopes permitir.
+func (p *Principal) Allows(querySlug, datasourceSlug string, tags []string) bool {
+	if p == nil || !p.Restricted {
+		return true
+	}
+	for _, scope := range p.Scopes {
+		if scope.Allows(querySlug, datasourceSlug, tags) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasAnyRole diz se o principal pode acessar um recurso com a ACL allowed.
+// ACL vazia libera para qualquer principal.
+func (p *Principal) HasAnyRole(allowed []string) bool {
+	if len(allowed) == 0 || p == nil || p.Admin {
+		return true
+	}
+	for _, role := range p.Roles {
+		for _, a := range allowed {
+			if role == a {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// NormalizeRoles remove espacos, vazios e repetidos, passa para minusculas e
+// ordena; sem roles devolve nil.
+func NormalizeRoles(roles []string) []string {
+	seen := make(map[string]bool, len(roles))
+	var normalized []string
+	for _, role := range roles {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role == "" || seen[role] {
+			continue
+		}
+		seen[role] = true
+		normalized = append(normalized, role)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// Scope restringe quais queries podem ser executadas. Uma lista vazia nao
+// restringe aquela dimensao; os valores aceitam curingas no formato de
+// path.Match ("vendas-*").
+type Scope struct {
+	Queries     []string `json:"queries,omitempty" mapstructure:"queries"`
+	Datasources []string `json:"datasources,omitempty" mapstructure:"datasources"`
+	Tags        []string `json:"tags,omitempty" mapstructure:"tags"`
+}
+
+// Allows diz se o scope permite executar a query no datasource informado.
+func (s Scope) Allows(querySlug, datasourceSlug string, tags []string) bool {
+	if len(s.Queries) > 0 && !matchAny(s.Queries, querySlug) {
+		return false
+	}
+	if len(s.Datasources) > 0 && !matchAny(s.Datasources, datasourceSlug) {
+		return false
+	}
+	if len(s.Tags) > 0 {
+		for _, tag := range tags {
+			if matchAny(s.Tags, tag) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
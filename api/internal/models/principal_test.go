@@ -0,0 +1,146 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScopeAllows(t *testing.T) {
+	scopes := Scope{
+		Queries:     []string{"vendas-*", "clientes"},
+		Datasources: []string{"erp"},
+	}
+
+	if !scopes.Allows("vendas-por-dia", "erp", nil) {
+		t.Fatal("curinga de query nao liberou vendas-por-dia")
+	}
+	if scopes.Allows("estoque", "erp", nil) {
+		t.Fatal("query fora do scope foi liberada")
+	}
+	if scopes.Allows("clientes", "dw", nil) {
+		t.Fatal("datasource fora do scope foi liberado")
+	}
+
+	// Scope vazio nao restringe
+	if !(Scope{}).Allows("qualquer", "qualquer", nil) {
+		t.Fatal("scope vazio bloqueou a execucao")
+	}
+
+	// Com tags, basta uma tag da query bater
+	byTag := Scope{Tags: []string{"financeiro"}}
+	if !byTag.Allows("a", "b", []string{"vendas", "financeiro"}) {
+		t.Fatal("tag liberada nao foi reconhecida")
+	}
+	if byTag.Allows("a", "b", []string{"vendas"}) || byTag.Allows("a", "b", nil) {
+		t.Fatal("query sem a tag foi liberada")
+	}
+}
+
+func TestPrincipalAllows(t *testing.T) {
+	var anonymous *Principal
+	if !anonymous.Allows("vendas", "erp", nil) {
+		t.Fatal("principal nil deveria ser liberado")
+	}
+
+	if !(&Principal{Scopes: []Scope{{Queries: []string{"outra"}}}}).Allows("vendas", "erp", nil) {
+		t.Fatal("principal sem restricao foi limitado pelos scopes")
+	}
+
+	p := &Principal{
+		Restricted: true,
+		Scopes: []Scope{
+			{Queries: []string{"vendas-*"}, Datasources: []string{"erp"}},
+			{Tags: []string{"publico"}},
+		},
+	}
+
+	tests := []struct {
+		query, datasource string
+		tags              []string
+		want              bool
+	}{
+		{"vendas-por-dia", "erp", nil, true},
+		{"vendas-por-dia", "dw", nil, false},
+		{"clientes", "dw", []string{"publico"}, true},
+		{"clientes", "erp", []string{"interno"}, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allows(tt.query, tt.datasource, tt.tags); got != tt.want {
+			t.Errorf("Allows(%s, %s, %v) = %v, esperava %v", tt.query, tt.datasource, tt.tags, got, tt.want)
+		}
+	}
+
+	if (&Principal{Restricted: true}).Allows("vendas", "erp", nil) {
+		t.Fatal("principal restrito sem scopes foi liberado")
+	}
+}
+
+func TestHasAnyRole(t *testing.T) {
+	analyst := &Principal{Roles: []string{"analista", "vendas"}}
+
+	if !analyst.HasAnyRole(nil) {
+		t.Fatal("ACL vazia deveria liberar")
+	}
+	if !analyst.HasAnyRole([]string{"financeiro", "vendas"}) {
+		t.Fatal("role em comum nao liberou")
+	}
+	if analyst.HasAnyRole([]string{"financeiro"}) {
+		t.Fatal("principal sem a role foi liberado")
+	}
+	if (&Principal{}).HasAnyRole([]string{"financeiro"}) {
+		t.Fatal("principal sem roles foi liberado")
+	}
+	if !(&Principal{Admin: true}).HasAnyRole([]string{"financeiro"}) {
+		t.Fatal("admin deveria passar por qualquer ACL")
+	}
+}
+
+func TestNormalizeRoles(t *testing.T) {
+	got := NormalizeRoles([]string{" Vendas", "analista", "", "VENDAS", "  "})
+	if strings.Join(got, ",") != "analista,vendas" {
+		t.Fatalf("NormalizeRoles() = %v", got)
+	}
+	if got := NormalizeRoles([]string{" ", ""}); got != nil {
+		t.Fatalf("NormalizeRoles() sem roles = %#v, esperava nil", got)
+	}
+}
+
+func TestPrincipalAttribute(t *testing.T) {
+	p := &Principal{
+		Attributes: map[string]string{"tenant_id": "42", "vazio": ""},
+		Claims: map[string]interface{}{
+			"tenant_id": "99",
+			"vazio":     "7",
+			"filial":    float64(12),
+			"gerente":   true,
+			"org":       map[string]interface{}{"regiao": "sul"},
+			"grupos":    []interface{}{"a"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"tenant_id", "42", true}, // atributo da chave vence o claim
+		{"vazio", "7", true},      // atributo vazio cai para o claim
+		{"filial", "12", true},
+		{"gerente", "true", true},
+		{"org.regiao", "sul", true},
+		{"org.cidade", "", false},
+		{"grupos", "", false},
+		{"inexistente", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := p.Attribute(tt.name)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("Attribute(%q) = %q, %v; esperava %q, %v", tt.name, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	var nobody *Principal
+	if _, ok := nobody.Attribute("tenant_id"); ok {
+		t.Fatal("principal nil devolveu atributo")
+	}
+}
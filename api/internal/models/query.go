@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -13,6 +14,14 @@ type Query struct {
 	DatasourceID   *string          `json:"datasource_id,omitempty" db:"datasource_id"`
 	CacheTTL       int              `json:"cache_ttl" db:"cache_ttl"`
 	TimeoutSeconds int              `json:"timeout_seconds" db:"timeout_seconds"`
+	MaxConcurrency int              `json:"max_concurrency" db:"max_concurrency"`
+	Tags           []string         `json:"tags" db:"tags"`
+	AllowedRoles   []string         `json:"allowed_roles" db:"allowed_roles"`
+	ColumnPolicies []ColumnPolicy   `json:"column_policies" db:"column_policies"`
+	Quota          Quota            `json:"quota" db:"quota"`
+	PinnedVersion  *int             `json:"pinned_version,omitempty" db:"pinned_version"`
+	Status         string           `json:"status" db:"status"`
+	Version        int              `json:"version,omitempty" db:"-"`
 	IsActive       bool             `json:"is_active" db:"is_active"`
 	CreatedAt      time.Time        `json:"created_at" db:"created_at"`
 	UpdatedAt      time.Time        `json:"updated_at" db:"updated_at"`
@@ -21,8 +30,28 @@ type Query struct {
 	Parameters     []QueryParameter `json:"parameters,omitempty" db:"-"`
 	DatasourceSlug *string          `json:"datasource_slug,omitempty" db:"datasource_slug"`
 	DatasourceName *string          `json:"datasource_name,omitempty" db:"datasource_name"`
+
+	// ACL do datasource da query, lida junto para filtrar a listagem.
+	DatasourceAllowedRoles []string `json:"-" db:"datasource_allowed_roles"`
+
+	PublishedVersion *int       `json:"published_version,omitempty" db:"published_version"`
+	SubmittedVersion *int       `json:"submitted_version,omitempty" db:"submitted_version"`
+	SubmittedBy      *string    `json:"submitted_by,omitempty" db:"submitted_by"`
+	SubmittedAt      *time.Time `json:"submitted_at,omitempty" db:"submitted_at"`
+	ReviewedBy       *string    `json:"reviewed_by,omitempty" db:"reviewed_by"`
+	ReviewedAt       *time.Time `json:"reviewed_at,omitempty" db:"reviewed_at"`
+	ReviewComment    *string    `json:"review_comment,omitempty" db:"review_comment"`
 }
 
+// Status do ciclo de vida da query. O status descreve a definicao atual; os
+// consumidores recebem sempre a versao publicada (PublishedVersion).
+const (
+	QueryStatusDraft         = "draft"
+	QueryStatusPendingReview = "pending_review"
+	QueryStatusPublished     = "published"
+	QueryStatusDeprecated    = "deprecated"
+)
+
 type QueryParameter struct {
 	ID           string    `json:"id" db:"id"`
 	QueryID      string    `json:"query_id" db:"query_id"`
@@ -34,6 +63,25 @@ type QueryParameter struct {
 	Position     int       `json:"position" db:"position"`
 	Validations  *string   `json:"validations,omitempty" db:"validations"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+
+	// BindFrom liga o parametro a um atributo da credencial (claim do token
+	// ou atributo da API key); o cliente nao pode informar o valor.
+	BindFrom *string `json:"bind_from,omitempty" db:"bind_from"`
+}
+
+// QueryVersion e uma copia imutavel da definicao da query. Definition usa o
+// formato do catalogo (internal/catalog).
+type QueryVersion struct {
+	ID           string          `json:"id" db:"id"`
+	QueryID      string          `json:"query_id" db:"query_id"`
+	Version      int             `json:"version" db:"version"`
+	Definition   json.RawMessage `json:"definition" db:"definition"`
+	DatasourceID *string         `json:"datasource_id,omitempty" db:"datasource_id"`
+	ContentHash  string          `json:"content_hash" db:"content_hash"`
+	CreatedAt    time.Time       `json:"created_at" db:"created_at"`
+	CreatedBy    *string         `json:"created_by,omitempty" db:"created_by"`
+	ApprovedBy   *string         `json:"approved_by,omitempty" db:"approved_by"`
+	ApprovedAt   *time.Time      `json:"approved_at,omitempty" db:"approved_at"`
 }
 
 type QueryExecution struct {
@@ -48,6 +96,8 @@ type QueryExecution struct {
 	Error      *string   `json:"error,omitempty" db:"error"`
 	ClientIP   *string   `json:"client_ip,omitempty" db:"client_ip"`
 	UserAgent  *string   `json:"user_agent,omitempty" db:"user_agent"`
+	Principal  *string   `json:"principal,omitempty" db:"principal"`
+	Denied     bool      `json:"denied" db:"denied"`
 }
 
 type Datasource struct {
@@ -60,11 +110,20 @@ type Datasource struct {
 	DatabaseName string    `json:"database_name" db:"database_name"`
 	Username     string    `json:"-" db:"username"`
 	Password     string    `json:"-" db:"password"`
+	PasswordRef  *string   `json:"password_ref,omitempty" db:"password_ref"`
 	MaxOpenConns int       `json:"max_open_conns" db:"max_open_conns"`
 	MaxIdleConns int       `json:"max_idle_conns" db:"max_idle_conns"`
 	IsActive     bool      `json:"is_active" db:"is_active"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
+
+	MaxConcurrentQueries   int  `json:"max_concurrent_queries" db:"max_concurrent_queries"`
+	MaxQueuedQueries       int  `json:"max_queued_queries" db:"max_queued_queries"`
+	AllowWrites            bool `json:"allow_writes" db:"allow_writes"`
+	ConnMaxLifetimeSeconds int  `json:"conn_max_lifetime_seconds" db:"conn_max_lifetime_seconds"`
+	ConnMaxIdleTimeSeconds int  `json:"conn_max_idle_time_seconds" db:"conn_max_idle_time_seconds"`
+
+	AllowedRoles []string `json:"allowed_roles" db:"allowed_roles"`
 }
 
 func (q *Query) GetParameterByPosition(position int) *QueryParameter {
@@ -0,0 +1,46 @@
+package models
+
+// Quota limita o consumo diario (dia UTC) de uma API key ou de uma query.
+// Campos zerados nao limitam.
+type Quota struct {
+	// RowsPerDay conta as linhas devolvidas, inclusive as vindas do cache.
+	RowsPerDay int64 `json:"rows_per_day,omitempty" yaml:"rows_per_day,omitempty" mapstructure:"rows_per_day"`
+
+	// ExecutionsPerDay conta so as execucoes que foram ao banco (sem cache).
+	ExecutionsPerDay int64 `json:"executions_per_day,omitempty" yaml:"executions_per_day,omitempty" mapstructure:"executions_per_day"`
+
+	// DBSecondsPerDay soma a duracao das execucoes sem cache.
+	DBSecondsPerDay int64 `json:"db_seconds_per_day,omitempty" yaml:"db_seconds_per_day,omitempty" mapstructure:"db_seconds_per_day"`
+}
+
+// IsZero diz se nenhum limite foi definido.
+func (q Quota) IsZero() bool {
+	return q.RowsPerDay == 0 && q.ExecutionsPerDay == 0 && q.DBSecondsPerDay == 0
+}
+
+// WithDefaults preenche os campos zerados com os de defaults.
+func (q Quota) WithDefaults(defaults Quota) Quota {
+	if q.RowsPerDay == 0 {
+		q.RowsPerDay = defaults.RowsPerDay
+	}
+	if q.ExecutionsPerDay == 0 {
+		q.ExecutionsPerDay = defaults.ExecutionsPerDay
+	}
+	if q.DBSecondsPerDay == 0 {
+		q.DBSecondsPerDay = defaults.DBSecondsPerDay
+	}
+	return q
+}
+
+// Invalid devolve o primeiro campo negativo, ou "" se a cota for valida.
+func (q Quota) Invalid() string {
+	switch {
+	case q.RowsPerDay < 0:
+		return "rows_per_day"
+	case q.ExecutionsPerDay < 0:
+		return "executions_per_day"
+	case q.DBSecondsPerDay < 0:
+		return "db_seconds_per_day"
+	}
+	return ""
+}
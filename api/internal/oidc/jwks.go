@@ -0,0 +1,248 @@
+// Package oidc valida tokens JWT emitidos por um provedor OIDC, com as chaves
+// publicas lidas de um JWKS (URL ou arquivo local).
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval evita que tokens com kid desconhecido forcem uma busca
+// do JWKS a cada requisicao.
+const minRefreshInterval = 30 * time.Second
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// KeySet guarda as chaves do JWKS em memoria e as recarrega periodicamente ou
+// quando aparece um token assinado com um kid desconhecido.
+type KeySet struct {
+	url    string
+	file   string
+	client *http.Client
+
+	mu          sync.RWMutex
+	keys        map[string]publicKey
+	lastRefresh time.Time
+}
+
+func NewKeySet(url, file string) (*KeySet, error) {
+	if url == "" && file == "" {
+		return nil, errors.New("informe oidc.jwks_url ou oidc.jwks_file")
+	}
+
+	return &KeySet{
+		url:    url,
+		file:   file,
+		client: &http.Client{Timeout: 10 * time.Second},
+		keys:   make(map[string]publicKey),
+	}, nil
+}
+
+// StartRefresh recarrega o JWKS a cada interval ate o contexto ser cancelado.
+func (ks *KeySet) StartRefresh(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := ks.Refresh(ctx); err != nil {
+					fmt.Printf("[OIDC] Erro ao recarregar JWKS: %v\n", err)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh busca o JWKS e substitui as chaves em memoria. Em caso de erro as
+// chaves anteriores continuam valendo.
+func (ks *KeySet) Refresh(ctx context.Context) error {
+	data, err := ks.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("JWKS invalido: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			fmt.Printf("[OIDC] Chave '%s' ignorada: %v\n", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+
+	if len(keys) == 0 {
+		return errors.New("JWKS sem chaves de assinatura utilizaveis")
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.lastRefresh = time.Now()
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) fetch(ctx context.Context) ([]byte, error) {
+	if ks.file != "" {
+		data, err := os.ReadFile(ks.file)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler JWKS: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ks.url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ks.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("erro ao buscar JWKS: status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// lookup devolve a chave do kid. Um kid desconhecido recarrega o JWKS, no
+// maximo uma vez a cada minRefreshInterval, para pegar chaves rotacionadas.
+func (ks *KeySet) lookup(ctx context.Context, kid string) (publicKey, error) {
+	if key, ok := ks.find(kid); ok {
+		return key, nil
+	}
+
+	ks.mu.RLock()
+	recent := time.Since(ks.lastRefresh) < minRefreshInterval
+	ks.mu.RUnlock()
+
+	if !recent {
+		if err := ks.Refresh(ctx); err != nil {
+			return publicKey{}, err
+		}
+		if key, ok := ks.find(kid); ok {
+			return key, nil
+		}
+	}
+
+	return publicKey{}, fmt.Errorf("chave '%s' nao encontrada no JWKS", kid)
+}
+
+func (ks *KeySet) find(kid string) (publicKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if key, ok := ks.keys[kid]; ok {
+		return key, true
+	}
+
+	// Token sem kid so e aceito quando o JWKS tem uma unica chave
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+
+	return publicKey{}, false
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, errors.New("expoente RSA invalido")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("curva nao suportada: %s", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("ponto fora da curva")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("tipo de chave nao suportado: %s", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("valor base64url invalido na chave")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,273 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+// ErrInvalidToken indica token malformado, com assinatura invalida, expirado
+// ou emitido para outro issuer/audience.
+var ErrInvalidToken = errors.New("token invalido")
+
+// Algoritmos aceitos. HS* e "none" ficam de fora: a API so confia em chaves
+// publicas do JWKS.
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+}
+
+// Verifier valida tokens JWT e monta o Principal a partir dos claims.
+type Verifier struct {
+	keys   *KeySet
+	config models.OIDCConfig
+	leeway time.Duration
+}
+
+// NewVerifier exige issuer e audience: sem eles, qualquer token assinado pelas
+// chaves do JWKS (inclusive os emitidos para outras aplicacoes do mesmo
+// provedor) seria aceito.
+func NewVerifier(keys *KeySet, config models.OIDCConfig) (*Verifier, error) {
+	if strings.TrimSpace(config.Issuer) == "" {
+		return nil, errors.New("informe oidc.issuer")
+	}
+	if strings.TrimSpace(config.Audience) == "" {
+		return nil, errors.New("informe oidc.audience")
+	}
+	if config.SubjectClaim == "" {
+		config.SubjectClaim = "sub"
+	}
+	if len(config.RoleClaims) == 0 {
+		config.RoleClaims = []string{"roles", "groups"}
+	}
+	if config.Leeway <= 0 {
+		config.Leeway = 60
+	}
+
+	return &Verifier{
+		keys:   keys,
+		config: config,
+		leeway: time.Duration(config.Leeway) * time.Second,
+	}, nil
+}
+
+// Verify confere assinatura, issuer, audience e validade do token e devolve o
+// principal com as roles mapeadas.
+func (v *Verifier) Verify(ctx context.Context, token string) (*models.Principal, error) {
+	claims, err := v.verify(ctx, token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, _ := models.LookupClaim(claims, v.config.SubjectClaim).(string)
+	if subject == "" {
+		return nil, fmt.Errorf("%w: claim '%s' ausente", ErrInvalidToken, v.config.SubjectClaim)
+	}
+
+	principal := &models.Principal{
+		Subject: subject,
+		Type:    models.PrincipalJWT,
+		Roles:   v.roles(claims),
+		Claims:  claims,
+	}
+
+	// Sem permissoes configuradas o token so autentica; com permissoes, cada
+	// role libera os scopes configurados para ela
+	if len(v.config.Permissions) > 0 {
+		principal.Restricted = true
+		for _, role := range principal.Roles {
+			if scope, ok := v.config.Permissions[role]; ok {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+	}
+
+	return principal, nil
+}
+
+func (v *Verifier) verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("formato JWT invalido")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("header invalido: %w", err)
+	}
+
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("algoritmo nao aceito: %s", header.Alg)
+	}
+
+	key, err := v.keys.lookup(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != header.Alg {
+		return nil, fmt.Errorf("algoritmo %s diferente do definido na chave (%s)", header.Alg, key.alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("assinatura invalida")
+	}
+	if err := verifySignature(header.Alg, hash, key.key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("payload invalido: %w", err)
+	}
+
+	if err := v.validateClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed, signature []byte) error {
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("chave nao e RSA")
+		}
+		var err error
+		if alg[:2] == "RS" {
+			err = rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(rsaKey, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto})
+		}
+		if err != nil {
+			return errors.New("assinatura invalida")
+		}
+
+	case "ES":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("chave nao e EC")
+		}
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("assinatura invalida")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return errors.New("assinatura invalida")
+		}
+	}
+
+	return nil
+}
+
+func (v *Verifier) validateClaims(claims map[string]interface{}, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.config.Issuer {
+		return fmt.Errorf("issuer '%s' nao aceito", iss)
+	}
+
+	if !hasAudience(claims["aud"], v.config.Audience) {
+		return errors.New("token emitido para outra audience")
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("claim exp ausente")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.leeway)) {
+		return errors.New("token expirado")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token ainda nao e valido")
+	}
+
+	return nil
+}
+
+// roles junta os valores dos claims de roles/grupos, aplica role_mappings e
+// normaliza para minusculas (o config.yaml tambem chega em minusculas).
+func (v *Verifier) roles(claims map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var roles []string
+
+	add := func(role string) {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if role != "" && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+
+	for _, claim := range v.config.RoleClaims {
+		for _, value := range claimStrings(models.LookupClaim(claims, claim)) {
+			mapped, ok := v.config.RoleMappings[strings.ToLower(value)]
+			if !ok {
+				add(value)
+				continue
+			}
+			for _, role := range mapped {
+				add(role)
+			}
+		}
+	}
+
+	return roles
+}
+
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func hasAudience(aud interface{}, expected string) bool {
+	for _, value := range claimStrings(aud) {
+		if value == expected {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, target interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, target)
+}
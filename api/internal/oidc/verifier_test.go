@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, header, claims map[string]interface{}) string {
+	t.Helper()
+	signed := encodeSegment(t, header) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writeJWKS grava a chave publica num arquivo, como oidc.jwks_file espera.
+func writeJWKS(t *testing.T, kid string, key *rsa.PublicKey) string {
+	t.Helper()
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := NewKeySet("", writeJWKS(t, "k1", &key.PublicKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := NewVerifier(keys, models.OIDCConfig{
+		Issuer:       "https://idp.exemplo.com",
+		Audience:     "querybase",
+		Leeway:       30,
+		RoleMappings: map[string][]string{"grp-financeiro": {"financeiro"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().Unix()
+	claims := func(overrides map[string]interface{}) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    "https://idp.exemplo.com",
+			"aud":    "querybase",
+			"sub":    "joao",
+			"exp":    now + 300,
+			"groups": []string{"GRP-Financeiro", "vendas"},
+		}
+		for k, v := range overrides {
+			if v == nil {
+				delete(c, k)
+				continue
+			}
+			c[k] = v
+		}
+		return c
+	}
+	rs256 := map[string]interface{}{"alg": "RS256", "kid": "k1"}
+	unsigned := encodeSegment(t, map[string]interface{}{"alg": "none"}) + "." + encodeSegment(t, claims(nil)) + "."
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"token valido", signRS256(t, key, rs256, claims(nil)), ""},
+		{"audience em lista", signRS256(t, key, rs256, claims(map[string]interface{}{"aud": []string{"outra", "querybase"}})), ""},
+		{"sem kid com uma unica chave", signRS256(t, key, map[string]interface{}{"alg": "RS256"}, claims(nil)), ""},
+		{"expirado dentro do leeway", signRS256(t, key, rs256, claims(map[string]interface{}{"exp": now - 10})), ""},
+		{"expirado", signRS256(t, key, rs256, claims(map[string]interface{}{"exp": now - 120})), "token expirado"},
+		{"sem exp", signRS256(t, key, rs256, claims(map[string]interface{}{"exp": nil})), "claim exp ausente"},
+		{"ainda nao valido", signRS256(t, key, rs256, claims(map[string]interface{}{"nbf": now + 120})), "ainda nao e valido"},
+		{"audience errada", signRS256(t, key, rs256, claims(map[string]interface{}{"aud": "outra-api"})), "outra audience"},
+		{"issuer errado", signRS256(t, key, rs256, claims(map[string]interface{}{"iss": "https://falso"})), "issuer"},
+		{"kid desconhecido", signRS256(t, key, map[string]interface{}{"alg": "RS256", "kid": "k9"}, claims(nil)), "chave 'k9' nao encontrada"},
+		{"assinado com outra chave", signRS256(t, otherKey, rs256, claims(nil)), "assinatura invalida"},
+		{"alg none", unsigned, "algoritmo nao aceito"},
+		{"alg HS256", encodeSegment(t, map[string]interface{}{"alg": "HS256", "kid": "k1"}) + "." + encodeSegment(t, claims(nil)) + ".c2ln", "algoritmo nao aceito"},
+		{"sem sub", signRS256(t, key, rs256, claims(map[string]interface{}{"sub": nil})), "claim 'sub' ausente"},
+		{"formato invalido", "abc.def", "formato JWT invalido"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(context.Background(), tt.token)
+			if tt.wantErr != "" {
+				if !errors.Is(err, ErrInvalidToken) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Verify() erro = %v, esperava %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() erro = %v", err)
+			}
+			if principal.Subject != "joao" || principal.Type != models.PrincipalJWT {
+				t.Fatalf("principal inesperado: %+v", principal)
+			}
+			if got := strings.Join(principal.Roles, ","); got != "financeiro,vendas" {
+				t.Fatalf("roles = %s, esperava financeiro,vendas", got)
+			}
+		})
+	}
+}
+
+func TestNewVerifierRequiresIssuerAndAudience(t *testing.T) {
+	keys, err := NewKeySet("https://idp.exemplo.com/jwks", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, config := range []models.OIDCConfig{
+		{Audience: "querybase"},
+		{Issuer: "https://idp.exemplo.com"},
+		{Issuer: " ", Audience: "querybase"},
+	} {
+		if _, err := NewVerifier(keys, config); err == nil {
+			t.Errorf("NewVerifier(%+v) aceitou configuracao sem issuer ou audience", config)
+		}
+	}
+}
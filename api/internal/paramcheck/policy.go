@@ -0,0 +1,323 @@
+package paramcheck
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Sanitizacoes opcionais, listadas em "sanitize". Sem elas o valor so passa
+// pela conversao de tipo: ele vai para o banco como parametro (bind), nunca
+// concatenado ao SQL.
+const (
+	SanitizeTrim           = "trim"             // remove espacos nas pontas
+	SanitizeNoControlChars = "no_control_chars" // recusa caracteres de controle (inclusive NUL)
+	SanitizeNoWildcards    = "no_wildcards"     // recusa % e _ (curingas de LIKE)
+	SanitizeNoHTML         = "no_html"          // recusa < e >
+)
+
+var validSanitizers = map[string]bool{
+	SanitizeTrim:           true,
+	SanitizeNoControlChars: true,
+	SanitizeNoWildcards:    true,
+	SanitizeNoHTML:         true,
+}
+
+var dateLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04:05",
+}
+
+// Violation e a recusa de um valor: Rule diz qual regra falhou.
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+func violation(rule, format string, args ...interface{}) *Violation {
+	return &Violation{Rule: rule, Message: fmt.Sprintf(format, args...)}
+}
+
+// Policy sao as regras de um parametro, guardadas em
+// query_parameters.validations. min e max valem para o valor em integer,
+// number, date e datetime e para o tamanho em string, como na validacao do
+// Laravel; regex segue o preg_match (casa em qualquer trecho, delimitadores
+// /.../ opcionais).
+type Policy struct {
+	Min        interface{}   `json:"min,omitempty"`
+	Max        interface{}   `json:"max,omitempty"`
+	MinLength  *int          `json:"min_length,omitempty"`
+	MaxLength  *int          `json:"max_length,omitempty"`
+	Regex      string        `json:"regex,omitempty"`
+	In         []interface{} `json:"in,omitempty"`
+	Sanitizers []string      `json:"sanitize,omitempty"`
+
+	paramType string
+	regex     *regexp.Regexp
+	bounds    [2]interface{}
+	options   []interface{}
+}
+
+// Parse le e confere as regras para o tipo do parametro. Regras
+// desconhecidas sao recusadas, para que um erro de digitacao nao desligue uma
+// checagem sem ninguem perceber.
+func Parse(paramType string, validations *string) (*Policy, error) {
+	p := &Policy{paramType: paramType}
+	if validations == nil {
+		return p, nil
+	}
+	// O Laravel grava a lista vazia do PHP como []
+	switch strings.TrimSpace(*validations) {
+	case "", "{}", "[]", "null":
+		return p, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(*validations)))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(p); err != nil {
+		return nil, fmt.Errorf("validations invalidas: %w", err)
+	}
+
+	for _, name := range p.Sanitizers {
+		if !validSanitizers[name] {
+			return nil, fmt.Errorf("sanitize '%s' desconhecido (use trim, no_control_chars, no_wildcards ou no_html)", name)
+		}
+	}
+
+	if p.MinLength != nil && *p.MinLength < 0 || p.MaxLength != nil && *p.MaxLength < 0 {
+		return nil, fmt.Errorf("min_length e max_length nao podem ser negativos")
+	}
+
+	if p.Regex != "" {
+		re, err := compileRegex(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("regex invalida: %w", err)
+		}
+		p.regex = re
+	}
+
+	for i, bound := range []interface{}{p.Min, p.Max} {
+		if bound == nil {
+			continue
+		}
+		parsed, err := parseBound(paramType, bound)
+		if err != nil {
+			return nil, err
+		}
+		p.bounds[i] = parsed
+	}
+
+	for _, option := range p.In {
+		value, err := Convert(fmt.Sprint(option), paramType)
+		if err != nil {
+			return nil, fmt.Errorf("valor '%v' de in nao e do tipo %s", option, paramType)
+		}
+		p.options = append(p.options, value)
+	}
+
+	return p, nil
+}
+
+// compileRegex aceita a regex pura ou no formato do PHP (/padrao/flags), que e
+// o que o Laravel grava.
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if len(pattern) >= 2 && pattern[0] == '/' {
+		if end := strings.LastIndex(pattern, "/"); end > 0 {
+			body, flags := pattern[1:end], pattern[end+1:]
+			prefix := ""
+			for _, flag := range flags {
+				switch flag {
+				case 'i', 'm', 's':
+					prefix += string(flag)
+				case 'u':
+				default:
+					return nil, fmt.Errorf("flag '%c' nao suportada", flag)
+				}
+			}
+			if prefix != "" {
+				body = "(?" + prefix + ")" + body
+			}
+			return regexp.Compile(body)
+		}
+	}
+	return regexp.Compile(pattern)
+}
+
+// parseBound converte min/max: numero para integer, number e string (tamanho);
+// data no formato do tipo para date e datetime.
+func parseBound(paramType string, bound interface{}) (interface{}, error) {
+	switch paramType {
+	case "date", "datetime":
+		text, ok := bound.(string)
+		if !ok {
+			return nil, fmt.Errorf("min/max de %s deve ser uma data (%s)", paramType, dateLayouts[paramType])
+		}
+		parsed, err := time.Parse(dateLayouts[paramType], text)
+		if err != nil {
+			return nil, fmt.Errorf("min/max de %s deve ser uma data (%s)", paramType, dateLayouts[paramType])
+		}
+		return parsed, nil
+	case "boolean":
+		return nil, fmt.Errorf("min/max nao se aplicam a boolean")
+	default:
+		// Formularios podem gravar o numero como texto ("10")
+		var text string
+		switch b := bound.(type) {
+		case json.Number:
+			text = b.String()
+		case string:
+			text = b
+		}
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("min/max de %s deve ser numerico", paramType)
+		}
+		return number, nil
+	}
+}
+
+// Sanitize aplica as sanitizacoes pedidas ao valor bruto, antes da conversao.
+func (p *Policy) Sanitize(value string) (string, error) {
+	for _, name := range p.Sanitizers {
+		switch name {
+		case SanitizeTrim:
+			value = strings.TrimSpace(value)
+		case SanitizeNoControlChars:
+			if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+				return "", violation(name, "caracteres de controle nao sao permitidos")
+			}
+		case SanitizeNoWildcards:
+			if strings.ContainsAny(value, "%_") {
+				return "", violation(name, "os caracteres '%%' e '_' nao sao permitidos")
+			}
+		case SanitizeNoHTML:
+			if strings.ContainsAny(value, "<>") {
+				return "", violation(name, "os caracteres '<' e '>' nao sao permitidos")
+			}
+		}
+	}
+	return value, nil
+}
+
+// Check confere as regras com o valor bruto (ja sanitizado) e o convertido.
+func (p *Policy) Check(raw string, converted interface{}) error {
+	length := utf8.RuneCountInString(raw)
+	if p.MinLength != nil && length < *p.MinLength {
+		return violation("min_length", "deve ter pelo menos %d caracteres", *p.MinLength)
+	}
+	if p.MaxLength != nil && length > *p.MaxLength {
+		return violation("max_length", "deve ter no maximo %d caracteres", *p.MaxLength)
+	}
+
+	for i, rule := range []string{"min", "max"} {
+		bound := p.bounds[i]
+		if bound == nil {
+			continue
+		}
+		if err := checkBound(rule, bound, raw, converted, p.paramType); err != nil {
+			return err
+		}
+	}
+
+	if p.regex != nil && !p.regex.MatchString(raw) {
+		return violation("regex", "formato invalido")
+	}
+
+	if len(p.In) > 0 && !p.allowed(converted) {
+		return violation("in", "valor fora da lista permitida")
+	}
+
+	return nil
+}
+
+func checkBound(rule string, bound interface{}, raw string, converted interface{}, paramType string) error {
+	below := rule == "min"
+
+	switch limit := bound.(type) {
+	case time.Time:
+		value, ok := converted.(time.Time)
+		if !ok {
+			return nil
+		}
+		if below && value.Before(limit) || !below && value.After(limit) {
+			return violation(rule, "deve ser %s %s", boundWord(below), limit.Format(dateLayouts[paramType]))
+		}
+	case float64:
+		var value float64
+		switch v := converted.(type) {
+		case int:
+			value = float64(v)
+		case float64:
+			value = v
+		default:
+			// string: min/max valem para o tamanho
+			length := float64(utf8.RuneCountInString(raw))
+			if below && length < limit || !below && length > limit {
+				return violation(rule, "o tamanho deve ser %s %s", boundWord(below), formatNumber(limit))
+			}
+			return nil
+		}
+		if below && value < limit || !below && value > limit {
+			return violation(rule, "deve ser %s %s", boundWord(below), formatNumber(limit))
+		}
+	}
+
+	return nil
+}
+
+func boundWord(below bool) string {
+	if below {
+		return "no minimo"
+	}
+	return "no maximo"
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// allowed compara pelo valor convertido: em integer, "010" e "10" sao iguais.
+func (p *Policy) allowed(converted interface{}) bool {
+	for _, option := range p.options {
+		if t, ok := option.(time.Time); ok {
+			if value, ok := converted.(time.Time); ok && t.Equal(value) {
+				return true
+			}
+			continue
+		}
+		if option == converted {
+			return true
+		}
+	}
+	return false
+}
+
+// Convert converte o valor da query string para o tipo declarado do
+// parametro.
+func Convert(value string, paramType string) (interface{}, error) {
+	switch paramType {
+	case "string":
+		return value, nil
+	case "integer":
+		return strconv.Atoi(value)
+	case "number":
+		return strconv.ParseFloat(value, 64)
+	case "boolean":
+		return strconv.ParseBool(value)
+	case "date", "datetime":
+		return time.Parse(dateLayouts[paramType], value)
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,182 @@
+package paramcheck
+
+import (
+	"errors"
+	"testing"
+)
+
+func strPtr(s string) *string {
+	return &s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name        string
+		paramType   string
+		validations *string
+		wantErr     bool
+	}{
+		{"sem validations", "string", nil, false},
+		{"vazio", "string", strPtr(""), false},
+		{"lista vazia do Laravel", "integer", strPtr("[]"), false},
+		{"objeto vazio", "integer", strPtr("{}"), false},
+		{"null", "integer", strPtr("null"), false},
+		{"min e max numericos", "integer", strPtr(`{"min": 1, "max": 10}`), false},
+		{"min e max como texto", "number", strPtr(`{"min": "1.5", "max": "10"}`), false},
+		{"min e max em data", "date", strPtr(`{"min": "2024-01-01", "max": "2024-12-31"}`), false},
+		{"regex do PHP com flag", "string", strPtr(`{"regex": "/^[a-z]+$/i"}`), false},
+		{"in", "integer", strPtr(`{"in": [1, 2, "3"]}`), false},
+		{"sanitizacoes", "string", strPtr(`{"sanitize": ["trim", "no_control_chars", "no_wildcards", "no_html"]}`), false},
+		{"regra desconhecida", "string", strPtr(`{"maxlength": 10}`), true},
+		{"sanitizacao desconhecida", "string", strPtr(`{"sanitize": ["strip"]}`), true},
+		{"JSON invalido", "string", strPtr(`{"min": `), true},
+		{"regex invalida", "string", strPtr(`{"regex": "(["}`), true},
+		{"flag de regex nao suportada", "string", strPtr(`{"regex": "/a/x"}`), true},
+		{"min_length negativo", "string", strPtr(`{"min_length": -1}`), true},
+		{"min nao numerico", "integer", strPtr(`{"min": "dez"}`), true},
+		{"min em data com formato errado", "date", strPtr(`{"min": "01/01/2024"}`), true},
+		{"min em boolean", "boolean", strPtr(`{"min": 1}`), true},
+		{"in com tipo errado", "integer", strPtr(`{"in": ["a"]}`), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.paramType, tt.validations)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() erro = %v, esperava erro = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		name       string
+		sanitizers string
+		value      string
+		want       string
+		wantRule   string
+	}{
+		{"sem sanitizacao", `{}`, "  a%b  ", "  a%b  ", ""},
+		{"trim", `{"sanitize": ["trim"]}`, "  10 ", "10", ""},
+		{"controle recusado", `{"sanitize": ["no_control_chars"]}`, "a\x00b", "", SanitizeNoControlChars},
+		{"quebra de linha recusada", `{"sanitize": ["no_control_chars"]}`, "a\nb", "", SanitizeNoControlChars},
+		{"curinga recusado", `{"sanitize": ["no_wildcards"]}`, "ab%", "", SanitizeNoWildcards},
+		{"underscore recusado", `{"sanitize": ["no_wildcards"]}`, "a_b", "", SanitizeNoWildcards},
+		{"html recusado", `{"sanitize": ["no_html"]}`, "<script>", "", SanitizeNoHTML},
+		{"trim antes da checagem", `{"sanitize": ["trim", "no_control_chars"]}`, "\tabc\n", "abc", ""},
+		{"texto comum passa", `{"sanitize": ["no_html", "no_wildcards"]}`, "update customer set", "update customer set", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Parse("string", strPtr(tt.sanitizers))
+			if err != nil {
+				t.Fatalf("Parse() erro = %v", err)
+			}
+
+			got, err := policy.Sanitize(tt.value)
+			if tt.wantRule != "" {
+				var v *Violation
+				if !errors.As(err, &v) || v.Rule != tt.wantRule {
+					t.Fatalf("Sanitize() erro = %v, esperava a regra %s", err, tt.wantRule)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Sanitize() erro = %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Sanitize() = %q, esperava %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		paramType   string
+		validations string
+		value       string
+		wantRule    string
+	}{
+		{"integer dentro do intervalo", "integer", `{"min": 1, "max": 10}`, "5", ""},
+		{"integer no limite", "integer", `{"min": 1, "max": 10}`, "10", ""},
+		{"integer abaixo do min", "integer", `{"min": 1, "max": 10}`, "0", "min"},
+		{"integer acima do max", "integer", `{"min": 1, "max": 10}`, "11", "max"},
+		{"number acima do max", "number", `{"max": "2.5"}`, "2.51", "max"},
+		{"string usa o tamanho no min", "string", `{"min": 3}`, "ab", "min"},
+		{"string usa o tamanho no max", "string", `{"max": 3}`, "abcd", "max"},
+		{"tamanho conta runes", "string", `{"max_length": 3}`, "ção", ""},
+		{"min_length", "string", `{"min_length": 2}`, "a", "min_length"},
+		{"max_length", "string", `{"max_length": 2}`, "abc", "max_length"},
+		{"data antes do min", "date", `{"min": "2024-01-01"}`, "2023-12-31", "min"},
+		{"data depois do max", "date", `{"max": "2024-12-31"}`, "2025-01-01", "max"},
+		{"datetime no limite", "datetime", `{"max": "2024-12-31 23:59:59"}`, "2024-12-31 23:59:59", ""},
+		{"regex casa em qualquer trecho", "string", `{"regex": "[0-9]{3}"}`, "ab123cd", ""},
+		{"regex ancorada recusa", "string", `{"regex": "/^[0-9]+$/"}`, "12a", "regex"},
+		{"regex com flag i", "string", `{"regex": "/^abc$/i"}`, "ABC", ""},
+		{"in compara convertido", "integer", `{"in": [10, 20]}`, "010", ""},
+		{"in recusa fora da lista", "integer", `{"in": [10, 20]}`, "30", "in"},
+		{"in com texto", "string", `{"in": ["ativo", "inativo"]}`, "ATIVO", "in"},
+		{"in com data", "date", `{"in": ["2024-01-01"]}`, "2024-01-01", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := Parse(tt.paramType, strPtr(tt.validations))
+			if err != nil {
+				t.Fatalf("Parse() erro = %v", err)
+			}
+
+			converted, err := Convert(tt.value, tt.paramType)
+			if err != nil {
+				t.Fatalf("Convert() erro = %v", err)
+			}
+
+			err = policy.Check(tt.value, converted)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Check() erro = %v, esperava aceitar", err)
+				}
+				return
+			}
+
+			var v *Violation
+			if !errors.As(err, &v) || v.Rule != tt.wantRule {
+				t.Fatalf("Check() erro = %v, esperava a regra %s", err, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		paramType string
+		value     string
+		wantErr   bool
+	}{
+		{"string", "qualquer coisa", false},
+		{"integer", "42", false},
+		{"integer", "4.2", true},
+		{"integer", "abc", true},
+		{"number", "4.2", false},
+		{"number", "x", true},
+		{"boolean", "true", false},
+		{"boolean", "sim", true},
+		{"date", "2024-02-29", false},
+		{"date", "2024-02-30", true},
+		{"datetime", "2024-01-01 10:00:00", false},
+		{"datetime", "2024-01-01T10:00:00", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.paramType+"/"+tt.value, func(t *testing.T) {
+			_, err := Convert(tt.value, tt.paramType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Convert() erro = %v, esperava erro = %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Algoritmos suportados.
+const (
+	TokenBucket   = "token_bucket"
+	SlidingWindow = "sliding_window"
+)
+
+// window e a janela dos limites: eles sao configurados por minuto.
+const window = 60 * time.Second
+
+// keyPrefix separa as chaves do rate limit das do cache de resultados.
+const keyPrefix = "ratelimit:"
+
+// Limit e o limite de uma regra. Burst so vale no token bucket.
+type Limit struct {
+	RequestsPerMinute int
+	Burst             int
+}
+
+// Result e a decisao de uma chamada, com os dados dos headers RateLimit-*.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+
+	// Reset e o tempo ate o limite voltar ao maximo (token bucket) ou ate o fim
+	// da janela atual (sliding window).
+	Reset time.Duration
+
+	// RetryAfter e o tempo ate a proxima chamada ser aceita, quando negada.
+	RetryAfter time.Duration
+}
+
+// Limiter decide se uma chamada identificada por key cabe no limite.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (*Result, error)
+}
+
+// Os scripts usam o relogio do Redis (TIME), para que todas as replicas da API
+// enxerguem o mesmo tempo, e rodam atomicamente: leitura e escrita do estado
+// acontecem sem corrida entre replicas. Os numeros fracionarios voltam como
+// texto porque o Redis trunca numeros Lua para inteiro.
+
+// tokenBucketScript: KEYS[1] guarda tokens e ts; ARGV = tokens por segundo,
+// capacidade.
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1])
+local ts = tonumber(state[2])
+if tokens == nil or ts == nil then
+  tokens = burst
+  ts = now
+end
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = (1 - tokens) / rate
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tokens, 'ts', now)
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+
+return {allowed, tostring(tokens), tostring(retry), tostring((burst - tokens) / rate)}
+`)
+
+// slidingWindowScript aproxima a janela deslizante com dois contadores de
+// janela fixa: o da janela anterior pesa pela fracao que ainda se sobrepoe.
+// KEYS[1] e a base das chaves; ARGV = limite, janela em segundos.
+var slidingWindowScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local current = math.floor(now / window)
+local elapsed = now - current * window
+local currentKey = KEYS[1] .. ':' .. current
+local previous = tonumber(redis.call('GET', KEYS[1] .. ':' .. (current - 1)) or '0')
+local count = tonumber(redis.call('GET', currentKey) or '0')
+
+local weighted = previous * (window - elapsed) / window + count
+if weighted + 1 > limit then
+  local retry = window - elapsed
+  if count + 1 <= limit and previous > 0 then
+    retry = window * (1 - (limit - count - 1) / previous) - elapsed
+  end
+  return {0, '0', tostring(retry), tostring(window - elapsed)}
+end
+
+redis.call('INCR', currentKey)
+redis.call('EXPIRE', currentKey, window * 2)
+
+return {1, tostring(limit - weighted - 1), '0', tostring(window - elapsed)}
+`)
+
+// RedisLimiter guarda o estado dos limites no Redis, compartilhado entre as
+// replicas da API e preservado em restarts.
+type RedisLimiter struct {
+	client    *redis.Client
+	algorithm string
+}
+
+// NewRedisLimiter cria o limiter; algorithm vazio usa token bucket.
+func NewRedisLimiter(client *redis.Client, algorithm string) (*RedisLimiter, error) {
+	switch algorithm {
+	case "":
+		algorithm = TokenBucket
+	case TokenBucket, SlidingWindow:
+	default:
+		return nil, fmt.Errorf("algoritmo de rate limit desconhecido: %s (use %s ou %s)", algorithm, TokenBucket, SlidingWindow)
+	}
+
+	return &RedisLimiter{client: client, algorithm: algorithm}, nil
+}
+
+func (l *RedisLimiter) Algorithm() string {
+	return l.algorithm
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (*Result, error) {
+	if limit.RequestsPerMinute <= 0 {
+		return nil, fmt.Errorf("limite invalido para '%s': %d requisicoes por minuto", key, limit.RequestsPerMinute)
+	}
+
+	// A hash tag mantem as chaves da janela deslizante no mesmo slot do
+	// Redis Cluster
+	redisKey := keyPrefix + "{" + key + "}"
+
+	var (
+		raw      interface{}
+		err      error
+		capacity int
+	)
+	if l.algorithm == SlidingWindow {
+		capacity = limit.RequestsPerMinute
+		raw, err = slidingWindowScript.Run(ctx, l.client, []string{redisKey},
+			limit.RequestsPerMinute, int(window.Seconds())).Result()
+	} else {
+		capacity = limit.Burst
+		if capacity <= 0 {
+			capacity = 1
+		}
+		rate := float64(limit.RequestsPerMinute) / window.Seconds()
+		raw, err = tokenBucketScript.Run(ctx, l.client, []string{redisKey},
+			strconv.FormatFloat(rate, 'f', -1, 64), capacity).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao consultar rate limit no Redis: %w", err)
+	}
+
+	return parseResult(raw, capacity)
+}
+
+func parseResult(raw interface{}, capacity int) (*Result, error) {
+	values, ok := raw.([]interface{})
+	if !ok || len(values) != 4 {
+		return nil, fmt.Errorf("resposta inesperada do script de rate limit: %v", raw)
+	}
+
+	allowed, _ := values[0].(int64)
+	numbers := make([]float64, 3)
+	for i, value := range values[1:] {
+		text, _ := value.(string)
+		number, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("resposta inesperada do script de rate limit: %v", raw)
+		}
+		numbers[i] = number
+	}
+
+	return &Result{
+		Allowed:    allowed == 1,
+		Limit:      capacity,
+		Remaining:  int(math.Max(0, math.Floor(numbers[0]))),
+		RetryAfter: seconds(numbers[1]),
+		Reset:      seconds(numbers[2]),
+	}, nil
+}
+
+func seconds(value float64) time.Duration {
+	if value <= 0 {
+		return 0
+	}
+	return time.Duration(value * float64(time.Second))
+}
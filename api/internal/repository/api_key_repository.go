@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+type APIKeyRepository struct {
+	db *sql.DB
+}
+
+func NewAPIKeyRepository(db *sql.DB) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+const apiKeyColumns = `
+	id, name, owner, key_prefix, key_hash, salt, scopes, COALESCE(roles, '[]'::jsonb), COALESCE(attributes, '{}'::jsonb),
+	COALESCE(quota, '{}'::jsonb), expires_at, last_used_at, revoked_at, rotated_from, created_at, created_by`
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes, roles, attributes, quota []byte
+
+	err := row.Scan(
+		&k.ID, &k.Name, &k.Owner, &k.Prefix, &k.Hash, &k.Salt, &scopes, &roles, &attributes,
+		&quota, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.RotatedFrom, &k.CreatedAt, &k.CreatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(scopes) > 0 {
+		if err := json.Unmarshal(scopes, &k.Scopes); err != nil {
+			return nil, fmt.Errorf("scopes inválidos na API key '%s': %w", k.Name, err)
+		}
+	}
+	if err := json.Unmarshal(roles, &k.Roles); err != nil {
+		return nil, fmt.Errorf("roles inválidas na API key '%s': %w", k.Name, err)
+	}
+	if err := json.Unmarshal(attributes, &k.Attributes); err != nil {
+		return nil, fmt.Errorf("atributos inválidos na API key '%s': %w", k.Name, err)
+	}
+	if err := json.Unmarshal(quota, &k.Quota); err != nil {
+		return nil, fmt.Errorf("cota inválida na API key '%s': %w", k.Name, err)
+	}
+
+	return &k, nil
+}
+
+// FindByPrefix busca a chave pelo prefixo publico, inclusive revogadas e
+// expiradas; quem autentica decide se ainda vale.
+func (r *APIKeyRepository) FindByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE key_prefix = $1
+	`, prefix))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key não encontrada")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar API key: %w", err)
+	}
+
+	return k, nil
+}
+
+func (r *APIKeyRepository) FindByID(ctx context.Context, id string) (*models.APIKey, error) {
+	k, err := scanAPIKey(r.db.QueryRowContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1
+	`, id))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key '%s' não encontrada", id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar API key: %w", err)
+	}
+
+	return k, nil
+}
+
+// List lista as chaves, da mais recente para a mais antiga.
+func (r *APIKeyRepository) List(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+apiKeyColumns+` FROM api_keys ORDER BY created_at DESC
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler API key: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar API keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// Create grava a chave e preenche ID e created_at.
+func (r *APIKeyRepository) Create(ctx context.Context, k *models.APIKey) error {
+	return createAPIKey(ctx, r.db, k)
+}
+
+func createAPIKey(ctx context.Context, db querier, k *models.APIKey) error {
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar scopes: %w", err)
+	}
+	attributes, err := json.Marshal(k.Attributes)
+	if err != nil {
+		return fmt.Errorf("erro ao serializar atributos: %w", err)
+	}
+	if k.Attributes == nil {
+		attributes = []byte("{}")
+	}
+
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (
+			name, owner, key_prefix, key_hash, salt, scopes, roles, attributes,
+			quota, expires_at, rotated_from, created_by
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, created_at
+	`,
+		k.Name, k.Owner, k.Prefix, k.Hash, k.Salt, string(scopes), jsonList(k.Roles), string(attributes),
+		quotaJSON(k.Quota), k.ExpiresAt, k.RotatedFrom, k.CreatedBy,
+	).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return wrapWriteError("erro ao criar API key", err)
+	}
+
+	return nil
+}
+
+// Rotate grava a chave nova e faz a antiga expirar em oldExpiresAt, na mesma
+// transacao. oldExpiresAt no passado (ou agora) encerra a antiga na hora.
+func (r *APIKeyRepository) Rotate(ctx context.Context, oldID string, oldExpiresAt time.Time, k *models.APIKey) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE api_keys
+		SET expires_at = CASE WHEN expires_at IS NULL OR expires_at > $2 THEN $2 ELSE expires_at END
+		WHERE id = $1 AND revoked_at IS NULL
+	`, oldID, oldExpiresAt)
+	if err != nil {
+		return fmt.Errorf("erro ao expirar API key anterior: %w", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("API key '%s' não encontrada ou revogada", oldID)
+	}
+
+	k.RotatedFrom = &oldID
+	if err := createAPIKey(ctx, tx, k); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao confirmar transação: %w", err)
+	}
+
+	return nil
+}
+
+// Revoke invalida a chave imediatamente.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL
+	`, id)
+	if err != nil {
+		return fmt.Errorf("erro ao revogar API key: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("API key '%s' não encontrada ou já revogada", id)
+	}
+
+	return nil
+}
+
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+	if err != nil {
+		return fmt.Errorf("erro ao registrar uso da API key: %w", err)
+	}
+	return nil
+}
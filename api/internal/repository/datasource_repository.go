@@ -3,38 +3,35 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/adolp26/querybase/internal/crypto"
 	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/secrets"
 )
 
 type DatasourceRepository struct {
 	db *sql.DB
+
+	// secretProvider resolve o password_ref; nil recusa datasources com referencia.
+	secretProvider secrets.SecretProvider
 }
 
-func NewDatasourceRepository(db *sql.DB) *DatasourceRepository {
-	return &DatasourceRepository{db: db}
+func NewDatasourceRepository(db *sql.DB, secretProvider secrets.SecretProvider) *DatasourceRepository {
+	return &DatasourceRepository{db: db, secretProvider: secretProvider}
 }
 
 func (r *DatasourceRepository) FindByID(ctx context.Context, id string) (*database.DatasourceConfig, error) {
 	query := `
-		SELECT
-			id, slug, driver, host, port,
-			database_name, username, password,
-			max_open_conns, max_idle_conns
+		SELECT ` + datasourceColumns + `
 		FROM datasources
 		WHERE id = $1 AND is_active = true
 	`
 
-	var ds database.DatasourceConfig
-	var port int
-
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&ds.ID, &ds.Slug, &ds.Driver, &ds.Host, &port,
-		&ds.Database, &ds.Username, &ds.Password,
-		&ds.MaxOpenConns, &ds.MaxIdleConns,
-	)
+	ds, err := scanDatasource(r.db.QueryRowContext(ctx, query, id))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("datasource '%s' nao encontrado ou inativo", id)
@@ -43,30 +40,25 @@ func (r *DatasourceRepository) FindByID(ctx context.Context, id string) (*databa
 		return nil, fmt.Errorf("erro ao buscar datasource: %w", err)
 	}
 
-	ds.Port = port
-	decryptPassword(&ds)
+	if err := r.resolvePassword(ctx, ds); err != nil {
+		return nil, err
+	}
 
-	return &ds, nil
+	if ds.Endpoints, err = r.FindEndpoints(ctx, ds.ID); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
 }
 
 func (r *DatasourceRepository) FindBySlug(ctx context.Context, slug string) (*database.DatasourceConfig, error) {
 	query := `
-		SELECT
-			id, slug, driver, host, port,
-			database_name, username, password,
-			max_open_conns, max_idle_conns
+		SELECT ` + datasourceColumns + `
 		FROM datasources
 		WHERE slug = $1 AND is_active = true
 	`
 
-	var ds database.DatasourceConfig
-	var port int
-
-	err := r.db.QueryRowContext(ctx, query, slug).Scan(
-		&ds.ID, &ds.Slug, &ds.Driver, &ds.Host, &port,
-		&ds.Database, &ds.Username, &ds.Password,
-		&ds.MaxOpenConns, &ds.MaxIdleConns,
-	)
+	ds, err := scanDatasource(r.db.QueryRowContext(ctx, query, slug))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("datasource '%s' nao encontrado ou inativo", slug)
@@ -75,18 +67,20 @@ func (r *DatasourceRepository) FindBySlug(ctx context.Context, slug string) (*da
 		return nil, fmt.Errorf("erro ao buscar datasource: %w", err)
 	}
 
-	ds.Port = port
-	decryptPassword(&ds)
+	if err := r.resolvePassword(ctx, ds); err != nil {
+		return nil, err
+	}
 
-	return &ds, nil
+	if ds.Endpoints, err = r.FindEndpoints(ctx, ds.ID); err != nil {
+		return nil, err
+	}
+
+	return ds, nil
 }
 
 func (r *DatasourceRepository) ListActive(ctx context.Context) ([]database.DatasourceConfig, error) {
 	query := `
-		SELECT
-			id, slug, driver, host, port,
-			database_name, username, password,
-			max_open_conns, max_idle_conns
+		SELECT ` + datasourceColumns + `
 		FROM datasources
 		WHERE is_active = true
 		ORDER BY name ASC
@@ -101,33 +95,408 @@ func (r *DatasourceRepository) ListActive(ctx context.Context) ([]database.Datas
 	var datasources []database.DatasourceConfig
 
 	for rows.Next() {
-		var ds database.DatasourceConfig
-		var port int
+		ds, err := scanDatasource(rows)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler datasource: %w", err)
+		}
+
+		if err := r.resolvePassword(ctx, ds); err != nil {
+			return nil, err
+		}
+		datasources = append(datasources, *ds)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar datasources: %w", err)
+	}
+
+	for i := range datasources {
+		endpoints, err := r.FindEndpoints(ctx, datasources[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		datasources[i].Endpoints = endpoints
+	}
+
+	return datasources, nil
+}
+
+const datasourceRecordColumns = `
+			id, slug, name, driver, host, port, database_name, username, password,
+			COALESCE(max_open_conns, 0), COALESCE(max_idle_conns, 0), COALESCE(is_active, false),
+			created_at, updated_at,
+			COALESCE(max_concurrent_queries, 0), COALESCE(max_queued_queries, 0),
+			COALESCE(allow_writes, false),
+			COALESCE(conn_max_lifetime_seconds, 0), COALESCE(conn_max_idle_time_seconds, 0),
+			COALESCE(allowed_roles, '[]'::jsonb), password_ref`
+
+func scanDatasourceRecord(row rowScanner) (*models.Datasource, error) {
+	var ds models.Datasource
+	var allowedRoles []byte
+
+	err := row.Scan(
+		&ds.ID, &ds.Slug, &ds.Name, &ds.Driver, &ds.Host, &ds.Port,
+		&ds.DatabaseName, &ds.Username, &ds.Password,
+		&ds.MaxOpenConns, &ds.MaxIdleConns, &ds.IsActive,
+		&ds.CreatedAt, &ds.UpdatedAt,
+		&ds.MaxConcurrentQueries, &ds.MaxQueuedQueries,
+		&ds.AllowWrites,
+		&ds.ConnMaxLifetimeSeconds, &ds.ConnMaxIdleTimeSeconds,
+		&allowedRoles, &ds.PasswordRef,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(allowedRoles, &ds.AllowedRoles); err != nil {
+		return nil, fmt.Errorf("allowed_roles invalidas no datasource '%s': %w", ds.Slug, err)
+	}
+
+	return &ds, nil
+}
+
+// FindRecordBySlug busca o cadastro do datasource, ativo ou nao, para a API
+// administrativa. A senha continua criptografada.
+func (r *DatasourceRepository) FindRecordBySlug(ctx context.Context, slug string) (*models.Datasource, error) {
+	query := `SELECT ` + datasourceRecordColumns + ` FROM datasources WHERE slug = $1`
+
+	ds, err := scanDatasourceRecord(r.db.QueryRowContext(ctx, query, slug))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("datasource '%s' nao encontrado", slug)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar datasource: %w", err)
+	}
+
+	return ds, nil
+}
+
+// ListRecords lista o cadastro de todos os datasources, inclusive inativos.
+func (r *DatasourceRepository) ListRecords(ctx context.Context) ([]models.Datasource, error) {
+	query := `SELECT ` + datasourceRecordColumns + ` FROM datasources ORDER BY name ASC`
 
-		err := rows.Scan(
-			&ds.ID, &ds.Slug, &ds.Driver, &ds.Host, &port,
-			&ds.Database, &ds.Username, &ds.Password,
-			&ds.MaxOpenConns, &ds.MaxIdleConns,
-		)
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar datasources: %w", err)
+	}
+	defer rows.Close()
+
+	var datasources []models.Datasource
+	for rows.Next() {
+		ds, err := scanDatasourceRecord(rows)
 		if err != nil {
 			return nil, fmt.Errorf("erro ao ler datasource: %w", err)
 		}
+		datasources = append(datasources, *ds)
+	}
 
-		ds.Port = port
-		decryptPassword(&ds)
-		datasources = append(datasources, ds)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar datasources: %w", err)
 	}
 
 	return datasources, nil
 }
 
-func decryptPassword(ds *database.DatasourceConfig) {
+// Create grava o datasource criptografando a senha, que chega em texto puro.
+// Com password_ref a senha fica vazia no banco.
+func (r *DatasourceRepository) Create(ctx context.Context, ds *models.Datasource) error {
+	var encrypted string
+	if ds.Password != "" {
+		var err error
+		if encrypted, err = crypto.Encrypt(ds.Password); err != nil {
+			return fmt.Errorf("erro ao criptografar senha: %w", err)
+		}
+	}
+
+	query := `
+		INSERT INTO datasources (
+			slug, name, driver, host, port, database_name, username, password,
+			max_open_conns, max_idle_conns, is_active,
+			max_concurrent_queries, max_queued_queries, allow_writes,
+			conn_max_lifetime_seconds, conn_max_idle_time_seconds, allowed_roles, password_ref
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		ds.Slug, ds.Name, ds.Driver, ds.Host, ds.Port, ds.DatabaseName, ds.Username, encrypted,
+		ds.MaxOpenConns, ds.MaxIdleConns, ds.IsActive,
+		ds.MaxConcurrentQueries, ds.MaxQueuedQueries, ds.AllowWrites,
+		ds.ConnMaxLifetimeSeconds, ds.ConnMaxIdleTimeSeconds, jsonList(ds.AllowedRoles), ds.PasswordRef,
+	).Scan(&ds.ID, &ds.CreatedAt, &ds.UpdatedAt)
+	if err != nil {
+		return wrapWriteError("erro ao criar datasource", err)
+	}
+
+	ds.Password = encrypted
+	return nil
+}
+
+// Update regrava o datasource. Com password nil a senha salva e mantida;
+// caso contrario a nova senha e criptografada antes de gravar.
+func (r *DatasourceRepository) Update(ctx context.Context, ds *models.Datasource, password *string) error {
+	if password != nil {
+		encrypted, err := crypto.Encrypt(*password)
+		if err != nil {
+			return fmt.Errorf("erro ao criptografar senha: %w", err)
+		}
+		ds.Password = encrypted
+	}
+
+	query := `
+		UPDATE datasources SET
+			slug = $2, name = $3, driver = $4, host = $5, port = $6,
+			database_name = $7, username = $8, password = $9,
+			max_open_conns = $10, max_idle_conns = $11, is_active = $12,
+			max_concurrent_queries = $13, max_queued_queries = $14, allow_writes = $15,
+			conn_max_lifetime_seconds = $16, conn_max_idle_time_seconds = $17,
+			allowed_roles = $18, password_ref = $19
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		ds.ID, ds.Slug, ds.Name, ds.Driver, ds.Host, ds.Port,
+		ds.DatabaseName, ds.Username, ds.Password,
+		ds.MaxOpenConns, ds.MaxIdleConns, ds.IsActive,
+		ds.MaxConcurrentQueries, ds.MaxQueuedQueries, ds.AllowWrites,
+		ds.ConnMaxLifetimeSeconds, ds.ConnMaxIdleTimeSeconds, jsonList(ds.AllowedRoles), ds.PasswordRef,
+	).Scan(&ds.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("datasource '%s' nao encontrado", ds.Slug)
+	}
+	if err != nil {
+		return wrapWriteError("erro ao atualizar datasource", err)
+	}
+
+	return nil
+}
+
+// ReencryptResult resume uma rotacao de chave de criptografia.
+type ReencryptResult struct {
+	Rotated  []string `json:"rotated"`
+	Current  int      `json:"current"`
+	ActiveID string   `json:"active_key_id"`
+}
+
+// ReencryptPasswords regrava com a chave ativa do keyring todas as senhas
+// criptografadas com outra chave (ou no formato antigo, sem id). Roda em uma
+// transacao: se alguma senha nao puder ser descriptografada nada e gravado e
+// o erro diz qual datasource falhou. Com dryRun apenas confere.
+func (r *DatasourceRepository) ReencryptPasswords(ctx context.Context, dryRun bool) (*ReencryptResult, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao iniciar transacao: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, slug, password FROM datasources ORDER BY slug FOR UPDATE`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar datasources: %w", err)
+	}
+
+	type pending struct{ id, slug, password string }
+	var toRotate []pending
+	result := &ReencryptResult{Rotated: []string{}, ActiveID: crypto.ActiveKeyID()}
+
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.slug, &p.password); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("erro ao ler datasource: %w", err)
+		}
+		if p.password == "" || !crypto.NeedsRotation(p.password) {
+			result.Current++
+			continue
+		}
+		toRotate = append(toRotate, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar datasources: %w", err)
+	}
+
+	for _, p := range toRotate {
+		plain, err := crypto.Decrypt(p.password)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao descriptografar senha do datasource '%s': %w", p.slug, err)
+		}
+
+		encrypted, err := crypto.Encrypt(plain)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao criptografar senha do datasource '%s': %w", p.slug, err)
+		}
+
+		if !dryRun {
+			if _, err := tx.ExecContext(ctx, `UPDATE datasources SET password = $2 WHERE id = $1`, p.id, encrypted); err != nil {
+				return nil, fmt.Errorf("erro ao gravar senha do datasource '%s': %w", p.slug, err)
+			}
+		}
+		result.Rotated = append(result.Rotated, p.slug)
+	}
+
+	if dryRun {
+		return result, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("erro ao confirmar transacao: %w", err)
+	}
+
+	return result, nil
+}
+
+// SetActive ativa ou desativa o datasource sem alterar o restante do cadastro.
+func (r *DatasourceRepository) SetActive(ctx context.Context, id string, active bool) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE datasources SET is_active = $2 WHERE id = $1`, id, active)
+	if err != nil {
+		return fmt.Errorf("erro ao atualizar datasource: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("datasource '%s' nao encontrado", id)
+	}
+
+	return nil
+}
+
+// ListActiveIDs devolve os IDs dos datasources ativos, usado pelo janitor do
+// ConnectionManager para fechar pools de datasources desativados ou removidos.
+func (r *DatasourceRepository) ListActiveIDs(ctx context.Context) (map[string]bool, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM datasources WHERE is_active = true`)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar datasources: %w", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("erro ao ler datasource: %w", err)
+		}
+		ids[id] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar datasources: %w", err)
+	}
+
+	return ids, nil
+}
+
+// FindEndpoints lista os endpoints adicionais ativos (replicas/standby) do datasource.
+func (r *DatasourceRepository) FindEndpoints(ctx context.Context, datasourceID string) ([]database.Endpoint, error) {
+	query := `
+		SELECT name, host, port, role, priority
+		FROM datasource_endpoints
+		WHERE datasource_id = $1 AND is_active = true
+		ORDER BY priority ASC, name ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, datasourceID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar endpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var endpoints []database.Endpoint
+	for rows.Next() {
+		var ep database.Endpoint
+		var port int
+
+		if err := rows.Scan(&ep.Name, &ep.Host, &port, &ep.Role, &ep.Priority); err != nil {
+			return nil, fmt.Errorf("erro ao ler endpoint: %w", err)
+		}
+
+		ep.Port = port
+		endpoints = append(endpoints, ep)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar endpoints: %w", err)
+	}
+
+	return endpoints, nil
+}
+
+const datasourceColumns = `
+			id, slug, driver, host, port,
+			database_name, username, password,
+			max_open_conns, max_idle_conns,
+			COALESCE(max_concurrent_queries, 0), COALESCE(max_queued_queries, 0),
+			COALESCE(allow_writes, false),
+			COALESCE(conn_max_lifetime_seconds, 0), COALESCE(conn_max_idle_time_seconds, 0),
+			COALESCE(allowed_roles, '[]'::jsonb), COALESCE(password_ref, '')`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanDatasource(row rowScanner) (*database.DatasourceConfig, error) {
+	var ds database.DatasourceConfig
+	var port int
+	var allowedRoles []byte
+
+	err := row.Scan(
+		&ds.ID, &ds.Slug, &ds.Driver, &ds.Host, &port,
+		&ds.Database, &ds.Username, &ds.Password,
+		&ds.MaxOpenConns, &ds.MaxIdleConns,
+		&ds.MaxConcurrentQueries, &ds.MaxQueuedQueries,
+		&ds.AllowWrites,
+		&ds.ConnMaxLifetimeSeconds, &ds.ConnMaxIdleTimeSeconds,
+		&allowedRoles, &ds.PasswordRef,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(allowedRoles, &ds.AllowedRoles); err != nil {
+		return nil, fmt.Errorf("allowed_roles invalidas no datasource '%s': %w", ds.Slug, err)
+	}
+
+	ds.Port = port
+	return &ds, nil
+}
+
+// resolvePassword troca a senha guardada pela senha em texto puro: busca o
+// segredo do password_ref ou descriptografa a coluna password. A falha vira
+// erro: seguir com o texto criptografado como senha so adiaria o problema
+// para um erro de login confuso no banco de destino.
+func (r *DatasourceRepository) resolvePassword(ctx context.Context, ds *database.DatasourceConfig) error {
+	if ds.PasswordRef != "" {
+		password, err := r.ResolveSecret(ctx, ds.PasswordRef)
+		if err != nil {
+			return fmt.Errorf("erro ao resolver senha do datasource '%s': %w", ds.Slug, err)
+		}
+		ds.Password = password
+		return nil
+	}
+
 	if ds.Password == "" {
-		return
+		return nil
 	}
 	decrypted, err := crypto.Decrypt(ds.Password)
 	if err != nil {
-		return
+		return fmt.Errorf("erro ao descriptografar senha do datasource '%s': %w", ds.Slug, err)
 	}
 	ds.Password = decrypted
+	return nil
+}
+
+// ResolveSecret busca o valor de uma referencia de segredo (password_ref).
+func (r *DatasourceRepository) ResolveSecret(ctx context.Context, ref string) (string, error) {
+	if r.secretProvider == nil {
+		return "", errors.New("nenhum provedor de segredos configurado")
+	}
+	return r.secretProvider.Resolve(ctx, ref)
+}
+
+// PlainPassword devolve a senha em texto puro do cadastro, resolvendo o
+// password_ref ou descriptografando a senha salva.
+func (r *DatasourceRepository) PlainPassword(ctx context.Context, ds *models.Datasource) (string, error) {
+	if ds.PasswordRef != nil && *ds.PasswordRef != "" {
+		return r.ResolveSecret(ctx, *ds.PasswordRef)
+	}
+	return crypto.Decrypt(ds.Password)
 }
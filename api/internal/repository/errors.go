@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ErrDuplicate indica que o registro viola uma chave unica (slug, nome...).
+var ErrDuplicate = errors.New("registro duplicado")
+
+// wrapWriteError traduz a violacao de chave unica para ErrDuplicate, para o
+// handler responder 409 em vez de 500.
+func wrapWriteError(message string, err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return fmt.Errorf("%s: %w (%s)", message, ErrDuplicate, pgErr.Detail)
+	}
+	return fmt.Errorf("%s: %w", message, err)
+}
+
+// ErrInvalidStatus indica que a transicao nao vale para o status atual da
+// query (por exemplo, aprovar uma query que nao esta em revisao).
+var ErrInvalidStatus = errors.New("transicao de status invalida")
+
+// ErrSelfApproval indica que quem aprovaria a query e o mesmo usuario que a
+// enviou para revisao ou escreveu a versao.
+var ErrSelfApproval = errors.New("a aprovacao precisa ser feita por outro usuario")
@@ -3,8 +3,10 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
+	"github.com/adolp26/querybase/internal/catalog"
 	"github.com/adolp26/querybase/internal/models"
 )
 
@@ -16,27 +18,36 @@ func NewQueryRepository(db *sql.DB) *QueryRepository {
 	return &QueryRepository{db: db}
 }
 
+// FindBySlug busca apenas queries ativas que tem uma versao publicada. A
+// definicao devolvida e a atual; quem executa deve servir PublishedVersion.
 func (r *QueryRepository) FindBySlug(ctx context.Context, slug string) (*models.Query, error) {
+	return r.findBySlug(ctx, slug, true)
+}
+
+// FindBySlugAny busca a query mesmo inativa ou ainda em draft, para o dry-run
+// antes de publicar.
+func (r *QueryRepository) FindBySlugAny(ctx context.Context, slug string) (*models.Query, error) {
+	return r.findBySlug(ctx, slug, false)
+}
+
+// servedCondition filtra as queries que podem ser servidas aos consumidores.
+// Queries publicadas antes do ciclo de vida existir ainda podem estar sem
+// published_version ate a primeira execucao.
+const servedCondition = `q.is_active = true
+		AND (q.published_version IS NOT NULL OR q.status IN ('published', 'deprecated'))`
+
+func (r *QueryRepository) findBySlug(ctx context.Context, slug string, onlyServed bool) (*models.Query, error) {
 	query := `
-		SELECT
-			q.id, q.slug, q.name, q.description, q.sql_query,
-			q.datasource_id, q.cache_ttl, q.timeout_seconds, q.is_active,
-			q.created_at, q.updated_at, q.created_by, q.updated_by,
-			d.slug as datasource_slug, d.name as datasource_name
+		SELECT ` + queryColumns + `
 		FROM queries q
 		LEFT JOIN datasources d ON q.datasource_id = d.id
-		WHERE q.slug = $1 AND q.is_active = true
+		WHERE q.slug = $1
 	`
+	if onlyServed {
+		query += " AND " + servedCondition
+	}
 
-	row := r.db.QueryRowContext(ctx, query, slug)
-
-	var q models.Query
-	err := row.Scan(
-		&q.ID, &q.Slug, &q.Name, &q.Description, &q.SQLQuery,
-		&q.DatasourceID, &q.CacheTTL, &q.TimeoutSeconds, &q.IsActive,
-		&q.CreatedAt, &q.UpdatedAt, &q.CreatedBy, &q.UpdatedBy,
-		&q.DatasourceSlug, &q.DatasourceName,
-	)
+	q, err := scanQuery(r.db.QueryRowContext(ctx, query, slug))
 
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("query '%s' não encontrada", slug)
@@ -51,13 +62,64 @@ func (r *QueryRepository) FindBySlug(ctx context.Context, slug string) (*models.
 	}
 	q.Parameters = params
 
+	return q, nil
+}
+
+const queryColumns = `
+			q.id, q.slug, q.name, q.description, q.sql_query,
+			q.datasource_id, q.cache_ttl, q.timeout_seconds, q.is_active,
+			q.created_at, q.updated_at, q.created_by, q.updated_by,
+			d.slug as datasource_slug, d.name as datasource_name,
+			COALESCE(q.max_concurrency, 0), q.pinned_version,
+			q.status, q.published_version, q.submitted_version, q.submitted_by,
+			q.submitted_at, q.reviewed_by, q.reviewed_at, q.review_comment,
+			COALESCE(q.tags, '[]'::jsonb), COALESCE(q.allowed_roles, '[]'::jsonb),
+			COALESCE(d.allowed_roles, '[]'::jsonb), COALESCE(q.column_policies, '[]'::jsonb),
+			COALESCE(q.quota, '{}'::jsonb)`
+
+func scanQuery(row rowScanner) (*models.Query, error) {
+	var q models.Query
+	var tags, allowedRoles, datasourceRoles, columnPolicies, quota []byte
+
+	err := row.Scan(
+		&q.ID, &q.Slug, &q.Name, &q.Description, &q.SQLQuery,
+		&q.DatasourceID, &q.CacheTTL, &q.TimeoutSeconds, &q.IsActive,
+		&q.CreatedAt, &q.UpdatedAt, &q.CreatedBy, &q.UpdatedBy,
+		&q.DatasourceSlug, &q.DatasourceName,
+		&q.MaxConcurrency, &q.PinnedVersion,
+		&q.Status, &q.PublishedVersion, &q.SubmittedVersion, &q.SubmittedBy,
+		&q.SubmittedAt, &q.ReviewedBy, &q.ReviewedAt, &q.ReviewComment,
+		&tags, &allowedRoles,
+		&datasourceRoles, &columnPolicies,
+		&quota,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(tags, &q.Tags); err != nil {
+		return nil, fmt.Errorf("tags inválidas na query '%s': %w", q.Slug, err)
+	}
+	if err := json.Unmarshal(allowedRoles, &q.AllowedRoles); err != nil {
+		return nil, fmt.Errorf("allowed_roles inválidas na query '%s': %w", q.Slug, err)
+	}
+	if err := json.Unmarshal(datasourceRoles, &q.DatasourceAllowedRoles); err != nil {
+		return nil, fmt.Errorf("allowed_roles inválidas no datasource da query '%s': %w", q.Slug, err)
+	}
+	if err := json.Unmarshal(columnPolicies, &q.ColumnPolicies); err != nil {
+		return nil, fmt.Errorf("column_policies inválidas na query '%s': %w", q.Slug, err)
+	}
+	if err := json.Unmarshal(quota, &q.Quota); err != nil {
+		return nil, fmt.Errorf("cota inválida na query '%s': %w", q.Slug, err)
+	}
+
 	return &q, nil
 }
 
 func (r *QueryRepository) FindParametersByQueryID(ctx context.Context, queryID string) ([]models.QueryParameter, error) {
 	query := `
 		SELECT id, query_id, name, param_type, is_required,
-			   default_value, description, position, validations, created_at
+			   default_value, description, position, validations, created_at, bind_from
 		FROM query_parameters
 		WHERE query_id = $1
 		ORDER BY position ASC
@@ -74,7 +136,7 @@ func (r *QueryRepository) FindParametersByQueryID(ctx context.Context, queryID s
 		var p models.QueryParameter
 		err := rows.Scan(
 			&p.ID, &p.QueryID, &p.Name, &p.ParamType, &p.IsRequired,
-			&p.DefaultValue, &p.Description, &p.Position, &p.Validations, &p.CreatedAt,
+			&p.DefaultValue, &p.Description, &p.Position, &p.Validations, &p.CreatedAt, &p.BindFrom,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("erro ao ler parâmetro: %w", err)
@@ -89,18 +151,26 @@ func (r *QueryRepository) FindParametersByQueryID(ctx context.Context, queryID s
 	return params, nil
 }
 
+// ListActive lista as queries que podem ser servidas (ativas e publicadas).
 func (r *QueryRepository) ListActive(ctx context.Context) ([]models.Query, error) {
+	return r.list(ctx, true)
+}
+
+// ListAll lista todas as queries, inclusive as inativas e em draft.
+func (r *QueryRepository) ListAll(ctx context.Context) ([]models.Query, error) {
+	return r.list(ctx, false)
+}
+
+func (r *QueryRepository) list(ctx context.Context, onlyServed bool) ([]models.Query, error) {
 	query := `
-		SELECT
-			q.id, q.slug, q.name, q.description, q.sql_query,
-			q.datasource_id, q.cache_ttl, q.timeout_seconds, q.is_active,
-			q.created_at, q.updated_at, q.created_by, q.updated_by,
-			d.slug as datasource_slug, d.name as datasource_name
+		SELECT ` + queryColumns + `
 		FROM queries q
 		LEFT JOIN datasources d ON q.datasource_id = d.id
-		WHERE q.is_active = true
-		ORDER BY q.name ASC
 	`
+	if onlyServed {
+		query += " WHERE " + servedCondition
+	}
+	query += " ORDER BY q.name ASC"
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -110,17 +180,11 @@ func (r *QueryRepository) ListActive(ctx context.Context) ([]models.Query, error
 
 	var queries []models.Query
 	for rows.Next() {
-		var q models.Query
-		err := rows.Scan(
-			&q.ID, &q.Slug, &q.Name, &q.Description, &q.SQLQuery,
-			&q.DatasourceID, &q.CacheTTL, &q.TimeoutSeconds, &q.IsActive,
-			&q.CreatedAt, &q.UpdatedAt, &q.CreatedBy, &q.UpdatedBy,
-			&q.DatasourceSlug, &q.DatasourceName,
-		)
+		q, err := scanQuery(rows)
 		if err != nil {
 			return nil, fmt.Errorf("erro ao ler query: %w", err)
 		}
-		queries = append(queries, q)
+		queries = append(queries, *q)
 	}
 
 	if err := rows.Err(); err != nil {
@@ -138,18 +202,177 @@ func (r *QueryRepository) ListActive(ctx context.Context) ([]models.Query, error
 	return queries, nil
 }
 
+// Create grava a query e seus parametros na mesma transacao e preenche o ID.
+func (r *QueryRepository) Create(ctx context.Context, q *models.Query) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return createQuery(ctx, tx, q)
+	})
+}
+
+// Update regrava a query e substitui todos os parametros na mesma transacao.
+func (r *QueryRepository) Update(ctx context.Context, q *models.Query) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return updateQuery(ctx, tx, q)
+	})
+}
+
+// ApplyChanges cria, atualiza e remove queries em uma unica transacao: ou o
+// catalogo inteiro e aplicado, ou nada muda.
+func (r *QueryRepository) ApplyChanges(ctx context.Context, creates, updates []*models.Query, deleteIDs []string) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		for _, q := range creates {
+			if err := createQuery(ctx, tx, q); err != nil {
+				return err
+			}
+		}
+		for _, q := range updates {
+			if err := updateQuery(ctx, tx, q); err != nil {
+				return err
+			}
+		}
+		for _, id := range deleteIDs {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM queries WHERE id = $1`, id); err != nil {
+				return fmt.Errorf("erro ao remover query: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+func (r *QueryRepository) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("erro ao iniciar transação: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("erro ao confirmar transação: %w", err)
+	}
+
+	return nil
+}
+
+func createQuery(ctx context.Context, tx *sql.Tx, q *models.Query) error {
+	query := `
+		INSERT INTO queries (
+			slug, name, description, sql_query, datasource_id,
+			cache_ttl, timeout_seconds, max_concurrency, is_active,
+			created_by, updated_by, tags, allowed_roles, column_policies, quota
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10, $11, $12, $13, $14)
+		RETURNING id, created_at, updated_at
+	`
+
+	err := tx.QueryRowContext(ctx, query,
+		q.Slug, q.Name, q.Description, q.SQLQuery, q.DatasourceID,
+		q.CacheTTL, q.TimeoutSeconds, q.MaxConcurrency, q.IsActive,
+		q.CreatedBy, jsonList(q.Tags), jsonList(q.AllowedRoles), columnPoliciesJSON(q.ColumnPolicies),
+		quotaJSON(q.Quota),
+	).Scan(&q.ID, &q.CreatedAt, &q.UpdatedAt)
+	if err != nil {
+		return wrapWriteError("erro ao criar query", err)
+	}
+
+	if err := insertParameters(ctx, tx, q); err != nil {
+		return err
+	}
+
+	q.Version, err = ensureVersion(ctx, tx, q, deref(q.CreatedBy))
+	return err
+}
+
+func updateQuery(ctx context.Context, tx *sql.Tx, q *models.Query) error {
+	query := `
+		UPDATE queries SET
+			slug = $2, name = $3, description = $4, sql_query = $5, datasource_id = $6,
+			cache_ttl = $7, timeout_seconds = $8, max_concurrency = $9, is_active = $10,
+			updated_by = $11, tags = $12, allowed_roles = $13, column_policies = $14,
+			quota = $15
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	err := tx.QueryRowContext(ctx, query,
+		q.ID, q.Slug, q.Name, q.Description, q.SQLQuery, q.DatasourceID,
+		q.CacheTTL, q.TimeoutSeconds, q.MaxConcurrency, q.IsActive,
+		q.UpdatedBy, jsonList(q.Tags), jsonList(q.AllowedRoles), columnPoliciesJSON(q.ColumnPolicies),
+		quotaJSON(q.Quota),
+	).Scan(&q.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("query '%s' não encontrada", q.Slug)
+	}
+	if err != nil {
+		return wrapWriteError("erro ao atualizar query", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM query_parameters WHERE query_id = $1`, q.ID); err != nil {
+		return fmt.Errorf("erro ao remover parâmetros: %w", err)
+	}
+
+	if err := insertParameters(ctx, tx, q); err != nil {
+		return err
+	}
+
+	q.Version, err = ensureVersion(ctx, tx, q, deref(q.UpdatedBy))
+	return err
+}
+
+// Delete remove a query; parametros saem em cascata e o historico de
+// execucoes fica com query_id nulo.
+func (r *QueryRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM queries WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("erro ao remover query: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("query '%s' não encontrada", id)
+	}
+
+	return nil
+}
+
+func insertParameters(ctx context.Context, tx *sql.Tx, q *models.Query) error {
+	query := `
+		INSERT INTO query_parameters (
+			query_id, name, param_type, is_required,
+			default_value, description, position, validations, bind_from
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8::jsonb, '{}'::jsonb), $9)
+		RETURNING id, created_at
+	`
+
+	for i := range q.Parameters {
+		p := &q.Parameters[i]
+		p.QueryID = q.ID
+
+		err := tx.QueryRowContext(ctx, query,
+			q.ID, p.Name, p.ParamType, p.IsRequired,
+			p.DefaultValue, p.Description, p.Position, p.Validations, p.BindFrom,
+		).Scan(&p.ID, &p.CreatedAt)
+		if err != nil {
+			return wrapWriteError(fmt.Sprintf("erro ao gravar parâmetro '%s'", p.Name), err)
+		}
+	}
+
+	return nil
+}
+
 func (r *QueryRepository) LogExecution(ctx context.Context, execution models.QueryExecution) error {
 	query := `
 		INSERT INTO query_executions (
 			query_id, query_slug, duration_ms, cache_hit,
-			row_count, parameters, error, client_ip, user_agent
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			row_count, parameters, error, client_ip, user_agent, principal, denied
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
 	`
 
 	_, err := r.db.ExecContext(ctx, query,
 		execution.QueryID, execution.QuerySlug, execution.DurationMs, execution.CacheHit,
 		execution.RowCount, execution.Parameters, execution.Error,
-		execution.ClientIP, execution.UserAgent,
+		execution.ClientIP, execution.UserAgent, execution.Principal, execution.Denied,
 	)
 
 	if err != nil {
@@ -158,3 +381,494 @@ func (r *QueryRepository) LogExecution(ctx context.Context, execution models.Que
 
 	return nil
 }
+
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// EnsureVersion grava uma nova versao se a definicao atual da query for
+// diferente da ultima versao registrada, e devolve o numero da versao que
+// corresponde a definicao atual. Roda ao salvar, ao enviar para revisao e na
+// subida da API, o que pega tambem alteracoes feitas direto nas tabelas pela
+// interface Laravel. O status da query acompanha a comparacao com a versao
+// publicada (ver nextStatus).
+func (r *QueryRepository) EnsureVersion(ctx context.Context, q *models.Query, actor string) (int, error) {
+	return ensureVersion(ctx, r.db, q, actor)
+}
+
+// CurrentVersion devolve, sem gravar nada, a versao registrada com a definicao
+// atual da query, ou 0 se ela ainda nao tem versao (editada fora da API e nao
+// salva nem enviada para revisao desde entao).
+func (r *QueryRepository) CurrentVersion(ctx context.Context, q *models.Query) (int, error) {
+	_, hash, err := catalog.Snapshot(q)
+	if err != nil {
+		return 0, err
+	}
+
+	var version int
+	err = r.db.QueryRowContext(ctx, `
+		SELECT version FROM query_versions
+		WHERE query_id = $1 AND content_hash = $2
+		ORDER BY version DESC LIMIT 1
+	`, q.ID, hash).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("erro ao buscar versão: %w", err)
+	}
+
+	return version, nil
+}
+
+// EnsureAllVersions registra a versao atual de todas as queries. Roda na
+// subida da API para que queries publicadas antes do ciclo de vida adotem a
+// definicao original como publicada antes de qualquer edicao. Antes, recalcula
+// o hash das versoes gravadas, para que uma mudanca nos campos versionados nao
+// crie versoes novas nem devolva queries publicadas para draft.
+func (r *QueryRepository) EnsureAllVersions(ctx context.Context, actor string) error {
+	if err := r.rehashVersions(ctx); err != nil {
+		return err
+	}
+
+	queries, err := r.ListAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	for i := range queries {
+		if _, err := r.EnsureVersion(ctx, &queries[i], actor); err != nil {
+			return fmt.Errorf("query '%s': %w", queries[i].Slug, err)
+		}
+	}
+
+	return nil
+}
+
+// rehashVersions recalcula content_hash de todas as versoes a partir da
+// definicao gravada.
+func (r *QueryRepository) rehashVersions(ctx context.Context) error {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT id, definition, datasource_id, content_hash FROM query_versions
+	`)
+	if err != nil {
+		return fmt.Errorf("erro ao listar versões: %w", err)
+	}
+	defer rows.Close()
+
+	// rows.Next() devolve a conexao ao pool ao terminar, antes dos UPDATEs
+	stale := make(map[string]string)
+	for rows.Next() {
+		var id, hash string
+		var definition []byte
+		var datasourceID *string
+		if err := rows.Scan(&id, &definition, &datasourceID, &hash); err != nil {
+			return fmt.Errorf("erro ao ler versão: %w", err)
+		}
+
+		current, err := catalog.ContentHash(definition, deref(datasourceID))
+		if err != nil {
+			return fmt.Errorf("versão %s: %w", id, err)
+		}
+		if current != hash {
+			stale[id] = current
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("erro ao iterar versões: %w", err)
+	}
+
+	for id, hash := range stale {
+		if _, err := r.db.ExecContext(ctx, `UPDATE query_versions SET content_hash = $2 WHERE id = $1`, id, hash); err != nil {
+			return fmt.Errorf("erro ao atualizar hash da versão: %w", err)
+		}
+	}
+
+	if len(stale) > 0 {
+		fmt.Printf("[Versions] Hash recalculado em %d versoes\n", len(stale))
+	}
+
+	return nil
+}
+
+func ensureVersion(ctx context.Context, db querier, q *models.Query, actor string) (int, error) {
+	version, hash, err := recordVersion(ctx, db, q, actor)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := syncStatus(ctx, db, q, version, hash); err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func recordVersion(ctx context.Context, db querier, q *models.Query, actor string) (int, string, error) {
+	definition, hash, err := catalog.Snapshot(q)
+	if err != nil {
+		return 0, "", err
+	}
+
+	var latest int
+	var latestHash string
+	err = db.QueryRowContext(ctx, `
+		SELECT version, content_hash FROM query_versions
+		WHERE query_id = $1
+		ORDER BY version DESC LIMIT 1
+	`, q.ID).Scan(&latest, &latestHash)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, "", fmt.Errorf("erro ao buscar versão: %w", err)
+	}
+	if err == nil && latestHash == hash {
+		return latest, hash, nil
+	}
+
+	var createdBy *string
+	if actor != "" {
+		createdBy = &actor
+	}
+
+	// Duas requisicoes podem detectar a mesma mudanca ao mesmo tempo; a
+	// segunda nao grava nada e usa a versao criada pela primeira.
+	var version int
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO query_versions (query_id, version, definition, datasource_id, content_hash, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (query_id, version) DO NOTHING
+		RETURNING version
+	`, q.ID, latest+1, string(definition), q.DatasourceID, hash, createdBy).Scan(&version)
+	if err == sql.ErrNoRows {
+		return latest + 1, hash, nil
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("erro ao gravar versão: %w", err)
+	}
+
+	return version, hash, nil
+}
+
+// reviewState e o estado de revisao da query, com o hash das versoes
+// publicada e enviada para revisao.
+type reviewState struct {
+	Status           string
+	PublishedVersion *int
+	PublishedHash    string
+	SubmittedVersion *int
+	SubmittedHash    string
+}
+
+// nextStatus calcula o estado depois de registrar a versao atual (version,
+// com o hash informado):
+//   - query publicada antes do ciclo de vida existir adota a versao atual
+//     como publicada;
+//   - definicao diferente da versao publicada (ou da enviada para revisao)
+//     volta para draft, sem tirar do ar a versao publicada;
+//   - draft que voltou a ser identico a versao publicada volta a published;
+//   - query depreciada nunca muda de status sozinha.
+func nextStatus(state reviewState, version int, hash string) reviewState {
+	next := state
+
+	if next.PublishedVersion == nil &&
+		(next.Status == models.QueryStatusPublished || next.Status == models.QueryStatusDeprecated) {
+		next.PublishedVersion = &version
+		next.PublishedHash = hash
+	}
+
+	switch next.Status {
+	case models.QueryStatusPublished:
+		if hash != next.PublishedHash {
+			next.Status = models.QueryStatusDraft
+		}
+	case models.QueryStatusPendingReview:
+		if hash != next.SubmittedHash {
+			next.Status = models.QueryStatusDraft
+			next.SubmittedVersion = nil
+			next.SubmittedHash = ""
+		}
+	}
+
+	if next.Status == models.QueryStatusDraft && next.PublishedVersion != nil && hash == next.PublishedHash {
+		next.Status = models.QueryStatusPublished
+	}
+
+	return next
+}
+
+// syncStatus le o estado de revisao, aplica nextStatus e grava o resultado. O
+// UPDATE so vale se o estado nao mudou desde a leitura; se outra requisicao
+// (uma aprovacao, por exemplo) chegou antes, o estado dela e mantido.
+func syncStatus(ctx context.Context, db querier, q *models.Query, version int, hash string) error {
+	var state reviewState
+	var publishedHash, submittedHash *string
+	err := db.QueryRowContext(ctx, `
+		SELECT q.status, q.published_version, pv.content_hash, q.submitted_version, sv.content_hash
+		FROM queries q
+		LEFT JOIN query_versions pv ON pv.query_id = q.id AND pv.version = q.published_version
+		LEFT JOIN query_versions sv ON sv.query_id = q.id AND sv.version = q.submitted_version
+		WHERE q.id = $1
+	`, q.ID).Scan(&state.Status, &state.PublishedVersion, &publishedHash, &state.SubmittedVersion, &submittedHash)
+	if err != nil {
+		return fmt.Errorf("erro ao buscar status da query: %w", err)
+	}
+	state.PublishedHash = deref(publishedHash)
+	state.SubmittedHash = deref(submittedHash)
+
+	next := nextStatus(state, version, hash)
+
+	if next.Status != state.Status || !sameVersion(next.PublishedVersion, state.PublishedVersion) ||
+		!sameVersion(next.SubmittedVersion, state.SubmittedVersion) {
+		result, err := db.ExecContext(ctx, `
+			UPDATE queries SET
+				status = $2, published_version = $3, submitted_version = $4,
+				submitted_by = CASE WHEN $4::int IS NULL THEN NULL ELSE submitted_by END,
+				submitted_at = CASE WHEN $4::int IS NULL THEN NULL ELSE submitted_at END
+			WHERE id = $1 AND status = $5
+			  AND published_version IS NOT DISTINCT FROM $6::int
+			  AND submitted_version IS NOT DISTINCT FROM $7::int
+		`, q.ID, next.Status, next.PublishedVersion, next.SubmittedVersion,
+			state.Status, state.PublishedVersion, state.SubmittedVersion)
+		if err != nil {
+			return fmt.Errorf("erro ao atualizar status da query: %w", err)
+		}
+
+		applied, _ := result.RowsAffected()
+		if applied > 0 && state.PublishedVersion == nil && next.PublishedVersion != nil {
+			// Versao adotada como publicada conta como aprovada
+			_, err = db.ExecContext(ctx, `
+				UPDATE query_versions SET approved_at = NOW()
+				WHERE query_id = $1 AND version = $2 AND approved_at IS NULL
+			`, q.ID, *next.PublishedVersion)
+			if err != nil {
+				return fmt.Errorf("erro ao aprovar versão: %w", err)
+			}
+		}
+	}
+
+	err = db.QueryRowContext(ctx, `
+		SELECT status, published_version, submitted_version FROM queries WHERE id = $1
+	`, q.ID).Scan(&q.Status, &q.PublishedVersion, &q.SubmittedVersion)
+	if err != nil {
+		return fmt.Errorf("erro ao buscar status da query: %w", err)
+	}
+
+	return nil
+}
+
+func sameVersion(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+const queryVersionColumns = `id, query_id, version, definition, datasource_id, content_hash,
+	created_at, created_by, approved_by, approved_at`
+
+func scanQueryVersion(row rowScanner) (*models.QueryVersion, error) {
+	var v models.QueryVersion
+	var definition []byte
+
+	err := row.Scan(
+		&v.ID, &v.QueryID, &v.Version, &definition, &v.DatasourceID,
+		&v.ContentHash, &v.CreatedAt, &v.CreatedBy, &v.ApprovedBy, &v.ApprovedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	v.Definition = definition
+	return &v, nil
+}
+
+// ListVersions lista o historico da query, da versao mais recente para a mais antiga.
+func (r *QueryRepository) ListVersions(ctx context.Context, queryID string) ([]models.QueryVersion, error) {
+	rows, err := r.db.QueryContext(ctx, `
+		SELECT `+queryVersionColumns+`
+		FROM query_versions
+		WHERE query_id = $1
+		ORDER BY version DESC
+	`, queryID)
+	if err != nil {
+		return nil, fmt.Errorf("erro ao listar versões: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.QueryVersion
+	for rows.Next() {
+		v, err := scanQueryVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("erro ao ler versão: %w", err)
+		}
+		versions = append(versions, *v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("erro ao iterar versões: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (r *QueryRepository) FindVersion(ctx context.Context, queryID string, version int) (*models.QueryVersion, error) {
+	v, err := scanQueryVersion(r.db.QueryRowContext(ctx, `
+		SELECT `+queryVersionColumns+`
+		FROM query_versions
+		WHERE query_id = $1 AND version = $2
+	`, queryID, version))
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("versão %d não encontrada", version)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("erro ao buscar versão: %w", err)
+	}
+
+	return v, nil
+}
+
+// SetPinnedVersion fixa a versao servida por padrao; nil volta a servir a
+// definicao atual.
+func (r *QueryRepository) SetPinnedVersion(ctx context.Context, queryID string, version *int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE queries SET pinned_version = $2 WHERE id = $1`, queryID, version)
+	if err != nil {
+		return fmt.Errorf("erro ao fixar versão: %w", err)
+	}
+	return nil
+}
+
+// SubmitForReview envia a versao atual de uma query em draft para revisao.
+func (r *QueryRepository) SubmitForReview(ctx context.Context, queryID string, version int, actor string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE queries SET
+			status = 'pending_review', submitted_version = $2, submitted_by = $3,
+			submitted_at = NOW(), review_comment = NULL
+		WHERE id = $1 AND status = 'draft'
+	`, queryID, version, actor)
+	if err != nil {
+		return fmt.Errorf("erro ao enviar para revisão: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("query não está em draft: %w", ErrInvalidStatus)
+	}
+
+	return nil
+}
+
+// Approve publica a versao enviada para revisao. Quem aprova nao pode ser quem
+// enviou nem quem escreveu a versao.
+func (r *QueryRepository) Approve(ctx context.Context, queryID string, actor string) (int, error) {
+	var version int
+
+	err := r.inTx(ctx, func(tx *sql.Tx) error {
+		var submittedBy, createdBy *string
+		err := tx.QueryRowContext(ctx, `
+			SELECT q.submitted_version, q.submitted_by, v.created_by
+			FROM queries q
+			JOIN query_versions v ON v.query_id = q.id AND v.version = q.submitted_version
+			WHERE q.id = $1 AND q.status = 'pending_review'
+			FOR UPDATE OF q
+		`, queryID).Scan(&version, &submittedBy, &createdBy)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("query não está em revisão: %w", ErrInvalidStatus)
+		}
+		if err != nil {
+			return fmt.Errorf("erro ao buscar revisão: %w", err)
+		}
+
+		if actor == deref(submittedBy) || actor == deref(createdBy) {
+			return ErrSelfApproval
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE query_versions SET approved_by = $3, approved_at = NOW()
+			WHERE query_id = $1 AND version = $2
+		`, queryID, version, actor)
+		if err != nil {
+			return fmt.Errorf("erro ao aprovar versão: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE queries SET
+				status = 'published', published_version = submitted_version,
+				submitted_version = NULL, reviewed_by = $2, reviewed_at = NOW(), review_comment = NULL
+			WHERE id = $1
+		`, queryID, actor)
+		if err != nil {
+			return fmt.Errorf("erro ao publicar query: %w", err)
+		}
+
+		return nil
+	})
+
+	return version, err
+}
+
+// Reject devolve para draft uma query em revisao, com o motivo.
+func (r *QueryRepository) Reject(ctx context.Context, queryID string, actor string, comment *string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE queries SET
+			status = 'draft', submitted_version = NULL,
+			reviewed_by = $2, reviewed_at = NOW(), review_comment = $3
+		WHERE id = $1 AND status = 'pending_review'
+	`, queryID, actor, comment)
+	if err != nil {
+		return fmt.Errorf("erro ao rejeitar revisão: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("query não está em revisão: %w", ErrInvalidStatus)
+	}
+
+	return nil
+}
+
+// Deprecate marca uma query publicada como obsoleta. Ela continua sendo
+// servida, com o aviso de deprecacao na resposta.
+func (r *QueryRepository) Deprecate(ctx context.Context, queryID string, actor string) error {
+	result, err := r.db.ExecContext(ctx, `
+		UPDATE queries SET status = 'deprecated', reviewed_by = $2, reviewed_at = NOW()
+		WHERE id = $1 AND status = 'published'
+	`, queryID, actor)
+	if err != nil {
+		return fmt.Errorf("erro ao depreciar query: %w", err)
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("query não está publicada: %w", ErrInvalidStatus)
+	}
+
+	return nil
+}
+
+func columnPoliciesJSON(policies []models.ColumnPolicy) string {
+	if len(policies) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(policies)
+	return string(data)
+}
+
+// quotaJSON serializa a cota para as colunas JSONB; campos zerados ficam fora.
+func quotaJSON(quota models.Quota) string {
+	data, _ := json.Marshal(quota)
+	return string(data)
+}
+
+// jsonList serializa listas de texto (tags, roles) para as colunas JSONB.
+func jsonList(values []string) string {
+	if len(values) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
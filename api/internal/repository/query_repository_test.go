@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/adolp26/querybase/internal/models"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestNextStatus(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         reviewState
+		version       int
+		hash          string
+		wantStatus    string
+		wantPublished *int
+		wantSubmitted *int
+	}{
+		{
+			name:          "publicada legada adota a versao atual",
+			state:         reviewState{Status: models.QueryStatusPublished},
+			version:       1,
+			hash:          "a",
+			wantStatus:    models.QueryStatusPublished,
+			wantPublished: intPtr(1),
+		},
+		{
+			name:          "publicada sem mudanca continua publicada",
+			state:         reviewState{Status: models.QueryStatusPublished, PublishedVersion: intPtr(2), PublishedHash: "a"},
+			version:       3,
+			hash:          "a",
+			wantStatus:    models.QueryStatusPublished,
+			wantPublished: intPtr(2),
+		},
+		{
+			name:          "publicada com outro hash volta para draft",
+			state:         reviewState{Status: models.QueryStatusPublished, PublishedVersion: intPtr(2), PublishedHash: "a"},
+			version:       3,
+			hash:          "b",
+			wantStatus:    models.QueryStatusDraft,
+			wantPublished: intPtr(2),
+		},
+		{
+			name: "em revisao com outro hash volta para draft e descarta o envio",
+			state: reviewState{
+				Status:           models.QueryStatusPendingReview,
+				PublishedVersion: intPtr(1), PublishedHash: "a",
+				SubmittedVersion: intPtr(2), SubmittedHash: "b",
+			},
+			version:       3,
+			hash:          "c",
+			wantStatus:    models.QueryStatusDraft,
+			wantPublished: intPtr(1),
+		},
+		{
+			name: "em revisao com o hash enviado continua em revisao",
+			state: reviewState{
+				Status:           models.QueryStatusPendingReview,
+				SubmittedVersion: intPtr(2), SubmittedHash: "b",
+			},
+			version:       2,
+			hash:          "b",
+			wantStatus:    models.QueryStatusPendingReview,
+			wantSubmitted: intPtr(2),
+		},
+		{
+			name:          "draft revertido para o hash publicado volta a published",
+			state:         reviewState{Status: models.QueryStatusDraft, PublishedVersion: intPtr(1), PublishedHash: "a"},
+			version:       1,
+			hash:          "a",
+			wantStatus:    models.QueryStatusPublished,
+			wantPublished: intPtr(1),
+		},
+		{
+			name:          "depreciada com outro hash continua depreciada",
+			state:         reviewState{Status: models.QueryStatusDeprecated, PublishedVersion: intPtr(1), PublishedHash: "a"},
+			version:       2,
+			hash:          "b",
+			wantStatus:    models.QueryStatusDeprecated,
+			wantPublished: intPtr(1),
+		},
+		{
+			name:          "depreciada sem versao publicada adota a atual",
+			state:         reviewState{Status: models.QueryStatusDeprecated},
+			version:       4,
+			hash:          "a",
+			wantStatus:    models.QueryStatusDeprecated,
+			wantPublished: intPtr(4),
+		},
+		{
+			name:       "draft sem versao publicada continua draft",
+			state:      reviewState{Status: models.QueryStatusDraft},
+			version:    1,
+			hash:       "a",
+			wantStatus: models.QueryStatusDraft,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextStatus(tt.state, tt.version, tt.hash)
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, esperava %s", got.Status, tt.wantStatus)
+			}
+			if !sameVersion(got.PublishedVersion, tt.wantPublished) {
+				t.Errorf("published_version = %v, esperava %v", got.PublishedVersion, tt.wantPublished)
+			}
+			if !sameVersion(got.SubmittedVersion, tt.wantSubmitted) {
+				t.Errorf("submitted_version = %v, esperava %v", got.SubmittedVersion, tt.wantSubmitted)
+			}
+		})
+	}
+}
+
+func TestNextStatusKeepsInput(t *testing.T) {
+	state := reviewState{Status: models.QueryStatusPublished, PublishedVersion: intPtr(1), PublishedHash: "a"}
+
+	nextStatus(state, 2, "b")
+
+	if state.Status != models.QueryStatusPublished {
+		t.Fatalf("nextStatus alterou o estado de entrada: %s", state.Status)
+	}
+}
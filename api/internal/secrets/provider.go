@@ -0,0 +1,247 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretProvider resolve a referencia de um segredo (URI) para o valor. O
+// DatasourceRepository usa essa interface para as senhas dos datasources com
+// password_ref.
+type SecretProvider interface {
+	Resolve(ctx context.Context, uri string) (string, error)
+}
+
+// ErrUnsupportedScheme indica uma referencia sem provider registrado.
+var ErrUnsupportedScheme = errors.New("esquema de segredo nao suportado")
+
+// splitURI separa "esquema://resto".
+func splitURI(uri string) (scheme, rest string, err error) {
+	scheme, rest, found := strings.Cut(uri, "://")
+	if !found || scheme == "" || rest == "" {
+		return "", "", fmt.Errorf("referencia de segredo '%s' invalida: use esquema://caminho", uri)
+	}
+	return strings.ToLower(scheme), rest, nil
+}
+
+// ErrNotAllowed indica uma referencia fora das origens liberadas em Policy.
+var ErrNotAllowed = errors.New("referencia de segredo fora das origens permitidas")
+
+// Policy limita o que um password_ref pode ler. Sem ela, quem administra
+// datasources leria qualquer variavel de ambiente (VAULT_TOKEN, a chave de
+// criptografia), arquivo ou segredo do Vault acessivel pela API: bastaria
+// apontar o datasource para um host proprio e receber a "senha". Campo vazio
+// bloqueia o esquema.
+type Policy struct {
+	// EnvPrefix e o prefixo exigido no nome da variavel (ex.: QB_DS_).
+	EnvPrefix string
+	// FileDirs sao os diretorios de onde arquivos podem ser lidos.
+	FileDirs []string
+	// VaultPrefix e o caminho do KV sob o qual os segredos podem ser lidos
+	// (ex.: secret/data/querybase).
+	VaultPrefix string
+}
+
+// Registry escolhe o provider pelo esquema da URI (env://, file://, vault://)
+// e recusa referencias que a Policy nao libera.
+type Registry struct {
+	providers map[string]SecretProvider
+	policy    Policy
+}
+
+func NewRegistry(policy Policy) *Registry {
+	return &Registry{providers: make(map[string]SecretProvider), policy: policy}
+}
+
+func (r *Registry) Register(scheme string, provider SecretProvider) {
+	r.providers[strings.ToLower(scheme)] = provider
+}
+
+func (r *Registry) Resolve(ctx context.Context, uri string) (string, error) {
+	scheme, rest, err := splitURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	provider, ok := r.providers[scheme]
+	if !ok {
+		return "", fmt.Errorf("%w: '%s'", ErrUnsupportedScheme, scheme)
+	}
+
+	if err := r.policy.allow(scheme, rest); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotAllowed, err)
+	}
+
+	return provider.Resolve(ctx, uri)
+}
+
+// allow confere a referencia contra a origem liberada do esquema. Esquemas
+// sem regra sao recusados.
+func (p Policy) allow(scheme, rest string) error {
+	switch scheme {
+	case "env":
+		if p.EnvPrefix == "" {
+			return errors.New("env:// desabilitado (secrets.env_prefix)")
+		}
+		if !strings.HasPrefix(rest, p.EnvPrefix) || rest == p.EnvPrefix {
+			return fmt.Errorf("variavel '%s' sem o prefixo '%s' (secrets.env_prefix)", rest, p.EnvPrefix)
+		}
+		return nil
+	case "file":
+		return p.allowFile(rest)
+	case "vault":
+		return p.allowVault(rest)
+	default:
+		return fmt.Errorf("esquema '%s' sem origem configurada", scheme)
+	}
+}
+
+// allowFile exige um caminho absoluto que, com os links simbolicos
+// resolvidos, fique dentro de um dos diretorios liberados. Os secrets do
+// Kubernetes sao links para ..data dentro do proprio diretorio montado.
+func (p Policy) allowFile(file string) error {
+	if len(p.FileDirs) == 0 {
+		return errors.New("file:// desabilitado (secrets.file_dirs)")
+	}
+	if !filepath.IsAbs(file) {
+		return fmt.Errorf("caminho '%s' precisa ser absoluto", file)
+	}
+
+	resolved, err := filepath.EvalSymlinks(file)
+	if err != nil {
+		return fmt.Errorf("erro ao ler segredo: %w", err)
+	}
+
+	for _, dir := range p.FileDirs {
+		if dir == "" {
+			continue
+		}
+		if realDir, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = realDir
+		}
+		if rel, err := filepath.Rel(filepath.Clean(dir), resolved); err == nil && rel != "." && filepath.IsLocal(rel) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("arquivo '%s' fora de secrets.file_dirs", file)
+}
+
+// allowVault exige um caminho canonico (sem "..", "//" ou escapes, que o
+// Vault normalizaria para fora do prefixo) sob secrets.vault.mount_prefix.
+func (p Policy) allowVault(rest string) error {
+	prefix := strings.Trim(p.VaultPrefix, "/")
+	if prefix == "" {
+		return errors.New("vault:// desabilitado (secrets.vault.mount_prefix)")
+	}
+
+	secretPath, _, _ := strings.Cut(rest, "#")
+	secretPath = strings.TrimLeft(secretPath, "/")
+	if strings.ContainsAny(secretPath, "%?\\") || path.Clean("/"+secretPath) != "/"+secretPath {
+		return fmt.Errorf("caminho '%s' invalido", secretPath)
+	}
+	if !strings.HasPrefix(secretPath, prefix+"/") {
+		return fmt.Errorf("caminho '%s' fora de '%s' (secrets.vault.mount_prefix)", secretPath, prefix)
+	}
+
+	return nil
+}
+
+// EnvProvider le o segredo de uma variavel de ambiente: env://QB_DS_ERP_PASSWORD.
+type EnvProvider struct{}
+
+func (EnvProvider) Resolve(_ context.Context, uri string) (string, error) {
+	_, name, err := splitURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return "", fmt.Errorf("variavel de ambiente '%s' nao definida", name)
+	}
+	return value, nil
+}
+
+// FileProvider le o segredo de um arquivo, como os montados pelo Kubernetes:
+// file:///var/run/secrets/querybase/erp/password. A quebra de linha final e removida.
+type FileProvider struct{}
+
+func (FileProvider) Resolve(_ context.Context, uri string) (string, error) {
+	_, path, err := splitURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("erro ao ler segredo: %w", err)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("arquivo de segredo '%s' vazio", path)
+	}
+	return value, nil
+}
+
+// Cache guarda os segredos resolvidos por ttl. Depois disso o segredo e lido
+// de novo no proximo uso, o que permite rotacionar a senha na origem sem
+// alterar o datasource. Se a renovacao falhar, o valor anterior continua
+// valendo ate a origem voltar.
+type Cache struct {
+	provider SecretProvider
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value     string
+	fetchedAt time.Time
+}
+
+// NewCache envolve o provider com cache; ttl <= 0 usa 300 segundos.
+func NewCache(provider SecretProvider, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = 300 * time.Second
+	}
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		entries:  make(map[string]cachedSecret),
+	}
+}
+
+func (c *Cache) Resolve(ctx context.Context, uri string) (string, error) {
+	c.mu.Lock()
+	entry, cached := c.entries[uri]
+	c.mu.Unlock()
+
+	if cached && time.Since(entry.fetchedAt) < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.Resolve(ctx, uri)
+	if err != nil {
+		if cached {
+			fmt.Printf("[Secrets] Erro ao renovar '%s', usando o valor anterior: %v\n", uri, err)
+			return entry.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[uri] = cachedSecret{value: value, fetchedAt: time.Now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
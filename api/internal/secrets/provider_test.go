@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRegistryPolicy(t *testing.T) {
+	allowed := t.TempDir()
+	outside := t.TempDir()
+
+	write := func(dir, name, value string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(value+"\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	inside := write(allowed, "erp", "senha-erp")
+	secret := write(outside, "chave", "nao-pode")
+
+	// Link dentro do diretorio liberado apontando para fora dele
+	link := filepath.Join(allowed, "atalho")
+	if err := os.Symlink(secret, link); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("QB_DS_ERP", "senha-env")
+	t.Setenv("QUERYBASE_ENCRYPTION_KEY", "chave-mestra")
+
+	registry := NewRegistry(Policy{EnvPrefix: "QB_DS_", FileDirs: []string{allowed}})
+	registry.Register("env", EnvProvider{})
+	registry.Register("file", FileProvider{})
+
+	tests := []struct {
+		uri     string
+		want    string
+		allowed bool
+	}{
+		{"env://QB_DS_ERP", "senha-env", true},
+		{"env://QUERYBASE_ENCRYPTION_KEY", "", false},
+		{"env://QB_DS_", "", false},
+		{"file://" + inside, "senha-erp", true},
+		{"file://" + secret, "", false},
+		{"file://" + filepath.Join(allowed, "..", filepath.Base(outside), "chave"), "", false},
+		{"file://" + link, "", false},
+		{"file://erp", "", false},
+	}
+
+	for _, tt := range tests {
+		got, err := registry.Resolve(context.Background(), tt.uri)
+		if tt.allowed {
+			if err != nil || got != tt.want {
+				t.Errorf("Resolve(%s) = %q, %v; esperava %q", tt.uri, got, err, tt.want)
+			}
+			continue
+		}
+		if got != "" || err == nil {
+			t.Errorf("Resolve(%s) = %q, %v; esperava recusa", tt.uri, got, err)
+		}
+	}
+
+	if _, err := registry.Resolve(context.Background(), "env://PATH"); !errors.Is(err, ErrNotAllowed) {
+		t.Fatalf("erro = %v, esperava ErrNotAllowed", err)
+	}
+}
+
+func TestPolicyDisablesEmptySchemes(t *testing.T) {
+	var policy Policy
+
+	for scheme, rest := range map[string]string{
+		"env":   "QB_DS_ERP",
+		"file":  "/var/run/secrets/querybase/erp",
+		"vault": "secret/data/querybase/erp#password",
+	} {
+		if err := policy.allow(scheme, rest); err == nil {
+			t.Errorf("%s:// liberado sem configuracao", scheme)
+		}
+	}
+}
+
+func TestPolicyVaultPrefix(t *testing.T) {
+	policy := Policy{VaultPrefix: "/secret/data/querybase/"}
+
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"secret/data/querybase/erp#password", true},
+		{"/secret/data/querybase/financeiro/erp", true},
+		{"secret/data/querybase", false},
+		{"secret/data/querybase-admin/erp", false},
+		{"secret/data/outra/erp", false},
+		{"secret/data/querybase/../outra/erp", false},
+		{"secret/data/querybase/%2e%2e/outra", false},
+		{"secret/data/querybase//erp", false},
+		{"secret/data/querybase/erp?version=1", false},
+	}
+
+	for _, tt := range tests {
+		err := policy.allow("vault", tt.path)
+		if (err == nil) != tt.allowed {
+			t.Errorf("allow(vault://%s) = %v; liberado esperado: %v", tt.path, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// defaultVaultKey e o campo lido quando a URI nao informa um (#campo).
+const defaultVaultKey = "password"
+
+// VaultProvider le segredos do KV do HashiCorp Vault:
+// vault://secret/data/querybase/erp#password (KV v2) ou
+// vault://kv/querybase/erp#password (KV v1). Em desenvolvimento, o servico
+// vault do docker-compose sobe um Vault em modo dev.
+type VaultProvider struct {
+	address string
+	token   string
+	client  *http.Client
+}
+
+// NewVaultProvider cria o provider. Endereco e token vazios usam VAULT_ADDR e
+// VAULT_TOKEN.
+func NewVaultProvider(address, token string) *VaultProvider {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+
+	return &VaultProvider{
+		address: strings.TrimRight(address, "/"),
+		token:   token,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *VaultProvider) Resolve(ctx context.Context, uri string) (string, error) {
+	_, rest, err := splitURI(uri)
+	if err != nil {
+		return "", err
+	}
+	if p.address == "" {
+		return "", errors.New("endereco do Vault nao configurado (secrets.vault.address ou VAULT_ADDR)")
+	}
+
+	path, key, _ := strings.Cut(rest, "#")
+	if key == "" {
+		key = defaultVaultKey
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.address+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("erro ao consultar o Vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("resposta %d do Vault para '%s'", resp.StatusCode, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("resposta invalida do Vault: %w", err)
+	}
+
+	// KV v2 aninha os campos em data.data; KV v1 devolve direto em data
+	fields := body.Data
+	if nested, ok := body.Data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := body.Data["metadata"]; hasMetadata {
+			fields = nested
+		}
+	}
+
+	value, ok := fields[key].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("campo '%s' nao encontrado no segredo '%s'", key, path)
+	}
+	return value, nil
+}
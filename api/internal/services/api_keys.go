@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/adolp26/querybase/internal/crypto"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/adolp26/querybase/internal/repository"
+)
+
+// ErrInvalidAPIKey indica chave inexistente, revogada ou expirada.
+var ErrInvalidAPIKey = errors.New("API key invalida, revogada ou expirada")
+
+// lastUsedInterval limita a gravacao de last_used_at a uma vez por intervalo
+// por chave, para nao gerar um UPDATE a cada requisicao.
+const lastUsedInterval = time.Minute
+
+type cachedAPIKey struct {
+	key      *models.APIKey
+	cachedAt time.Time
+}
+
+// APIKeyService emite e valida as API keys guardadas no banco. Chaves
+// validadas ficam em memoria por cacheTTL; revogar ou rotacionar por esta
+// instancia limpa o cache na hora, nas demais vale em ate cacheTTL.
+type APIKeyService struct {
+	repo     *repository.APIKeyRepository
+	cacheTTL time.Duration
+
+	mu       sync.Mutex
+	cache    map[string]cachedAPIKey
+	lastUsed map[string]time.Time
+}
+
+func NewAPIKeyService(repo *repository.APIKeyRepository, cacheTTLSeconds int) *APIKeyService {
+	if cacheTTLSeconds <= 0 {
+		cacheTTLSeconds = 30
+	}
+
+	return &APIKeyService{
+		repo:     repo,
+		cacheTTL: time.Duration(cacheTTLSeconds) * time.Second,
+		cache:    make(map[string]cachedAPIKey),
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+// Authenticate valida a chave em texto puro e devolve o registro.
+func (s *APIKeyService) Authenticate(ctx context.Context, plain string) (*models.APIKey, error) {
+	prefix, secret, err := crypto.ParseAPIKey(plain)
+	if err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// O cache e indexado pelo hash da chave, nunca pelo texto puro
+	sum := sha256.Sum256([]byte(plain))
+	cacheKey := hex.EncodeToString(sum[:])
+	now := time.Now()
+
+	s.mu.Lock()
+	entry, cached := s.cache[cacheKey]
+	s.mu.Unlock()
+
+	key := entry.key
+	if !cached || now.Sub(entry.cachedAt) > s.cacheTTL {
+		key, err = s.repo.FindByPrefix(ctx, prefix)
+		if err != nil {
+			return nil, ErrInvalidAPIKey
+		}
+		if !crypto.VerifyAPIKeySecret(secret, key.Salt, key.Hash) {
+			return nil, ErrInvalidAPIKey
+		}
+
+		s.mu.Lock()
+		s.cache[cacheKey] = cachedAPIKey{key: key, cachedAt: now}
+		s.mu.Unlock()
+	}
+
+	if !key.Usable(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	s.touch(key.ID, now)
+	return key, nil
+}
+
+func (s *APIKeyService) touch(id string, now time.Time) {
+	s.mu.Lock()
+	last, seen := s.lastUsed[id]
+	if seen && now.Sub(last) < lastUsedInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastUsed[id] = now
+	s.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := s.repo.TouchLastUsed(ctx, id, now); err != nil {
+			fmt.Printf("[APIKeys] %v\n", err)
+		}
+	}()
+}
+
+// Issue emite uma nova chave e devolve o texto puro, que nao e guardado.
+func (s *APIKeyService) Issue(ctx context.Context, key *models.APIKey) (string, error) {
+	plain, err := s.fillSecret(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.repo.Create(ctx, key); err != nil {
+		return "", err
+	}
+
+	return plain, nil
+}
+
+// Rotate emite uma chave nova com o nome, dono, scopes, roles, atributos, cota
+// e validade da antiga.
+// A antiga continua valendo por grace (zero encerra na hora).
+func (s *APIKeyService) Rotate(ctx context.Context, old *models.APIKey, grace time.Duration, actor string) (*models.APIKey, string, error) {
+	key := &models.APIKey{
+		Name:       old.Name,
+		Owner:      old.Owner,
+		Scopes:     old.Scopes,
+		Roles:      old.Roles,
+		Attributes: old.Attributes,
+		Quota:      old.Quota,
+		ExpiresAt:  old.ExpiresAt,
+		CreatedBy:  &actor,
+	}
+
+	plain, err := s.fillSecret(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := s.repo.Rotate(ctx, old.ID, time.Now().Add(grace), key); err != nil {
+		return nil, "", err
+	}
+
+	s.forget(old.ID)
+	return key, plain, nil
+}
+
+func (s *APIKeyService) Revoke(ctx context.Context, id string) error {
+	if err := s.repo.Revoke(ctx, id); err != nil {
+		return err
+	}
+
+	s.forget(id)
+	return nil
+}
+
+func (s *APIKeyService) fillSecret(key *models.APIKey) (string, error) {
+	plain, prefix, salt, hash, err := crypto.GenerateAPIKey()
+	if err != nil {
+		return "", fmt.Errorf("erro ao gerar API key: %w", err)
+	}
+
+	key.Prefix = prefix
+	key.Salt = salt
+	key.Hash = hash
+	return plain, nil
+}
+
+// forget tira a chave do cache para que a revogacao valha na hora.
+func (s *APIKeyService) forget(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for cacheKey, entry := range s.cache {
+		if entry.key.ID == id {
+			delete(s.cache, cacheKey)
+		}
+	}
+}
@@ -53,3 +53,12 @@ func (s *CacheService) GetOrSet(
 
 	return data, nil
 }
+
+// InvalidateQuery remove os resultados em cache de uma query, de todas as
+// combinacoes de parametros.
+func (s *CacheService) InvalidateQuery(ctx context.Context, slug string) error {
+	if err := s.redis.Client.Del(ctx, "query:"+slug).Err(); err != nil {
+		return fmt.Errorf("erro ao invalidar cache: %w", err)
+	}
+	return s.redis.DeleteByPattern(ctx, "query:"+slug+":*")
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/adolp26/querybase/internal/database"
+	"github.com/adolp26/querybase/internal/models"
+	"github.com/redis/go-redis/v9"
+)
+
+// Escopos de cota.
+const (
+	QuotaScopeKey   = "key"
+	QuotaScopeQuery = "query"
+)
+
+// quotaTTL mantem o contador do dia anterior por algumas horas, para consulta.
+const quotaTTL = 48 * time.Hour
+
+// QuotaSubject e quem consome uma cota: uma API key (ou principal) ou uma
+// query, com o limite que vale para ele.
+type QuotaSubject struct {
+	Scope string
+	ID    string
+	Limit models.Quota
+}
+
+// QuotaUsage e o consumo de uma requisicao ou de um dia.
+type QuotaUsage struct {
+	Rows         int64 `json:"rows"`
+	Executions   int64 `json:"executions"`
+	DBTimeMillis int64 `json:"db_time_ms"`
+}
+
+// QuotaRemaining traz o saldo de cada limite; nil quando nao ha limite.
+type QuotaRemaining struct {
+	Rows       *int64   `json:"rows"`
+	Executions *int64   `json:"executions"`
+	DBSeconds  *float64 `json:"db_seconds"`
+}
+
+// QuotaStatus e a situacao do dia de um QuotaSubject.
+type QuotaStatus struct {
+	Scope     string         `json:"scope"`
+	ID        string         `json:"id"`
+	Limit     models.Quota   `json:"limit"`
+	Used      QuotaUsage     `json:"used"`
+	Remaining QuotaRemaining `json:"remaining"`
+	ResetsAt  time.Time      `json:"resets_at"`
+}
+
+// Exceeded devolve o limite esgotado (rows_per_day, executions_per_day ou
+// db_seconds_per_day), ou "" se ainda ha saldo. Linhas sao conferidas antes da
+// execucao, entao a ultima execucao do dia pode passar um pouco do limite.
+func (s *QuotaStatus) Exceeded() string {
+	switch {
+	case s.Limit.RowsPerDay > 0 && s.Used.Rows >= s.Limit.RowsPerDay:
+		return "rows_per_day"
+	case s.Limit.ExecutionsPerDay > 0 && s.Used.Executions >= s.Limit.ExecutionsPerDay:
+		return "executions_per_day"
+	case s.Limit.DBSecondsPerDay > 0 && s.Used.DBTimeMillis >= s.Limit.DBSecondsPerDay*1000:
+		return "db_seconds_per_day"
+	}
+	return ""
+}
+
+// QuotaService contabiliza o consumo diario no Redis, compartilhado entre as
+// replicas da API. Os contadores existem mesmo sem limite, para consulta.
+type QuotaService struct {
+	redis       *database.RedisClient
+	keyDefaults models.Quota
+}
+
+// NewQuotaService cria o servico; keyDefaults vale para os campos zerados da
+// cota de cada API key.
+func NewQuotaService(redis *database.RedisClient, keyDefaults models.Quota) *QuotaService {
+	return &QuotaService{
+		redis:       redis,
+		keyDefaults: keyDefaults,
+	}
+}
+
+// KeySubject monta o consumidor de uma credencial com a cota dela completada
+// pelos padroes.
+func (s *QuotaService) KeySubject(id string, quota models.Quota) QuotaSubject {
+	return QuotaSubject{Scope: QuotaScopeKey, ID: id, Limit: quota.WithDefaults(s.keyDefaults)}
+}
+
+// QuerySubject monta o consumidor de uma query.
+func QuerySubject(query *models.Query) QuotaSubject {
+	return QuotaSubject{Scope: QuotaScopeQuery, ID: query.Slug, Limit: query.Quota}
+}
+
+// Status le o consumo do dia de cada subject.
+func (s *QuotaService) Status(ctx context.Context, subjects ...QuotaSubject) ([]QuotaStatus, error) {
+	now := time.Now().UTC()
+	resetsAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	pipe := s.redis.Client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(subjects))
+	for i, subject := range subjects {
+		cmds[i] = pipe.HGetAll(ctx, quotaKey(subject, now))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("erro ao ler cotas no Redis: %w", err)
+	}
+
+	statuses := make([]QuotaStatus, len(subjects))
+	for i, subject := range subjects {
+		values := cmds[i].Val()
+
+		var used QuotaUsage
+		used.Rows, _ = strconv.ParseInt(values["rows"], 10, 64)
+		used.Executions, _ = strconv.ParseInt(values["executions"], 10, 64)
+		used.DBTimeMillis, _ = strconv.ParseInt(values["db_time_ms"], 10, 64)
+
+		statuses[i] = newQuotaStatus(subject, used, resetsAt)
+	}
+
+	return statuses, nil
+}
+
+// Record soma o consumo de uma requisicao ao dia de cada subject.
+func (s *QuotaService) Record(ctx context.Context, usage QuotaUsage, subjects ...QuotaSubject) error {
+	now := time.Now().UTC()
+
+	pipe := s.redis.Client.TxPipeline()
+	for _, subject := range subjects {
+		key := quotaKey(subject, now)
+		pipe.HIncrBy(ctx, key, "rows", usage.Rows)
+		pipe.HIncrBy(ctx, key, "executions", usage.Executions)
+		pipe.HIncrBy(ctx, key, "db_time_ms", usage.DBTimeMillis)
+		pipe.Expire(ctx, key, quotaTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("erro ao registrar consumo no Redis: %w", err)
+	}
+
+	return nil
+}
+
+func quotaKey(subject QuotaSubject, now time.Time) string {
+	return fmt.Sprintf("quota:%s:%s:%s", subject.Scope, subject.ID, now.Format("2006-01-02"))
+}
+
+// Plus devolve a situacao depois de somar usage, sem consultar o Redis.
+func (s QuotaStatus) Plus(usage QuotaUsage) QuotaStatus {
+	used := QuotaUsage{
+		Rows:         s.Used.Rows + usage.Rows,
+		Executions:   s.Used.Executions + usage.Executions,
+		DBTimeMillis: s.Used.DBTimeMillis + usage.DBTimeMillis,
+	}
+	return newQuotaStatus(QuotaSubject{Scope: s.Scope, ID: s.ID, Limit: s.Limit}, used, s.ResetsAt)
+}
+
+func newQuotaStatus(subject QuotaSubject, used QuotaUsage, resetsAt time.Time) QuotaStatus {
+	status := QuotaStatus{
+		Scope:    subject.Scope,
+		ID:       subject.ID,
+		Limit:    subject.Limit,
+		Used:     used,
+		ResetsAt: resetsAt,
+	}
+
+	if limit := subject.Limit.RowsPerDay; limit > 0 {
+		remaining := max(limit-used.Rows, 0)
+		status.Remaining.Rows = &remaining
+	}
+	if limit := subject.Limit.ExecutionsPerDay; limit > 0 {
+		remaining := max(limit-used.Executions, 0)
+		status.Remaining.Executions = &remaining
+	}
+	if limit := subject.Limit.DBSecondsPerDay; limit > 0 {
+		remaining := max(float64(limit*1000-used.DBTimeMillis)/1000, 0)
+		status.Remaining.DBSeconds = &remaining
+	}
+
+	return status
+}
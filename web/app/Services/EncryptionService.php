@@ -2,37 +2,84 @@
 
 namespace App\Services;
 
+/**
+ * Criptografia compartilhada com a API Go (api/internal/crypto/aes.go).
+ *
+ * Formato: v1:<id da chave>:base64(nonce + ciphertext + tag). Textos sem o
+ * prefixo sao do formato antigo, sem id, e sao testados com todas as chaves.
+ */
 class EncryptionService
 {
-    private string $key;
+    private const FORMAT_VERSION = 'v1';
+    private const LEGACY_KEY_ID = 'default';
+
+    /** @var array<string, string> id => chave; a primeira e a ativa */
+    private array $keys = [];
     private string $cipher = 'aes-256-gcm';
     private int $nonceLength = 12;
     private int $tagLength = 16;
 
     public function __construct()
     {
-        $keyBase64 = config('querybase.encryption_key');
+        $keyring = trim((string) config('querybase.encryption_keys'));
+
+        if ($keyring !== '') {
+            foreach (explode(',', $keyring) as $entry) {
+                $parts = explode(':', trim($entry), 2);
+
+                if (count($parts) !== 2) {
+                    throw new \RuntimeException('QUERYBASE_ENCRYPTION_KEYS invalida: use id:base64');
+                }
+
+                $this->addKey($parts[0], $parts[1]);
+            }
+        }
+
+        $legacyKey = config('querybase.encryption_key');
+
+        if (!empty($legacyKey)) {
+            $this->addKey(self::LEGACY_KEY_ID, $legacyKey);
+        }
+
+        if (empty($this->keys)) {
+            throw new \RuntimeException('QUERYBASE_ENCRYPTION_KEYS ou QUERYBASE_ENCRYPTION_KEY nao configurada');
+        }
+    }
+
+    private function addKey(string $id, string $keyBase64): void
+    {
+        if (!preg_match('/^[A-Za-z0-9_-]{1,32}$/', $id)) {
+            throw new \RuntimeException("Id de chave '{$id}' invalido");
+        }
 
-        if (empty($keyBase64)) {
-            throw new \RuntimeException('QUERYBASE_ENCRYPTION_KEY nao configurada');
+        if (isset($this->keys[$id])) {
+            throw new \RuntimeException("Id de chave '{$id}' repetido no keyring");
         }
 
-        $this->key = base64_decode($keyBase64);
+        $key = base64_decode(trim($keyBase64), true);
 
-        if (strlen($this->key) !== 32) {
-            throw new \RuntimeException('QUERYBASE_ENCRYPTION_KEY deve ter 32 bytes (256 bits)');
+        if ($key === false || strlen($key) !== 32) {
+            throw new \RuntimeException("Chave '{$id}' deve ter 32 bytes (256 bits) em base64");
         }
+
+        $this->keys[$id] = $key;
+    }
+
+    public function activeKeyId(): string
+    {
+        return array_key_first($this->keys);
     }
 
     public function encrypt(string $plaintext): string
     {
+        $keyId = $this->activeKeyId();
         $nonce = random_bytes($this->nonceLength);
         $tag = '';
 
         $ciphertext = openssl_encrypt(
             $plaintext,
             $this->cipher,
-            $this->key,
+            $this->keys[$keyId],
             OPENSSL_RAW_DATA,
             $nonce,
             $tag,
@@ -44,10 +91,36 @@ public function encrypt(string $plaintext): string
             throw new \RuntimeException('Falha ao criptografar');
         }
 
-        return base64_encode($nonce . $ciphertext . $tag);
+        return self::FORMAT_VERSION . ':' . $keyId . ':' . base64_encode($nonce . $ciphertext . $tag);
+    }
+
+    public function decrypt(string $encrypted): string
+    {
+        $parts = explode(':', $encrypted, 3);
+
+        if (count($parts) === 3 && $parts[0] === self::FORMAT_VERSION) {
+            [, $keyId, $payload] = $parts;
+
+            if (!isset($this->keys[$keyId])) {
+                throw new \RuntimeException("Chave de criptografia '{$keyId}' nao esta no keyring");
+            }
+
+            return $this->open($this->keys[$keyId], $payload);
+        }
+
+        // Formato antigo: sem id, vale qualquer chave conhecida
+        foreach ($this->keys as $key) {
+            try {
+                return $this->open($key, $encrypted);
+            } catch (\RuntimeException $e) {
+                $lastError = $e;
+            }
+        }
+
+        throw $lastError;
     }
 
-    public function decrypt(string $encryptedBase64): string
+    private function open(string $key, string $encryptedBase64): string
     {
         $data = base64_decode($encryptedBase64);
 
@@ -62,7 +135,7 @@ public function decrypt(string $encryptedBase64): string
         $plaintext = openssl_decrypt(
             $ciphertext,
             $this->cipher,
-            $this->key,
+            $key,
             OPENSSL_RAW_DATA,
             $nonce,
             $tag
@@ -6,6 +6,9 @@
 
     'encryption_key' => env('QUERYBASE_ENCRYPTION_KEY'),
 
+    // Keyring "id:base64,id:base64"; a primeira chave e a ativa
+    'encryption_keys' => env('QUERYBASE_ENCRYPTION_KEYS'),
+
     'connection_timeout' => env('QUERYBASE_CONNECTION_TIMEOUT', 30),
 
     'query_timeout' => env('QUERYBASE_QUERY_TIMEOUT', 120),